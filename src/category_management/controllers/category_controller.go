@@ -5,9 +5,11 @@ import (
 	"net/http"
 
 	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/database"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/messenger"
 	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/models"
 	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/serialization"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 var CategoryNotFoundResponse = serialization.ErrorResponse{Details: serialization.ErrorDetails{Status: 404, Message: "Category not found"}}
@@ -52,7 +54,17 @@ func CreateCategory(ctx *gin.Context) {
 	ctx.BindJSON(&category)
 
 	log.Println("Creating category: ", category)
-	database.DB.Create(&category)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&category).Error; err != nil {
+			return err
+		}
+		return messenger.EnqueueCategoryEvent(tx, messenger.CategoryCreated, category)
+	})
+	if err != nil {
+		log.Println("Error creating category: ", err)
+		ctx.JSON(http.StatusInternalServerError, InternalServerErrorResponse)
+		return
+	}
 
 	ctx.JSON(201, category)
 }
@@ -87,7 +99,17 @@ func UpdateCategory(ctx *gin.Context, conds QueryConditions) {
 	}
 
 	log.Println("Updating category with id ", conds["id"], " with body: ", updateBody)
-	database.DB.Model(&category).Updates(updateBody)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&category).Updates(updateBody).Error; err != nil {
+			return err
+		}
+		return messenger.EnqueueCategoryEvent(tx, messenger.CategoryUpdated, category)
+	})
+	if err != nil {
+		log.Println("Error updating category with id ", conds["id"], ": ", err)
+		ctx.JSON(http.StatusInternalServerError, InternalServerErrorResponse)
+		return
+	}
 
 	ctx.JSON(200, category)
 }
@@ -106,7 +128,17 @@ func DeleteCategory(ctx *gin.Context, conds QueryConditions) {
 	}
 
 	log.Println("Deleting category with id ", conds["id"])
-	database.DB.Delete(&category)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&category).Error; err != nil {
+			return err
+		}
+		return messenger.EnqueueCategoryEvent(tx, messenger.CategoryDeleted, category)
+	})
+	if err != nil {
+		log.Println("Error deleting category with id ", conds["id"], ": ", err)
+		ctx.JSON(http.StatusInternalServerError, InternalServerErrorResponse)
+		return
+	}
 
 	ctx.JSON(204, http.NoBody)
 }
@@ -40,7 +40,7 @@ func OpenDBConnection(dsn string, opener func(dsn string)(gorm.Dialector)) *gorm
 // makeMigrations performs automatic database schema migration for all models defined in the application.
 // It ensures that the database schema is up to date with the latest model definitions.
 func MakeMigrations(db Migrator) {
-	err := db.AutoMigrate(&models.Category{})
+	err := db.AutoMigrate(&models.Category{}, &models.OutboxEvent{})
 	if err != nil {
 		log.Fatalf("Error migrating database: %v", err)
 	}
@@ -26,12 +26,15 @@ func TestMakeMigrations(t *testing.T) {
         t.Errorf("Expected 1 call to AutoMigrate, got %d", len(fakeMigrator.CallValues))
     }
     args := fakeMigrator.CallValues[0].([]interface{})
-    if len(args) != 1 {
-        t.Fatalf("Expected the slice argument to AutoMigrate to have 1 element, got %d", len(args))
+    if len(args) != 2 {
+        t.Fatalf("Expected the slice argument to AutoMigrate to have 2 elements, got %d", len(args))
     }
     if _, ok := args[0].(*models.Category); !ok {
         t.Errorf("Expected AutoMigrate to be called with a *models.Category, got %T", args[0])
     }
+    if _, ok := args[1].(*models.OutboxEvent); !ok {
+        t.Errorf("Expected AutoMigrate to be called with a *models.OutboxEvent, got %T", args[1])
+    }
 }
 
 type fakeMigrator struct{
@@ -1,13 +1,78 @@
 package main
 
 import (
-	// "fmt"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-	// "gorm.io/driver/mysql"
-	// "gorm.io/gorm"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/database"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/messenger"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/router"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+	"github.com/gin-gonic/gin"
 )
 
+const shutdownTimeout = 30 * time.Second
+
+// main serves the category API and publishes the outbox of the category events until it receives
+// SIGINT or SIGTERM. The database DSN is read from DB_DSN, the comma separated Kafka brokers from
+// KAFKA_BROKERS and the address to listen on from HTTP_ADDR.
 func main() {
-	// dsn := "root:root@tcp(127.0.0.1:3306)/category_management?charset=utf8mb4&parseTime=True&loc=Local"
-	// db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	database.StartDB()
+
+	brokers := strings.Split(envOr("KAFKA_BROKERS", "localhost:9092"), ",")
+	producer, err := kafka.NewProducer(brokers, kafka.WithTopic(messenger.CategoriesTopic))
+	if err != nil {
+		log.Fatalf("Error creating Kafka producer: %v", err)
+	}
+
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		messenger.NewRelay(database.DB, producer).Run(relayCtx)
+	}()
+
+	engine := gin.Default()
+	router.HandleRequests(engine)
+	server := &http.Server{Addr: envOr("HTTP_ADDR", ":8080"), Handler: engine}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Error serving requests: %v", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// The requests in flight may still write events to the outbox, so the relay stops after them.
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down the server: %v", err)
+	}
+	stopRelay()
+	<-relayDone
+
+	if _, err := producer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error closing Kafka producer: %v", err)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
 }
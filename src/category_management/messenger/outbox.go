@@ -0,0 +1,110 @@
+package messenger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/models"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+	"gorm.io/gorm"
+)
+
+// CategoriesTopic is the topic the category events are published to.
+const CategoriesTopic = "categories"
+
+// Source is the source of the events published by this service.
+const Source = "category_management"
+
+const (
+	CategoryCreated = "CategoryCreated"
+	CategoryUpdated = "CategoryUpdated"
+	CategoryDeleted = "CategoryDeleted"
+)
+
+// CategoryEvent is the payload of the category events: the category with snake_case field names
+// and its times formatted with kafka.OccurredAtLayout, as contracts.md mandates.
+type CategoryEvent struct {
+	ID          uint    `json:"id"`
+	AccountID   string  `json:"account_id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Color       string  `json:"color"`
+	Budget      float64 `json:"budget"`
+	Current     float64 `json:"current"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
+	DeletedAt   string  `json:"deleted_at,omitempty"`
+}
+
+// NewCategoryEvent builds the payload of an event about the category.
+func NewCategoryEvent(category models.Category) CategoryEvent {
+	event := CategoryEvent{
+		ID:          category.ID,
+		AccountID:   category.AccountID,
+		Name:        category.Name,
+		Description: category.Description,
+		Color:       category.Color,
+		Budget:      category.Budget,
+		Current:     category.Current,
+		CreatedAt:   formatTime(category.CreatedAt),
+		UpdatedAt:   formatTime(category.UpdatedAt),
+	}
+	if category.DeletedAt.Valid {
+		event.DeletedAt = formatTime(category.DeletedAt.Time)
+	}
+	return event
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(kafka.OccurredAtLayout)
+}
+
+// EnqueueCategoryEvent writes an event about the category to the outbox, keyed by its account so that
+// the events of an account are published in order. It must be called with the transaction changing
+// the category: the Relay publishes the event, with the category as a CategoryEvent, once the
+// transaction is committed.
+//
+// Parameters:
+//   - tx: the transaction changing the category
+//   - eventType: CategoryCreated, CategoryUpdated or CategoryDeleted
+//   - category: the category after the change
+//
+// Returns:
+//   - error: an error if the event cannot be encoded or written
+//
+// Example usage:
+//
+//	err := database.DB.Transaction(func(tx *gorm.DB) error {
+//		if err := tx.Create(&category).Error; err != nil {
+//			return err
+//		}
+//		return messenger.EnqueueCategoryEvent(tx, messenger.CategoryCreated, category)
+//	})
+func EnqueueCategoryEvent(tx *gorm.DB, eventType string, category models.Category) error {
+	return EnqueueEvent(tx, CategoriesTopic, category.AccountID, kafka.NewEnvelope(eventType, Source, NewCategoryEvent(category)))
+}
+
+// EnqueueEvent writes the envelope to the outbox, to be published to topic with the given key once
+// tx is committed.
+func EnqueueEvent[T any](tx *gorm.DB, topic, key string, envelope kafka.Envelope[T]) error {
+	if err := envelope.Validate(); err != nil {
+		return fmt.Errorf("invalid envelope: %w", err)
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", envelope.Type, err)
+	}
+
+	event := models.OutboxEvent{
+		Topic:   topic,
+		Key:     key,
+		Type:    envelope.Type,
+		EventID: envelope.ID,
+		Payload: string(payload),
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return fmt.Errorf("failed to write %s event to the outbox: %w", envelope.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/models"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultRelayBatchSize = 100
+	defaultRelayInterval  = time.Second
+)
+
+// Producer produces messages to Kafka. *kafka.KafkaMessenger implements it.
+type Producer interface {
+	ProduceMessages(ctx context.Context, records ...kafka.Record) error
+}
+
+// Relay publishes the events of the outbox, oldest first, and marks them sent.
+//
+// Several replicas can run a Relay on the same database: every batch locks the pending events it
+// publishes until it is committed, so a batch is published by a single replica, and the other
+// replicas wait for it instead of publishing newer events before it. An event may still be published
+// twice if a replica stops between publishing it and committing, so consumers drop duplicates by the
+// envelope id.
+type Relay struct {
+	db        *gorm.DB
+	producer  Producer
+	batchSize int
+	interval  time.Duration
+}
+
+// NewRelay creates a Relay publishing the outbox of db through producer.
+//
+// Parameters:
+//   - db: the database holding the outbox
+//   - producer: the producer to publish through
+//
+// Returns:
+//   - *Relay: a new Relay publishing up to 100 events per batch and polling every second
+//
+// Example usage:
+//
+//	relay := messenger.NewRelay(database.DB, producer)
+//	go relay.Run(ctx)
+func NewRelay(db *gorm.DB, producer Producer) *Relay {
+	return &Relay{db: db, producer: producer, batchSize: defaultRelayBatchSize, interval: defaultRelayInterval}
+}
+
+// Run publishes the outbox until ctx is cancelled, polling it once it is empty or a batch fails.
+//
+// Returns:
+//   - error: nil once ctx is cancelled
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		sent, err := r.RelayBatch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Println("Error relaying outbox events: ", err)
+		}
+		if err == nil && sent == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// RelayBatch publishes the oldest pending events of the outbox, in order and in a single write, and
+// marks them sent. If the write fails, every event of the batch is left pending, including the ones
+// that may have been published anyway.
+//
+// Returns:
+//   - int: the number of events published
+//   - error: an error if the outbox cannot be read or updated, or an event cannot be published
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	var sent int
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events []models.OutboxEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("sent_at IS NULL").
+			Order("id").
+			Limit(r.batchSize).
+			Find(&events).Error
+		if err != nil {
+			return fmt.Errorf("failed to read the outbox: %w", err)
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		records := make([]kafka.Record, len(events))
+		ids := make([]uint, len(events))
+		for i, event := range events {
+			records[i] = record(event)
+			ids[i] = event.ID
+		}
+		if err := r.producer.ProduceMessages(ctx, records...); err != nil {
+			return fmt.Errorf("failed to publish %d events: %w", len(events), err)
+		}
+
+		if err := tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).Update("sent_at", time.Now().UTC()).Error; err != nil {
+			return fmt.Errorf("failed to mark events sent: %w", err)
+		}
+		sent = len(ids)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sent, nil
+}
+
+// record builds the message publishing event.
+func record(event models.OutboxEvent) kafka.Record {
+	return kafka.Record{
+		Key:   event.Key,
+		Value: event.Payload,
+		Options: []kafka.ProduceOption{
+			kafka.ToTopic(event.Topic),
+			kafka.WithHeader(kafka.HeaderEventType, event.Type),
+			kafka.WithHeader(kafka.HeaderEventID, event.EventID),
+		},
+	}
+}
+
+// PurgeSent deletes the events sent before the given time, to keep the outbox small.
+//
+// Returns:
+//   - int64: the number of events deleted
+//   - error: an error if the events cannot be deleted
+func (r *Relay) PurgeSent(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("sent_at < ?", before).Delete(&models.OutboxEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge the outbox: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
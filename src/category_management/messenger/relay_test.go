@@ -0,0 +1,206 @@
+//go:build unit
+
+package messenger_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/database"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/messenger"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/category_management/models"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRelay(t *testing.T) {
+	t.Run("should publish the committed events in order and mark them sent", func(t *testing.T) {
+		db := openDB(t)
+		enqueue(t, db, "first", "second", "third")
+		producer := &fakeProducer{}
+
+		sent, err := messenger.NewRelay(db, producer).RelayBatch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != 3 {
+			t.Errorf("expected 3 events sent, got %d", sent)
+		}
+		if names := producer.names(t); len(names) != 3 || names[0] != "first" || names[2] != "third" {
+			t.Errorf("expected [first second third], got %v", names)
+		}
+		if pending := countPending(t, db); pending != 0 {
+			t.Errorf("expected no pending event, got %d", pending)
+		}
+
+		sent, err = messenger.NewRelay(db, producer).RelayBatch(context.Background())
+		if err != nil || sent != 0 {
+			t.Errorf("expected nothing left to send, got %d, %v", sent, err)
+		}
+	})
+
+	t.Run("should not publish the events of a rolled back transaction", func(t *testing.T) {
+		db := openDB(t)
+		db.Transaction(func(tx *gorm.DB) error {
+			category := models.Category{AccountID: "account-1", Name: "rolled back"}
+			if err := tx.Create(&category).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := messenger.EnqueueCategoryEvent(tx, messenger.CategoryCreated, category); err != nil {
+				t.Fatal(err)
+			}
+			return errors.New("rollback")
+		})
+
+		if pending := countPending(t, db); pending != 0 {
+			t.Errorf("expected no pending event, got %d", pending)
+		}
+	})
+
+	t.Run("should publish the category with the field names, time layout and headers of the contracts", func(t *testing.T) {
+		db := openDB(t)
+		enqueue(t, db, "groceries")
+		broker := kafka.NewMemoryBroker(1)
+		producer, err := broker.NewMessenger(messenger.CategoriesTopic, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer producer.Close()
+
+		if _, err := messenger.NewRelay(db, producer).RelayBatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		messages := broker.Messages(messenger.CategoriesTopic)
+		if len(messages) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(messages))
+		}
+		var envelope struct {
+			ID      string         `json:"id"`
+			Payload map[string]any `json:"payload"`
+		}
+		if err := json.Unmarshal(messages[0].Value, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range []string{"id", "account_id", "name", "created_at", "updated_at"} {
+			if _, ok := envelope.Payload[field]; !ok {
+				t.Errorf("expected the payload to have %s, got %v", field, envelope.Payload)
+			}
+		}
+		if _, ok := envelope.Payload["CreatedAt"]; ok {
+			t.Errorf("expected no gorm field names, got %v", envelope.Payload)
+		}
+		createdAt, _ := envelope.Payload["created_at"].(string)
+		if _, err := time.Parse(kafka.OccurredAtLayout, createdAt); err != nil {
+			t.Errorf("expected created_at in the contracts layout, got %q", createdAt)
+		}
+
+		eventType, _ := messages[0].Header(kafka.HeaderEventType)
+		eventID, _ := messages[0].Header(kafka.HeaderEventID)
+		if eventType != messenger.CategoryCreated || eventID != envelope.ID {
+			t.Errorf("expected the type and id of the event as headers, got %q and %q", eventType, eventID)
+		}
+	})
+
+	t.Run("should publish a batch in a single write", func(t *testing.T) {
+		db := openDB(t)
+		enqueue(t, db, "first", "second", "third")
+		producer := &fakeProducer{}
+
+		if _, err := messenger.NewRelay(db, producer).RelayBatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if producer.writes != 1 {
+			t.Errorf("expected 1 write, got %d", producer.writes)
+		}
+	})
+
+	t.Run("should leave the batch pending if it cannot be published", func(t *testing.T) {
+		db := openDB(t)
+		enqueue(t, db, "first", "second", "third")
+		producer := &fakeProducer{fail: true}
+
+		sent, err := messenger.NewRelay(db, producer).RelayBatch(context.Background())
+		if err == nil {
+			t.Error("expected an error")
+		}
+		if sent != 0 {
+			t.Errorf("expected no event sent, got %d", sent)
+		}
+		if pending := countPending(t, db); pending != 3 {
+			t.Errorf("expected 3 pending events, got %d", pending)
+		}
+	})
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db := database.OpenDBConnection(":memory:", sqlite.Open)
+	sqlDB, _ := db.DB()
+	// Every connection to :memory: opens its own database.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	database.MakeMigrations(db)
+	return db
+}
+
+func enqueue(t *testing.T, db *gorm.DB, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			category := models.Category{AccountID: "account-1", Name: name}
+			if err := tx.Create(&category).Error; err != nil {
+				return err
+			}
+			return messenger.EnqueueCategoryEvent(tx, messenger.CategoryCreated, category)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func countPending(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(&models.OutboxEvent{}).Where("sent_at IS NULL").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+type fakeProducer struct {
+	fail    bool
+	writes  int
+	records []kafka.Record
+}
+
+func (p *fakeProducer) ProduceMessages(ctx context.Context, records ...kafka.Record) error {
+	if p.fail {
+		return errors.New("broker unavailable")
+	}
+	p.writes++
+	p.records = append(p.records, records...)
+	return nil
+}
+
+// names returns the names of the categories of the published events.
+func (p *fakeProducer) names(t *testing.T) []string {
+	t.Helper()
+
+	names := make([]string, len(p.records))
+	for i, record := range p.records {
+		var envelope kafka.Envelope[messenger.CategoryEvent]
+		if err := json.Unmarshal([]byte(record.Value), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		names[i] = envelope.Payload.Name
+	}
+	return names
+}
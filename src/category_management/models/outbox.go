@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OutboxEvent is an event waiting to be published, written in the same transaction as the
+// change it describes so that the change and its event are committed or rolled back together.
+type OutboxEvent struct {
+	ID    uint   `gorm:"primarykey"`
+	Topic string `gorm:"size:255;not null"`
+	Key   string `gorm:"size:255"`
+	Type  string `gorm:"size:255;not null"`
+	// EventID is the id of the envelope in Payload, which consumers use to drop duplicates.
+	EventID   string `gorm:"size:64;not null;uniqueIndex"`
+	Payload   string `gorm:"type:text;not null"`
+	CreatedAt time.Time
+	// SentAt is when the event was published, nil while it is pending.
+	SentAt *time.Time `gorm:"index"`
+}
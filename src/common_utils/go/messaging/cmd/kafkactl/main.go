@@ -0,0 +1,223 @@
+// Command kafkactl manages the topics and consumer groups of a Kafka cluster, and dumps and replays
+// the messages of topics.
+//
+// Usage:
+//
+//	kafkactl [flags] list-topics
+//	kafkactl [flags] describe-topic <topic>
+//	kafkactl [flags] create-topics <topics.yaml>
+//	kafkactl [flags] lag <group> [topic]
+//	kafkactl [flags] reset-offsets <group> <topic> <earliest|latest|RFC 3339 time|offset>
+//	kafkactl [flags] dump [-since time] [-until time] [-from-offset n] [-to-offset n] <topic> <file.ndjson>
+//	kafkactl [flags] replay [-topic topic] [-rate n] [-dry-run] [-keep-timestamps] <file.ndjson>
+//
+// dump writes the messages to the file as NDJSON, with their keys and headers; replay publishes
+// such a file again. Use "-" as the file for the standard output or input.
+//
+// The brokers default to the KAFKA_BROKERS environment variable, a comma separated list.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+)
+
+const defaultBrokers = "localhost:9092"
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "kafkactl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("kafkactl", flag.ContinueOnError)
+	brokers := flags.String("brokers", envOr("KAFKA_BROKERS", defaultBrokers), "comma separated list of brokers")
+	useTLS := flags.Bool("tls", false, "connect with TLS")
+	caFile := flags.String("tls-ca", "", "CA certificate file, instead of the system pool; implies -tls")
+	certFile := flags.String("tls-cert", "", "client certificate file, for mutual TLS; implies -tls")
+	keyFile := flags.String("tls-key", "", "client key file")
+	mechanism := flags.String("sasl-mechanism", "", "SASL mechanism: PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512")
+	username := flags.String("sasl-username", os.Getenv("KAFKA_USERNAME"), "SASL username")
+	password := flags.String("sasl-password", os.Getenv("KAFKA_PASSWORD"), "SASL password")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: kafkactl [flags] list-topics | describe-topic <topic> | create-topics <file> | lag <group> [topic] | reset-offsets <group> <topic> <to> | dump <topic> <file> | replay <file>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing command")
+	}
+
+	var opts []kafka.Option
+	if *useTLS || *caFile != "" || *certFile != "" {
+		config, err := kafka.NewTLSConfig(kafka.TLSFiles{CAFile: *caFile, CertFile: *certFile, KeyFile: *keyFile})
+		if err != nil {
+			return err
+		}
+		opts = append(opts, kafka.WithTLS(config))
+	}
+	if *mechanism != "" {
+		opts = append(opts, kafka.WithSASL(kafka.SASLMechanism(*mechanism), *username, *password))
+	}
+	brokerAddresses := strings.Split(*brokers, ",")
+	admin, err := kafka.NewAdmin(brokerAddresses, opts...)
+	if err != nil {
+		return err
+	}
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "list-topics":
+		return listTopics(ctx, admin, out)
+	case "describe-topic":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: describe-topic <topic>")
+		}
+		return describeTopic(ctx, admin, args[0], out)
+	case "create-topics":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: create-topics <file>")
+		}
+		return createTopics(ctx, admin, args[0], out)
+	case "lag":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("usage: lag <group> [topic]")
+		}
+		topic := ""
+		if len(args) == 2 {
+			topic = args[1]
+		}
+		return showLag(ctx, admin, args[0], topic, out)
+	case "reset-offsets":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: reset-offsets <group> <topic> <earliest|latest|RFC 3339 time|offset>")
+		}
+		return resetOffsets(ctx, admin, args[0], args[1], args[2], out)
+	case "dump":
+		return dumpTopic(ctx, brokerAddresses, opts, args, out)
+	case "replay":
+		return replayDump(ctx, brokerAddresses, opts, args, os.Stdin, out)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func listTopics(ctx context.Context, admin *kafka.Admin, out io.Writer) error {
+	topics, err := admin.ListTopics(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITIONS\tREPLICAS")
+	for _, topic := range topics {
+		replicas := 0
+		if len(topic.Partitions) > 0 {
+			replicas = len(topic.Partitions[0].Replicas)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\n", topic.Name, len(topic.Partitions), replicas)
+	}
+	return w.Flush()
+}
+
+func describeTopic(ctx context.Context, admin *kafka.Admin, name string, out io.Writer) error {
+	topic, err := admin.DescribeTopic(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Topic: %s\n", topic.Name)
+	for _, key := range []string{"retention.ms", "cleanup.policy"} {
+		if value, ok := topic.Configs[key]; ok {
+			fmt.Fprintf(out, "%s: %s\n", key, value)
+		}
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PARTITION\tLEADER\tREPLICAS\tISR\tFIRST OFFSET\tLAST OFFSET")
+	for _, partition := range topic.Partitions {
+		fmt.Fprintf(w, "%d\t%d\t%v\t%v\t%d\t%d\n", partition.ID, partition.Leader, partition.Replicas, partition.ISR, partition.FirstOffset, partition.LastOffset)
+	}
+	return w.Flush()
+}
+
+func createTopics(ctx context.Context, admin *kafka.Admin, path string, out io.Writer) error {
+	specs, err := readTopicsFile(path)
+	if err != nil {
+		return err
+	}
+
+	created, err := admin.CreateTopics(ctx, specs...)
+	for _, name := range created {
+		fmt.Fprintf(out, "created %s\n", name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(created) < len(specs) {
+		fmt.Fprintf(out, "%d topics already existed\n", len(specs)-len(created))
+	}
+	return nil
+}
+
+func showLag(ctx context.Context, admin *kafka.Admin, group, topic string, out io.Writer) error {
+	lags, err := admin.ConsumerGroupLag(ctx, group, topic)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITION\tCOMMITTED\tLAST\tLAG")
+	var total int64
+	for _, lag := range lags {
+		committed := fmt.Sprint(lag.CommittedOffset)
+		if lag.CommittedOffset < 0 {
+			committed = "-"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\n", lag.Topic, lag.Partition, committed, lag.LastOffset, lag.Lag)
+		total += lag.Lag
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t\t%d\n", total)
+	return w.Flush()
+}
+
+func resetOffsets(ctx context.Context, admin *kafka.Admin, group, topic, to string, out io.Writer) error {
+	reset, err := parseOffsetReset(to)
+	if err != nil {
+		return err
+	}
+
+	offsets, err := admin.ResetOffsets(ctx, group, topic, reset)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITION\tOFFSET")
+	for _, offset := range offsets {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", offset.Topic, offset.Partition, offset.Offset)
+	}
+	return w.Flush()
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
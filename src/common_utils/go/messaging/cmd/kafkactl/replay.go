@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+)
+
+// dumpTopic runs "dump [flags] <topic> <file>", writing to out if file is "-".
+func dumpTopic(ctx context.Context, brokers []string, opts []kafka.Option, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	since := flags.String("since", "", "dump the messages produced from this RFC 3339 time")
+	until := flags.String("until", "", "dump the messages produced before this RFC 3339 time")
+	fromOffset := flags.Int64("from-offset", 0, "dump the offsets of every partition from this one")
+	toOffset := flags.Int64("to-offset", 0, "dump the offsets of every partition before this one")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: dump [-since time] [-until time] [-from-offset n] [-to-offset n] <topic> <file>")
+	}
+	r, err := parseDumpRange(*since, *until, *fromOffset, *toOffset)
+	if err != nil {
+		return err
+	}
+
+	dumper, err := kafka.NewDumper(brokers, opts...)
+	if err != nil {
+		return err
+	}
+	topic, path := flags.Arg(0), flags.Arg(1)
+	if path == "-" {
+		_, err := dumper.Dump(ctx, topic, out, r)
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	count, err := dumper.Dump(ctx, topic, file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "dumped %d messages of %s to %s\n", count, topic, path)
+	return nil
+}
+
+func parseDumpRange(since, until string, fromOffset, toOffset int64) (kafka.DumpRange, error) {
+	r := kafka.DumpRange{FromOffset: fromOffset, ToOffset: toOffset}
+	if fromOffset < 0 || toOffset < 0 {
+		return r, fmt.Errorf("offsets cannot be negative")
+	}
+	var err error
+	if since != "" {
+		if r.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return r, fmt.Errorf("invalid -since: %w", err)
+		}
+	}
+	if until != "" {
+		if r.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return r, fmt.Errorf("invalid -until: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// replayDump runs "replay [flags] <file>", reading from in if file is "-".
+func replayDump(ctx context.Context, brokers []string, opts []kafka.Option, args []string, in io.Reader, out io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	topic := flags.String("topic", "", "replay into this topic instead of the one the messages were dumped from")
+	rate := flags.Int("rate", 0, "maximum number of messages replayed per second; 0 for no limit")
+	dryRun := flags.Bool("dry-run", false, "check the dump without publishing anything")
+	keepTimestamps := flags.Bool("keep-timestamps", false, "publish the messages with their original timestamps")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: replay [-topic topic] [-rate n] [-dry-run] [-keep-timestamps] <file>")
+	}
+
+	replayOpts := []kafka.ReplayOption{kafka.ReplayRate(*rate)}
+	if *topic != "" {
+		replayOpts = append(replayOpts, kafka.ReplayTo(*topic))
+	}
+	if *keepTimestamps {
+		replayOpts = append(replayOpts, kafka.ReplayTimestamps())
+	}
+	var publisher kafka.Publisher
+	if *dryRun {
+		replayOpts = append(replayOpts, kafka.ReplayDryRun())
+	} else {
+		producer, err := kafka.NewProducer(brokers, opts...)
+		if err != nil {
+			return err
+		}
+		defer producer.Close()
+		publisher = producer
+	}
+
+	path := flags.Arg(0)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	count, err := kafka.Replay(ctx, in, publisher, replayOpts...)
+	if *dryRun {
+		fmt.Fprintf(out, "would replay %d messages\n", count)
+	} else {
+		fmt.Fprintf(out, "replayed %d messages\n", count)
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+//go:build unit
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDumpRange(t *testing.T) {
+	r, err := parseDumpRange("2024-05-01T12:00:00Z", "2024-05-02T12:00:00Z", 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Since.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) || !r.Until.Equal(time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time range %v - %v", r.Since, r.Until)
+	}
+	if r.FromOffset != 10 || r.ToOffset != 20 {
+		t.Errorf("unexpected offset range %d - %d", r.FromOffset, r.ToOffset)
+	}
+
+	for _, invalid := range [][2]string{{"yesterday", ""}, {"", "2024-05-02"}} {
+		if _, err := parseDumpRange(invalid[0], invalid[1], 0, 0); err == nil {
+			t.Errorf("expected an error for %v", invalid)
+		}
+	}
+	if _, err := parseDumpRange("", "", -1, 0); err == nil {
+		t.Error("expected an error for a negative offset")
+	}
+}
+
+func TestReplayDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transactions.ndjson")
+	dump := `{"topic":"transactions","partition":0,"offset":0,"time":"2024-05-01T12:00:00Z","key":"1","value":"first"}
+{"topic":"transactions","partition":0,"offset":1,"time":"2024-05-01T12:01:00Z","key":"1","value":"second"}
+`
+	if err := os.WriteFile(path, []byte(dump), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := replayDump(context.Background(), []string{"localhost:1"}, nil, []string{"-dry-run", path}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != "would replay 2 messages" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+	"gopkg.in/yaml.v3"
+)
+
+// topicsFile is the declarative description of the topics of a cluster, e.g.:
+//
+//	topics:
+//	  - name: transactions
+//	    partitions: 6
+//	    replication_factor: 3
+//	    retention: 168h
+//	    cleanup_policy: delete
+type topicsFile struct {
+	Topics []topicEntry `yaml:"topics"`
+}
+
+type topicEntry struct {
+	Name              string `yaml:"name"`
+	Partitions        int    `yaml:"partitions"`
+	ReplicationFactor int    `yaml:"replication_factor"`
+	// Retention is a Go duration such as "168h", or "forever".
+	Retention     string `yaml:"retention"`
+	CleanupPolicy string `yaml:"cleanup_policy"`
+}
+
+// readTopicsFile reads the topics described in the YAML file at path.
+func readTopicsFile(path string) ([]kafka.TopicSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseTopics(data)
+}
+
+func parseTopics(data []byte) ([]kafka.TopicSpec, error) {
+	var file topicsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid topics file: %w", err)
+	}
+
+	specs := make([]kafka.TopicSpec, len(file.Topics))
+	for i, entry := range file.Topics {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("topic %d has no name", i+1)
+		}
+		spec := kafka.TopicSpec{
+			Name:              entry.Name,
+			Partitions:        entry.Partitions,
+			ReplicationFactor: entry.ReplicationFactor,
+			CleanupPolicy:     entry.CleanupPolicy,
+		}
+		switch entry.Retention {
+		case "":
+		case "forever":
+			spec.Retention = -1
+		default:
+			retention, err := time.ParseDuration(entry.Retention)
+			if err != nil || retention <= 0 {
+				return nil, fmt.Errorf("topic %s: invalid retention %q", entry.Name, entry.Retention)
+			}
+			spec.Retention = retention
+		}
+		switch entry.CleanupPolicy {
+		case "", "delete", "compact", "compact,delete", "delete,compact":
+		default:
+			return nil, fmt.Errorf("topic %s: invalid cleanup policy %q", entry.Name, entry.CleanupPolicy)
+		}
+		specs[i] = spec
+	}
+	return specs, nil
+}
+
+// parseOffsetReset parses the target of reset-offsets: "earliest", "latest", an RFC 3339 time or an offset.
+func parseOffsetReset(value string) (kafka.OffsetReset, error) {
+	switch value {
+	case "earliest":
+		return kafka.ResetToEarliest(), nil
+	case "latest":
+		return kafka.ResetToLatest(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return kafka.ResetToTime(t), nil
+	}
+	var offset int64
+	if _, err := fmt.Sscanf(value, "%d", &offset); err == nil && fmt.Sprint(offset) == value && offset >= 0 {
+		return kafka.ResetToOffset(offset), nil
+	}
+	return kafka.OffsetReset{}, fmt.Errorf("invalid reset target %q: expected earliest, latest, an RFC 3339 time or an offset", value)
+}
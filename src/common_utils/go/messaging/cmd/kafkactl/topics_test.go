@@ -0,0 +1,79 @@
+//go:build unit
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+)
+
+func TestParseTopics(t *testing.T) {
+	t.Run("should read the example topics file", func(t *testing.T) {
+		specs, err := readTopicsFile("topics.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []kafka.TopicSpec{
+			{Name: "transactions", Partitions: 6, ReplicationFactor: 1, Retention: 168 * time.Hour, CleanupPolicy: "delete"},
+			{Name: "categories", Partitions: 3, ReplicationFactor: 1, CleanupPolicy: "compact"},
+		}
+		if len(specs) != len(expected) {
+			t.Fatalf("expected %d topics, got %d", len(expected), len(specs))
+		}
+		for i := range expected {
+			if specs[i] != expected[i] {
+				t.Errorf("expected %+v, got %+v", expected[i], specs[i])
+			}
+		}
+	})
+
+	t.Run("should keep messages forever", func(t *testing.T) {
+		specs, err := parseTopics([]byte("topics:\n  - name: audit\n    retention: forever\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if specs[0].Retention >= 0 {
+			t.Errorf("expected a negative retention, got %v", specs[0].Retention)
+		}
+	})
+
+	t.Run("should reject invalid topics", func(t *testing.T) {
+		for _, data := range []string{
+			"topics:\n  - partitions: 3\n",
+			"topics:\n  - name: audit\n    retention: a week\n",
+			"topics:\n  - name: audit\n    cleanup_policy: archive\n",
+			"topics: [",
+		} {
+			if _, err := parseTopics([]byte(data)); err == nil {
+				t.Errorf("expected an error for %q", data)
+			}
+		}
+	})
+}
+
+func TestParseOffsetReset(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for value, expected := range map[string]kafka.OffsetReset{
+		"earliest":             kafka.ResetToEarliest(),
+		"latest":               kafka.ResetToLatest(),
+		"2024-05-01T12:00:00Z": kafka.ResetToTime(at),
+		"42":                   kafka.ResetToOffset(42),
+	} {
+		reset, err := parseOffsetReset(value)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", value, err)
+			continue
+		}
+		if reset.String() != expected.String() {
+			t.Errorf("expected %s for %q, got %s", expected, value, reset)
+		}
+	}
+
+	for _, value := range []string{"", "-1", "4x", "yesterday"} {
+		if _, err := parseOffsetReset(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Package gormstore implements kafka.ProcessedStore on top of a SQL table managed with GORM, so that
+// the events processed by a consumer are remembered across restarts and shared between its replicas.
+// It is a module of its own, so that only the services using it depend on GORM.
+package gormstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProcessedEvent is a row of the processed_events table.
+type ProcessedEvent struct {
+	// Scope separates the events of the consumers sharing the table, usually their consumer group.
+	Scope       string    `gorm:"primaryKey;size:255"`
+	EventID     string    `gorm:"primaryKey;size:64"`
+	ProcessedAt time.Time `gorm:"not null;index"`
+}
+
+// Store is a kafka.ProcessedStore keeping the processed events in the processed_events table.
+// The events older than its TTL are considered unprocessed, and deleted by Cleanup.
+type Store struct {
+	db    *gorm.DB
+	scope string
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+var _ kafka.ProcessedStore = (*Store)(nil)
+
+// New creates a Store, creating or migrating the processed_events table.
+//
+// Parameters:
+//   - db: the database holding the table
+//   - scope: the name separating the events of this consumer from the others, usually its consumer group
+//   - ttl: how long an event is remembered, 0 to remember it until it is deleted
+//
+// Returns:
+//   - *Store: a new Store
+//   - error: an error if the scope is empty or the table cannot be migrated
+//
+// Example usage:
+//
+//	processed, err := gormstore.New(db, "account_management", 7*24*time.Hour)
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	go processed.RunCleanup(ctx, time.Hour)
+//	err = messenger.Consume(ctx, kafka.Idempotent(processed, applyBalanceUpdate))
+func New(db *gorm.DB, scope string, ttl time.Duration) (*Store, error) {
+	if scope == "" {
+		return nil, fmt.Errorf("scope is empty")
+	}
+	if err := db.AutoMigrate(&ProcessedEvent{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate processed events: %w", err)
+	}
+	return &Store{db: db, scope: scope, ttl: ttl, now: time.Now}, nil
+}
+
+// Processed implements kafka.ProcessedStore.
+func (s *Store) Processed(ctx context.Context, eventID string) (bool, error) {
+	var count int64
+	err := s.live(s.db.WithContext(ctx).Model(&ProcessedEvent{})).
+		Where("scope = ? AND event_id = ?", s.scope, eventID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// MarkProcessed implements kafka.ProcessedStore.
+func (s *Store) MarkProcessed(ctx context.Context, eventID string) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "event_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"processed_at"}),
+	}).Create(s.event(eventID)).Error
+}
+
+// Claim records the event in tx, the transaction of the handler processing it, and reports whether
+// it was not processed yet. When it returns false, the handler must not apply the event again. Since
+// the event is recorded with the handler's changes, a crash cannot leave one without the other.
+//
+// Parameters:
+//   - tx: the transaction of the handler
+//   - eventID: the id of the event, see kafka.EventID
+//
+// Returns:
+//   - bool: true if the event was not processed yet
+//   - error: an error if the event cannot be recorded
+//
+// Example usage:
+//
+//	err := db.Transaction(func(tx *gorm.DB) error {
+//		eventID, _ := kafka.EventID(ctx)
+//		if claimed, err := processed.Claim(tx, eventID); err != nil || !claimed {
+//			return err
+//		}
+//		return applyBalanceUpdate(tx, event)
+//	})
+func (s *Store) Claim(tx *gorm.DB, eventID string) (bool, error) {
+	// An expired record does not count, like in Processed, but it is still in the way of the insert.
+	if err := s.expired(tx.Where("scope = ? AND event_id = ?", s.scope, eventID)).Delete(&ProcessedEvent{}).Error; err != nil {
+		return false, err
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(s.event(eventID))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Cleanup deletes the events older than the TTL of the store.
+//
+// Returns:
+//   - int64: the number of events deleted
+//   - error: an error if the events cannot be deleted
+func (s *Store) Cleanup(ctx context.Context) (int64, error) {
+	if s.ttl <= 0 {
+		return 0, nil
+	}
+	result := s.expired(s.db.WithContext(ctx).Where("scope = ?", s.scope)).Delete(&ProcessedEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// RunCleanup calls Cleanup every interval until ctx is cancelled. Cleanup errors are retried at the
+// next interval.
+func (s *Store) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Cleanup(ctx)
+		}
+	}
+}
+
+func (s *Store) event(eventID string) *ProcessedEvent {
+	return &ProcessedEvent{Scope: s.scope, EventID: eventID, ProcessedAt: s.now().UTC()}
+}
+
+// live restricts db to the events within the TTL.
+func (s *Store) live(db *gorm.DB) *gorm.DB {
+	if s.ttl <= 0 {
+		return db
+	}
+	return db.Where("processed_at > ?", s.now().UTC().Add(-s.ttl))
+}
+
+// expired restricts db to the events older than the TTL.
+func (s *Store) expired(db *gorm.DB) *gorm.DB {
+	if s.ttl <= 0 {
+		return db.Where("1 = 0")
+	}
+	return db.Where("processed_at <= ?", s.now().UTC().Add(-s.ttl))
+}
@@ -0,0 +1,128 @@
+package gormstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should remember the processed events of its scope", func(t *testing.T) {
+		db := openDB(t)
+		store := newStore(t, db, "account_management", 0)
+		other := newStore(t, db, "budget_alerts", 0)
+
+		if err := store.MarkProcessed(ctx, "event-1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.MarkProcessed(ctx, "event-1"); err != nil {
+			t.Fatalf("expected marking an event twice to succeed, got %v", err)
+		}
+		if processed, err := store.Processed(ctx, "event-1"); err != nil || !processed {
+			t.Errorf("expected event-1 to be processed, got %t, %v", processed, err)
+		}
+		if processed, _ := store.Processed(ctx, "event-2"); processed {
+			t.Error("expected event-2 not to be processed")
+		}
+		if processed, _ := other.Processed(ctx, "event-1"); processed {
+			t.Error("expected event-1 not to be processed in another scope")
+		}
+	})
+
+	t.Run("should claim an event once within a transaction", func(t *testing.T) {
+		db := openDB(t)
+		store := newStore(t, db, "account_management", 0)
+
+		claim := func() bool {
+			var claimed bool
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				claimed, err = store.Claim(tx, "event-1")
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return claimed
+		}
+		if !claim() {
+			t.Error("expected the first claim to succeed")
+		}
+		if claim() {
+			t.Error("expected the second claim to fail")
+		}
+
+		db.Transaction(func(tx *gorm.DB) error {
+			if claimed, err := store.Claim(tx, "event-2"); err != nil || !claimed {
+				t.Errorf("expected event-2 to be claimed, got %t, %v", claimed, err)
+			}
+			return gorm.ErrInvalidTransaction
+		})
+		if processed, _ := store.Processed(ctx, "event-2"); processed {
+			t.Error("expected the claim of a rolled back transaction to be discarded")
+		}
+	})
+
+	t.Run("should forget and clean up the events older than its ttl", func(t *testing.T) {
+		db := openDB(t)
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		store := newStore(t, db, "account_management", time.Hour)
+		store.now = func() time.Time { return now }
+
+		store.MarkProcessed(ctx, "event-1")
+		now = now.Add(30 * time.Minute)
+		store.MarkProcessed(ctx, "event-2")
+		now = now.Add(30 * time.Minute)
+
+		if processed, _ := store.Processed(ctx, "event-1"); processed {
+			t.Error("expected event-1 to have expired")
+		}
+		if processed, _ := store.Processed(ctx, "event-2"); !processed {
+			t.Error("expected event-2 to be remembered")
+		}
+		deleted, err := store.Cleanup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != 1 {
+			t.Errorf("expected 1 event deleted, got %d", deleted)
+		}
+
+		if claimed, err := store.Claim(db, "event-1"); err != nil || !claimed {
+			t.Errorf("expected an expired event to be claimed again, got %t, %v", claimed, err)
+		}
+	})
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens its own database.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func newStore(t *testing.T, db *gorm.DB, scope string, ttl time.Duration) *Store {
+	t.Helper()
+
+	store, err := New(db, scope, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
@@ -0,0 +1,505 @@
+package kafka
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const adminTimeout = 10 * time.Second
+
+// Topic configuration keys set by TopicSpec.
+const (
+	configRetention     = "retention.ms"
+	configCleanupPolicy = "cleanup.policy"
+)
+
+// Admin manages the topics and consumer groups of a Kafka cluster.
+type Admin struct {
+	client adminClient
+}
+
+// adminClient is the subset of *kafka.Client used by Admin.
+type adminClient interface {
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	CreateTopics(ctx context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error)
+	DescribeConfigs(ctx context.Context, req *kafka.DescribeConfigsRequest) (*kafka.DescribeConfigsResponse, error)
+	ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error)
+	DescribeGroups(ctx context.Context, req *kafka.DescribeGroupsRequest) (*kafka.DescribeGroupsResponse, error)
+	OffsetFetch(ctx context.Context, req *kafka.OffsetFetchRequest) (*kafka.OffsetFetchResponse, error)
+	OffsetCommit(ctx context.Context, req *kafka.OffsetCommitRequest) (*kafka.OffsetCommitResponse, error)
+}
+
+// TopicSpec describes a topic to create.
+type TopicSpec struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	// Retention is how long messages are kept. Zero keeps the broker's default; a negative value keeps them forever.
+	Retention time.Duration
+	// CleanupPolicy is "delete", "compact" or "compact,delete". Empty keeps the broker's default.
+	CleanupPolicy string
+}
+
+// TopicInfo describes an existing topic.
+type TopicInfo struct {
+	Name       string
+	Internal   bool
+	Partitions []PartitionInfo
+	// Configs holds the retention and cleanup policy of the topic. It is only filled in by DescribeTopic.
+	Configs map[string]string
+}
+
+// PartitionInfo describes a partition of a topic. Offsets are only filled in by DescribeTopic.
+type PartitionInfo struct {
+	ID          int
+	Leader      int
+	Replicas    []int
+	ISR         []int
+	FirstOffset int64
+	LastOffset  int64
+}
+
+// PartitionLag is how far a consumer group is behind on a partition.
+type PartitionLag struct {
+	Topic     string
+	Partition int
+	// CommittedOffset is the next offset the group will read, -1 if it never committed on the partition.
+	CommittedOffset int64
+	LastOffset      int64
+	Lag             int64
+}
+
+// PartitionOffset is an offset of a topic partition.
+type PartitionOffset struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// OffsetReset is where ResetOffsets moves a consumer group to.
+type OffsetReset struct {
+	to     offsetResetKind
+	time   time.Time
+	offset int64
+}
+
+type offsetResetKind int
+
+const (
+	resetToEarliest offsetResetKind = iota
+	resetToLatest
+	resetToTime
+	resetToOffset
+)
+
+// ResetToEarliest moves a group to the oldest retained message of every partition.
+func ResetToEarliest() OffsetReset { return OffsetReset{to: resetToEarliest} }
+
+// ResetToLatest moves a group past the last message of every partition.
+func ResetToLatest() OffsetReset { return OffsetReset{to: resetToLatest} }
+
+// ResetToTime moves a group to the first message produced at or after t in every partition,
+// or past the last message of the partitions without any.
+func ResetToTime(t time.Time) OffsetReset { return OffsetReset{to: resetToTime, time: t} }
+
+// ResetToOffset moves a group to the given offset of every partition, clamped to the retained messages.
+func ResetToOffset(offset int64) OffsetReset { return OffsetReset{to: resetToOffset, offset: offset} }
+
+func (r OffsetReset) String() string {
+	switch r.to {
+	case resetToEarliest:
+		return "earliest"
+	case resetToLatest:
+		return "latest"
+	case resetToTime:
+		return r.time.UTC().Format(time.RFC3339)
+	default:
+		return strconv.FormatInt(r.offset, 10)
+	}
+}
+
+// NewAdmin creates an Admin for the cluster of the given brokers.
+//
+// Parameters:
+//   - brokerAddresses: the addresses of the Kafka brokers to connect to
+//   - opts: optional settings; only WithTLS and WithSASL apply
+//
+// Returns:
+//   - *Admin: a new Admin
+//   - error: an error if the broker address is empty or the TLS or SASL settings are invalid
+//
+// Example usage:
+//
+//	admin, err := NewAdmin(brokers, WithSASL(SASLScramSHA512, user, password))
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	lag, err := admin.ConsumerGroupLag(ctx, "account_management", "transactions")
+func NewAdmin(brokerAddresses []string, opts ...Option) (*Admin, error) {
+	if len(brokerAddresses) == 0 {
+		return nil, fmt.Errorf("broker address is empty")
+	}
+
+	conn, err := newConnection(newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return newAdmin(brokerAddresses, conn), nil
+}
+
+func newAdmin(brokerAddresses []string, conn connection) *Admin {
+	client := &kafka.Client{Addr: kafka.TCP(brokerAddresses...), Timeout: adminTimeout}
+	if conn.transport != nil {
+		client.Transport = conn.transport
+	}
+	return &Admin{client: client}
+}
+
+// ListTopics lists the topics of the cluster, except internal ones, sorted by name, with their partitions.
+func (a *Admin) ListTopics(ctx context.Context) ([]TopicInfo, error) {
+	metadata, err := a.client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	topics := make([]TopicInfo, 0, len(metadata.Topics))
+	for _, topic := range metadata.Topics {
+		if topic.Error != nil {
+			return nil, fmt.Errorf("failed to read topic %s: %w", topic.Name, topic.Error)
+		}
+		if !topic.Internal {
+			topics = append(topics, newTopicInfo(topic))
+		}
+	}
+	slices.SortFunc(topics, func(a, b TopicInfo) int { return cmp.Compare(a.Name, b.Name) })
+	return topics, nil
+}
+
+// DescribeTopic describes a topic with the offsets of its partitions, its retention and its cleanup policy.
+func (a *Admin) DescribeTopic(ctx context.Context, name string) (TopicInfo, error) {
+	metadata, err := a.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{name}})
+	if err != nil {
+		return TopicInfo{}, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if len(metadata.Topics) != 1 {
+		return TopicInfo{}, fmt.Errorf("topic %s: %w", name, kafka.UnknownTopicOrPartition)
+	}
+	if err := metadata.Topics[0].Error; err != nil {
+		return TopicInfo{}, fmt.Errorf("topic %s: %w", name, err)
+	}
+	info := newTopicInfo(metadata.Topics[0])
+
+	first, err := a.listOffsets(ctx, name, info.partitionIDs(), kafka.FirstOffsetOf)
+	if err != nil {
+		return TopicInfo{}, err
+	}
+	last, err := a.listOffsets(ctx, name, info.partitionIDs(), kafka.LastOffsetOf)
+	if err != nil {
+		return TopicInfo{}, err
+	}
+	for i := range info.Partitions {
+		info.Partitions[i].FirstOffset = first[info.Partitions[i].ID].FirstOffset
+		info.Partitions[i].LastOffset = last[info.Partitions[i].ID].LastOffset
+	}
+
+	configs, err := a.client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: name,
+			ConfigNames:  []string{configRetention, configCleanupPolicy},
+		}},
+	})
+	if err != nil {
+		return TopicInfo{}, fmt.Errorf("failed to describe the configuration of %s: %w", name, err)
+	}
+	info.Configs = make(map[string]string)
+	for _, resource := range configs.Resources {
+		if resource.Error != nil {
+			return TopicInfo{}, fmt.Errorf("failed to describe the configuration of %s: %w", name, resource.Error)
+		}
+		for _, entry := range resource.ConfigEntries {
+			info.Configs[entry.ConfigName] = entry.ConfigValue
+		}
+	}
+	return info, nil
+}
+
+// CreateTopics creates the topics that do not exist yet. Existing topics are left unchanged, so
+// the same specs can be applied repeatedly.
+//
+// Returns:
+//   - []string: the names of the topics that were created
+//   - error: an error for each topic that could not be created
+func (a *Admin) CreateTopics(ctx context.Context, specs ...TopicSpec) ([]string, error) {
+	configs := make([]kafka.TopicConfig, len(specs))
+	for i, spec := range specs {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("topic %d has no name", i)
+		}
+		configs[i] = kafka.TopicConfig{
+			Topic:             spec.Name,
+			NumPartitions:     cmp.Or(spec.Partitions, defaultNumPartitions),
+			ReplicationFactor: cmp.Or(spec.ReplicationFactor, defaultReplicationFactor),
+		}
+		if spec.Retention != 0 {
+			retention := int64(-1)
+			if spec.Retention > 0 {
+				retention = spec.Retention.Milliseconds()
+			}
+			configs[i].ConfigEntries = append(configs[i].ConfigEntries, kafka.ConfigEntry{ConfigName: configRetention, ConfigValue: strconv.FormatInt(retention, 10)})
+		}
+		if spec.CleanupPolicy != "" {
+			configs[i].ConfigEntries = append(configs[i].ConfigEntries, kafka.ConfigEntry{ConfigName: configCleanupPolicy, ConfigValue: spec.CleanupPolicy})
+		}
+	}
+
+	response, err := a.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: configs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create topics: %w", err)
+	}
+
+	var created []string
+	var errs []error
+	for _, spec := range specs {
+		switch err := response.Errors[spec.Name]; {
+		case err == nil:
+			created = append(created, spec.Name)
+		case errors.Is(err, kafka.TopicAlreadyExists):
+		default:
+			errs = append(errs, fmt.Errorf("failed to create topic %s: %w", spec.Name, err))
+		}
+	}
+	return created, errors.Join(errs...)
+}
+
+// ConsumerGroupLag reports how far a consumer group is behind on every partition of a topic, or
+// of every topic it committed offsets on if topic is empty.
+//
+// Parameters:
+//   - ctx: the context bounding the requests
+//   - groupID: the consumer group
+//   - topic: the topic to report, or "" for every topic of the group
+//
+// Returns:
+//   - []PartitionLag: the lag of each partition, sorted by topic and partition
+//   - error: an error if the offsets cannot be read
+func (a *Admin) ConsumerGroupLag(ctx context.Context, groupID, topic string) ([]PartitionLag, error) {
+	request := &kafka.MetadataRequest{}
+	if topic != "" {
+		request.Topics = []string{topic}
+	}
+	metadata, err := a.client.Metadata(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	partitions := make(map[string][]int)
+	for _, t := range metadata.Topics {
+		if t.Error != nil {
+			return nil, fmt.Errorf("failed to read topic %s: %w", t.Name, t.Error)
+		}
+		if !t.Internal {
+			partitions[t.Name] = newTopicInfo(t).partitionIDs()
+		}
+	}
+
+	committed, err := a.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: groupID, Topics: partitions})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the offsets of %s: %w", groupID, err)
+	}
+	if committed.Error != nil {
+		return nil, fmt.Errorf("failed to read the offsets of %s: %w", groupID, committed.Error)
+	}
+
+	var lags []PartitionLag
+	for name, offsets := range committed.Topics {
+		ids := make([]int, len(offsets))
+		consumed := false
+		for i, offset := range offsets {
+			if offset.Error != nil {
+				return nil, fmt.Errorf("failed to read the offset of %s partition %d: %w", name, offset.Partition, offset.Error)
+			}
+			ids[i] = offset.Partition
+			consumed = consumed || offset.CommittedOffset >= 0
+		}
+		// Without a topic, only the topics the group committed offsets on are reported.
+		if len(ids) == 0 || (topic == "" && !consumed) {
+			continue
+		}
+
+		first, err := a.listOffsets(ctx, name, ids, kafka.FirstOffsetOf)
+		if err != nil {
+			return nil, err
+		}
+		last, err := a.listOffsets(ctx, name, ids, kafka.LastOffsetOf)
+		if err != nil {
+			return nil, err
+		}
+		for _, offset := range offsets {
+			end := last[offset.Partition]
+			lag := PartitionLag{Topic: name, Partition: offset.Partition, CommittedOffset: offset.CommittedOffset, LastOffset: end.LastOffset}
+			if offset.CommittedOffset >= 0 {
+				lag.Lag = max(end.LastOffset-offset.CommittedOffset, 0)
+			} else {
+				lag.Lag = end.LastOffset - first[offset.Partition].FirstOffset
+			}
+			lags = append(lags, lag)
+		}
+	}
+
+	slices.SortFunc(lags, func(a, b PartitionLag) int {
+		return cmp.Or(cmp.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+	})
+	return lags, nil
+}
+
+// ResetOffsets commits new offsets for every partition of a topic on behalf of a consumer group.
+// Kafka only accepts it while the group has no active member, so its consumers must be stopped first.
+//
+// Parameters:
+//   - ctx: the context bounding the requests
+//   - groupID: the consumer group
+//   - topic: the topic whose offsets are reset
+//   - reset: where to move the group, e.g. ResetToEarliest() or ResetToTime(t)
+//
+// Returns:
+//   - []PartitionOffset: the offsets committed, sorted by partition
+//   - error: an error if the group is active or the offsets cannot be read or committed
+//
+// Example usage:
+//
+//	offsets, err := admin.ResetOffsets(ctx, "account_management", "transactions", ResetToTime(yesterday))
+func (a *Admin) ResetOffsets(ctx context.Context, groupID, topic string, reset OffsetReset) ([]PartitionOffset, error) {
+	groups, err := a.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{groupID}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe group %s: %w", groupID, err)
+	}
+	for _, group := range groups.Groups {
+		if group.Error != nil {
+			return nil, fmt.Errorf("failed to describe group %s: %w", groupID, group.Error)
+		}
+		if len(group.Members) > 0 {
+			return nil, fmt.Errorf("group %s has %d active members, stop its consumers first", groupID, len(group.Members))
+		}
+	}
+
+	info, err := a.DescribeTopic(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	ids := info.partitionIDs()
+
+	var byTime map[int]kafka.PartitionOffsets
+	if reset.to == resetToTime {
+		byTime, err = a.listOffsets(ctx, topic, ids, func(partition int) kafka.OffsetRequest {
+			return kafka.TimeOffsetOf(partition, reset.time)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	offsets := make([]PartitionOffset, len(info.Partitions))
+	commits := make([]kafka.OffsetCommit, len(info.Partitions))
+	for i, partition := range info.Partitions {
+		offsets[i] = PartitionOffset{Topic: topic, Partition: partition.ID, Offset: reset.resolve(partition, byTime[partition.ID])}
+		commits[i] = kafka.OffsetCommit{Partition: partition.ID, Offset: offsets[i].Offset}
+	}
+
+	response, err := a.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      groupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit the offsets of %s: %w", groupID, err)
+	}
+	for _, partitions := range response.Topics {
+		for _, partition := range partitions {
+			if partition.Error != nil {
+				return nil, fmt.Errorf("failed to commit the offset of %s partition %d: %w", topic, partition.Partition, partition.Error)
+			}
+		}
+	}
+
+	slices.SortFunc(offsets, func(a, b PartitionOffset) int { return cmp.Compare(a.Partition, b.Partition) })
+	return offsets, nil
+}
+
+// resolve returns the offset the reset moves the partition to. byTime holds the answer of the
+// broker to a time lookup, for ResetToTime.
+func (r OffsetReset) resolve(partition PartitionInfo, byTime kafka.PartitionOffsets) int64 {
+	switch r.to {
+	case resetToEarliest:
+		return partition.FirstOffset
+	case resetToLatest:
+		return partition.LastOffset
+	case resetToTime:
+		for offset := range byTime.Offsets {
+			if offset >= 0 {
+				return offset
+			}
+		}
+		return partition.LastOffset
+	default:
+		return min(max(r.offset, partition.FirstOffset), partition.LastOffset)
+	}
+}
+
+// listOffsets looks up offsets of the given partitions, indexed by partition.
+func (a *Admin) listOffsets(ctx context.Context, topic string, partitions []int, request func(partition int) kafka.OffsetRequest) (map[int]kafka.PartitionOffsets, error) {
+	requests := make([]kafka.OffsetRequest, len(partitions))
+	for i, partition := range partitions {
+		requests[i] = request(partition)
+	}
+
+	response, err := a.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the offsets of %s: %w", topic, err)
+	}
+	offsets := make(map[int]kafka.PartitionOffsets)
+	for _, partition := range response.Topics[topic] {
+		if partition.Error != nil {
+			return nil, fmt.Errorf("failed to list the offsets of %s partition %d: %w", topic, partition.Partition, partition.Error)
+		}
+		offsets[partition.Partition] = partition
+	}
+	return offsets, nil
+}
+
+func newTopicInfo(topic kafka.Topic) TopicInfo {
+	info := TopicInfo{Name: topic.Name, Internal: topic.Internal, Partitions: make([]PartitionInfo, len(topic.Partitions))}
+	for i, partition := range topic.Partitions {
+		info.Partitions[i] = PartitionInfo{
+			ID:       partition.ID,
+			Leader:   partition.Leader.ID,
+			Replicas: brokerIDs(partition.Replicas),
+			ISR:      brokerIDs(partition.Isr),
+		}
+	}
+	slices.SortFunc(info.Partitions, func(a, b PartitionInfo) int { return cmp.Compare(a.ID, b.ID) })
+	return info
+}
+
+func (t TopicInfo) partitionIDs() []int {
+	ids := make([]int, len(t.Partitions))
+	for i, partition := range t.Partitions {
+		ids[i] = partition.ID
+	}
+	return ids
+}
+
+func brokerIDs(brokers []kafka.Broker) []int {
+	ids := make([]int, len(brokers))
+	for i, broker := range brokers {
+		ids[i] = broker.ID
+	}
+	return ids
+}
@@ -0,0 +1,235 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestAdmin(t *testing.T) {
+	t.Run("should list topics sorted by name", func(t *testing.T) {
+		admin := &Admin{client: newFakeAdminClient()}
+
+		topics, err := admin.ListTopics(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(topics) != 2 || topics[0].Name != "categories" || topics[1].Name != "transactions" || len(topics[1].Partitions) != 2 {
+			t.Errorf("expected categories and transactions, got %+v", topics)
+		}
+	})
+
+	t.Run("should describe a topic with its offsets and configuration", func(t *testing.T) {
+		admin := &Admin{client: newFakeAdminClient()}
+
+		info, err := admin.DescribeTopic(context.Background(), "transactions")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []PartitionInfo{
+			{ID: 0, Leader: 1, Replicas: []int{1}, ISR: []int{1}, FirstOffset: 2, LastOffset: 10},
+			{ID: 1, Leader: 1, Replicas: []int{1}, ISR: []int{1}, FirstOffset: 0, LastOffset: 4},
+		}
+		if !reflect.DeepEqual(info.Partitions, expected) {
+			t.Errorf("expected partitions %+v, got %+v", expected, info.Partitions)
+		}
+		if info.Configs[configCleanupPolicy] != "delete" {
+			t.Errorf("expected the cleanup policy, got %v", info.Configs)
+		}
+	})
+
+	t.Run("should create missing topics with their configuration", func(t *testing.T) {
+		client := newFakeAdminClient()
+		admin := &Admin{client: client}
+
+		created, err := admin.CreateTopics(context.Background(),
+			TopicSpec{Name: "transactions"},
+			TopicSpec{Name: "balances", Partitions: 6, Retention: 48 * time.Hour, CleanupPolicy: "compact"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(created, []string{"balances"}) {
+			t.Errorf("expected only balances to be created, got %v", created)
+		}
+		config := client.created[1]
+		expectedEntries := []kafka.ConfigEntry{{ConfigName: configRetention, ConfigValue: "172800000"}, {ConfigName: configCleanupPolicy, ConfigValue: "compact"}}
+		if config.NumPartitions != 6 || config.ReplicationFactor != 1 || !reflect.DeepEqual(config.ConfigEntries, expectedEntries) {
+			t.Errorf("unexpected topic config %+v", config)
+		}
+	})
+
+	t.Run("should report the lag of a group", func(t *testing.T) {
+		admin := &Admin{client: newFakeAdminClient()}
+
+		lags, err := admin.ConsumerGroupLag(context.Background(), "account_management", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []PartitionLag{
+			{Topic: "transactions", Partition: 0, CommittedOffset: 7, LastOffset: 10, Lag: 3},
+			{Topic: "transactions", Partition: 1, CommittedOffset: -1, LastOffset: 4, Lag: 4},
+		}
+		if !reflect.DeepEqual(lags, expected) {
+			t.Errorf("expected lags %+v, got %+v", expected, lags)
+		}
+	})
+
+	t.Run("should reset the offsets of an inactive group", func(t *testing.T) {
+		for _, tc := range []struct {
+			reset    OffsetReset
+			expected map[int]int64
+		}{
+			{ResetToEarliest(), map[int]int64{0: 2, 1: 0}},
+			{ResetToLatest(), map[int]int64{0: 10, 1: 4}},
+			{ResetToOffset(3), map[int]int64{0: 3, 1: 3}},
+			{ResetToOffset(0), map[int]int64{0: 2, 1: 0}},
+			{ResetToTime(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)), map[int]int64{0: 5, 1: 4}},
+		} {
+			t.Run(tc.reset.String(), func(t *testing.T) {
+				client := newFakeAdminClient()
+				admin := &Admin{client: client}
+
+				offsets, err := admin.ResetOffsets(context.Background(), "account_management", "transactions", tc.reset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, offset := range offsets {
+					if offset.Offset != tc.expected[offset.Partition] || client.committed[offset.Partition] != offset.Offset {
+						t.Errorf("expected partition %d at %d, got %d (committed %d)", offset.Partition, tc.expected[offset.Partition], offset.Offset, client.committed[offset.Partition])
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("should refuse to reset an active group", func(t *testing.T) {
+		client := newFakeAdminClient()
+		client.members = 1
+		admin := &Admin{client: client}
+
+		_, err := admin.ResetOffsets(context.Background(), "account_management", "transactions", ResetToEarliest())
+		if err == nil || !strings.Contains(err.Error(), "active members") {
+			t.Errorf("expected the active group to be refused, got %v", err)
+		}
+	})
+}
+
+// fakeAdminClient serves a cluster with the topics "transactions", with 2 partitions, and "categories".
+type fakeAdminClient struct {
+	members   int
+	created   []kafka.TopicConfig
+	committed map[int]int64
+}
+
+func newFakeAdminClient() *fakeAdminClient {
+	return &fakeAdminClient{committed: map[int]int64{0: 7}}
+}
+
+var fakeOffsets = map[int][2]int64{0: {2, 10}, 1: {0, 4}}
+
+func (c *fakeAdminClient) Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error) {
+	leader := kafka.Broker{ID: 1}
+	topics := []kafka.Topic{
+		{Name: "transactions", Partitions: []kafka.Partition{
+			{ID: 1, Leader: leader, Replicas: []kafka.Broker{leader}, Isr: []kafka.Broker{leader}},
+			{ID: 0, Leader: leader, Replicas: []kafka.Broker{leader}, Isr: []kafka.Broker{leader}},
+		}},
+		{Name: "categories", Partitions: []kafka.Partition{{ID: 0, Leader: leader}}},
+		{Name: "__consumer_offsets", Internal: true},
+	}
+	if len(req.Topics) == 0 {
+		return &kafka.MetadataResponse{Topics: topics}, nil
+	}
+	for _, topic := range topics {
+		if topic.Name == req.Topics[0] {
+			return &kafka.MetadataResponse{Topics: []kafka.Topic{topic}}, nil
+		}
+	}
+	return &kafka.MetadataResponse{Topics: []kafka.Topic{{Name: req.Topics[0], Error: kafka.UnknownTopicOrPartition}}}, nil
+}
+
+func (c *fakeAdminClient) CreateTopics(ctx context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error) {
+	c.created = req.Topics
+	errs := make(map[string]error)
+	for _, topic := range req.Topics {
+		if topic.Topic == "transactions" {
+			errs[topic.Topic] = kafka.TopicAlreadyExists
+		} else {
+			errs[topic.Topic] = nil
+		}
+	}
+	return &kafka.CreateTopicsResponse{Errors: errs}, nil
+}
+
+func (c *fakeAdminClient) DescribeConfigs(ctx context.Context, req *kafka.DescribeConfigsRequest) (*kafka.DescribeConfigsResponse, error) {
+	return &kafka.DescribeConfigsResponse{Resources: []kafka.DescribeConfigResponseResource{{
+		ResourceName: req.Resources[0].ResourceName,
+		ConfigEntries: []kafka.DescribeConfigResponseConfigEntry{
+			{ConfigName: configRetention, ConfigValue: "604800000"},
+			{ConfigName: configCleanupPolicy, ConfigValue: "delete"},
+		},
+	}}}, nil
+}
+
+func (c *fakeAdminClient) ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error) {
+	response := &kafka.ListOffsetsResponse{Topics: make(map[string][]kafka.PartitionOffsets)}
+	for topic, requests := range req.Topics {
+		for _, r := range requests {
+			offsets := kafka.PartitionOffsets{Partition: r.Partition, FirstOffset: -1, LastOffset: -1, Offsets: make(map[int64]time.Time)}
+			switch r.Timestamp {
+			case kafka.FirstOffset:
+				offsets.FirstOffset = fakeOffsets[r.Partition][0]
+			case kafka.LastOffset:
+				offsets.LastOffset = fakeOffsets[r.Partition][1]
+			default:
+				// Only partition 0 has messages after the requested time.
+				if r.Partition == 0 {
+					offsets.Offsets[5] = time.UnixMilli(r.Timestamp)
+				}
+			}
+			response.Topics[topic] = append(response.Topics[topic], offsets)
+		}
+	}
+	return response, nil
+}
+
+func (c *fakeAdminClient) DescribeGroups(ctx context.Context, req *kafka.DescribeGroupsRequest) (*kafka.DescribeGroupsResponse, error) {
+	group := kafka.DescribeGroupsResponseGroup{GroupID: req.GroupIDs[0], GroupState: "Empty"}
+	for range c.members {
+		group.GroupState = "Stable"
+		group.Members = append(group.Members, kafka.DescribeGroupsResponseMember{})
+	}
+	return &kafka.DescribeGroupsResponse{Groups: []kafka.DescribeGroupsResponseGroup{group}}, nil
+}
+
+func (c *fakeAdminClient) OffsetFetch(ctx context.Context, req *kafka.OffsetFetchRequest) (*kafka.OffsetFetchResponse, error) {
+	response := &kafka.OffsetFetchResponse{Topics: make(map[string][]kafka.OffsetFetchPartition)}
+	for topic, partitions := range req.Topics {
+		for _, partition := range partitions {
+			committed := int64(-1)
+			if offset, ok := c.committed[partition]; ok && topic == "transactions" {
+				committed = offset
+			}
+			response.Topics[topic] = append(response.Topics[topic], kafka.OffsetFetchPartition{Partition: partition, CommittedOffset: committed})
+		}
+	}
+	return response, nil
+}
+
+func (c *fakeAdminClient) OffsetCommit(ctx context.Context, req *kafka.OffsetCommitRequest) (*kafka.OffsetCommitResponse, error) {
+	response := &kafka.OffsetCommitResponse{Topics: make(map[string][]kafka.OffsetCommitPartition)}
+	for topic, commits := range req.Topics {
+		for _, commit := range commits {
+			c.committed[commit.Partition] = commit.Offset
+			response.Topics[topic] = append(response.Topics[topic], kafka.OffsetCommitPartition{Partition: commit.Partition})
+		}
+	}
+	return response, nil
+}
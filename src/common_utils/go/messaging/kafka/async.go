@@ -0,0 +1,355 @@
+package kafka
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultMaxPendingDeliveries = 1000
+	defaultDrainTimeout         = 10 * time.Second
+)
+
+// ErrProducerClosed is returned by ProduceMessage, ProduceMessages and PublishAsync once the messenger is closing.
+var ErrProducerClosed = errors.New("producer is closed")
+
+// WithMaxPendingDeliveries sets how many messages published with PublishAsync may be waiting for
+// their delivery at once. Once reached, PublishAsync blocks until one is delivered. Defaults to 1000.
+func WithMaxPendingDeliveries(n int) Option {
+	return func(o *options) {
+		o.maxPendingDeliveries = n
+	}
+}
+
+// WithDrainTimeout sets the deadline Close gives Shutdown: how long it waits for the messages being
+// handled to finish and for the messages published with PublishAsync to be delivered. Defaults to 10s.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.drainTimeout = timeout
+	}
+}
+
+// Delivery is the outcome of a message published with PublishAsync.
+// It is complete once the message has been written to the broker, or has failed to.
+type Delivery struct {
+	done chan struct{}
+
+	mu        sync.Mutex
+	err       error
+	callbacks []func(error)
+}
+
+func newDelivery() *Delivery {
+	return &Delivery{done: make(chan struct{})}
+}
+
+// failedDelivery returns a Delivery already completed with err.
+func failedDelivery(err error) *Delivery {
+	d := newDelivery()
+	d.complete(err)
+	return d
+}
+
+// Done returns a channel closed once the delivery is complete.
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the error the message failed with, or nil if it was delivered or is still pending.
+func (d *Delivery) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// Wait blocks until the delivery is complete and returns its error.
+//
+// Parameters:
+//   - ctx: the context to stop waiting with; the delivery itself goes on
+//
+// Returns:
+//   - error: the error the message failed with, or the context's error if it is done first
+func (d *Delivery) Wait(ctx context.Context) error {
+	select {
+	case <-d.done:
+		return d.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OnComplete calls callback with the error of the delivery once it is complete, or right away if
+// it already is. Callbacks run on the goroutine that completes the delivery, so they must not block.
+func (d *Delivery) OnComplete(callback func(err error)) {
+	d.mu.Lock()
+	select {
+	case <-d.done:
+		err := d.err
+		d.mu.Unlock()
+		callback(err)
+	default:
+		d.callbacks = append(d.callbacks, callback)
+		d.mu.Unlock()
+	}
+}
+
+func (d *Delivery) complete(err error) {
+	d.mu.Lock()
+	d.err = err
+	callbacks := d.callbacks
+	d.callbacks = nil
+	close(d.done)
+	d.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(err)
+	}
+}
+
+// PublishAsync works like ProduceMessage, but returns as soon as the message is queued instead of
+// waiting for it to be written, so callers such as HTTP handlers are not held up by batching.
+// The outcome is reported by the returned Delivery.
+//
+// The messages published with PublishAsync are written in the order they were published for each
+// topic and key: the messages queued behind a write of their key are written together once it
+// completes. A message that fails does not stop the ones queued after it.
+//
+// Messages are written with the values of ctx but not its cancellation, so a request ending does
+// not abort the delivery of the events it published. Use Flush to wait for every pending delivery;
+// Shutdown and Close do so before closing the producer.
+//
+// Parameters:
+//   - ctx: the context to use for the write operation; while too many deliveries are pending, PublishAsync
+//     waits for room until it is done
+//   - key: the key to use for the message (may be empty)
+//   - message: the content of the message
+//   - opts: optional settings such as headers (WithHeaders), an explicit timestamp (WithTimestamp)
+//     or another destination topic (ToTopic)
+//
+// Returns:
+//   - *Delivery: the outcome of the delivery; it fails right away if the message cannot be queued
+//
+// Example usage:
+//
+//	delivery := messenger.PublishAsync(r.Context(), accountID, event)
+//	delivery.OnComplete(func(err error) {
+//	  if err != nil {
+//	    logger.Error("failed to publish event", "error", err)
+//	  }
+//	})
+func (m *KafkaMessenger) PublishAsync(ctx context.Context, key, message string, opts ...ProduceOption) *Delivery {
+	if m.producer == nil {
+		return failedDelivery(fmt.Errorf("producer is not initialized"))
+	}
+
+	msg, err := m.newMessage(key, message, opts)
+	if err != nil {
+		return failedDelivery(err)
+	}
+	delivery := newDelivery()
+	if err := m.async.acquire(ctx, delivery, msg); err != nil {
+		return failedDelivery(err)
+	}
+
+	m.async.enqueue(queuedMessage{ctx: context.WithoutCancel(ctx), msg: msg, delivery: delivery}, m.produce)
+	return delivery
+}
+
+// Flush waits for every message published with PublishAsync so far to be delivered.
+//
+// Parameters:
+//   - ctx: the context to stop waiting with
+//
+// Returns:
+//   - error: the context's error if it is done before every delivery is complete
+func (m *KafkaMessenger) Flush(ctx context.Context) error {
+	return m.async.wait(ctx)
+}
+
+// asyncProducer keeps track of the deliveries started by PublishAsync, and writes their messages
+// in order, through one lane per topic and key.
+// A nil *asyncProducer, as in a messenger built without newMessenger, does not limit, track or order
+// deliveries.
+type asyncProducer struct {
+	slots chan struct{}
+
+	mu       sync.Mutex
+	pending  map[*Delivery]pendingDelivery
+	sequence uint64
+	idle     chan struct{}
+	closed   bool
+	// lanes holds the messages waiting for their lane. A lane is in the map while its goroutine runs.
+	lanes map[laneKey][]queuedMessage
+}
+
+// laneKey identifies the lane of a message: the messages of a lane are written one batch at a time.
+type laneKey struct {
+	topic string
+	key   string
+}
+
+// queuedMessage is a message published with PublishAsync, waiting to be written.
+type queuedMessage struct {
+	// ctx is the context of PublishAsync, without its cancellation.
+	ctx      context.Context
+	msg      kafka.Message
+	delivery *Delivery
+}
+
+type pendingDelivery struct {
+	sequence uint64
+	msg      kafka.Message
+}
+
+func newAsyncProducer(o options) *asyncProducer {
+	idle := make(chan struct{})
+	close(idle)
+	return &asyncProducer{
+		slots:   make(chan struct{}, max(o.maxPendingDeliveries, 1)),
+		pending: make(map[*Delivery]pendingDelivery),
+		idle:    idle,
+		lanes:   make(map[laneKey][]queuedMessage),
+	}
+}
+
+// acquire reserves room for the delivery of msg, waiting for another delivery to complete if there is none.
+func (a *asyncProducer) acquire(ctx context.Context, delivery *Delivery, msg kafka.Message) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	closed := a.closed
+	a.mu.Unlock()
+	if closed {
+		return ErrProducerClosed
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("too many pending deliveries: %w", ctx.Err())
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		<-a.slots
+		return ErrProducerClosed
+	}
+	if len(a.pending) == 0 {
+		a.idle = make(chan struct{})
+	}
+	a.sequence++
+	a.pending[delivery] = pendingDelivery{sequence: a.sequence, msg: msg}
+	return nil
+}
+
+// enqueue queues a message whose delivery was acquired, to be written with produce after the
+// messages queued before it in its lane.
+func (a *asyncProducer) enqueue(queued queuedMessage, produce func(ctx context.Context, msgs ...kafka.Message) error) {
+	if a == nil {
+		go func() { queued.delivery.complete(produce(queued.ctx, queued.msg)) }()
+		return
+	}
+
+	lane := laneKey{topic: queued.msg.Topic, key: string(queued.msg.Key)}
+	a.mu.Lock()
+	waiting, running := a.lanes[lane]
+	a.lanes[lane] = append(waiting, queued)
+	a.mu.Unlock()
+	if !running {
+		go a.runLane(lane, produce)
+	}
+}
+
+// runLane writes the messages of lane, every message queued while a write is in flight being
+// written together by the next one, until the lane is empty.
+func (a *asyncProducer) runLane(lane laneKey, produce func(ctx context.Context, msgs ...kafka.Message) error) {
+	for {
+		a.mu.Lock()
+		queued := a.lanes[lane]
+		if len(queued) == 0 {
+			delete(a.lanes, lane)
+			a.mu.Unlock()
+			return
+		}
+		a.lanes[lane] = nil
+		a.mu.Unlock()
+
+		msgs := make([]kafka.Message, len(queued))
+		parents := make([]context.Context, len(queued))
+		for i, q := range queued {
+			msgs[i] = q.msg
+			parents[i] = q.ctx
+		}
+		err := produce(withSpanParents(queued[0].ctx, parents), msgs...)
+		for _, q := range queued {
+			q.delivery.complete(err)
+			a.release(q.delivery)
+		}
+	}
+}
+
+func (a *asyncProducer) release(delivery *Delivery) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	<-a.slots
+	delete(a.pending, delivery)
+	if len(a.pending) == 0 {
+		close(a.idle)
+	}
+}
+
+func (a *asyncProducer) wait(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	idle := a.idle
+	a.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain refuses new deliveries and waits for the pending ones until ctx is done.
+// It returns the messages whose delivery was still pending, oldest first.
+func (a *asyncProducer) drain(ctx context.Context) []Message {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+
+	if a.wait(ctx) == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pending := slices.SortedFunc(maps.Values(a.pending), func(a, b pendingDelivery) int {
+		return cmp.Compare(a.sequence, b.sequence)
+	})
+	undelivered := make([]Message, len(pending))
+	for i, p := range pending {
+		undelivered[i] = fromKafkaMessage(p.msg)
+	}
+	return undelivered
+}
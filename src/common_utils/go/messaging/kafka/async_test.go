@@ -0,0 +1,263 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestPublishAsync(t *testing.T) {
+	t.Run("should deliver messages and report it", func(t *testing.T) {
+		broker := NewMemoryBroker(1)
+		messenger, err := broker.NewMessenger("transactions", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		reported := make(chan error, 1)
+		delivery := messenger.PublishAsync(context.Background(), "account-1", "payload")
+		delivery.OnComplete(func(err error) { reported <- err })
+
+		if err := delivery.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-reported; err != nil {
+			t.Errorf("expected the callback to report success, got %v", err)
+		}
+		if messages := broker.Messages("transactions"); len(messages) != 1 {
+			t.Errorf("expected 1 message, got %d", len(messages))
+		}
+	})
+
+	t.Run("should deliver the messages of a key in the order they were published", func(t *testing.T) {
+		broker := NewMemoryBroker(3)
+		messenger, err := broker.NewMessenger("balances", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		const n = 200
+		for i := range n {
+			messenger.PublishAsync(context.Background(), fmt.Sprintf("account-%d", i%2), strconv.Itoa(i))
+		}
+		if err := messenger.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		last := map[string]int{"account-0": -1, "account-1": -1}
+		messages := broker.Messages("balances")
+		for _, msg := range messages {
+			value, _ := strconv.Atoi(string(msg.Value))
+			if value <= last[msg.Key] {
+				t.Fatalf("expected the messages of %s in order, got %d after %d", msg.Key, value, last[msg.Key])
+			}
+			last[msg.Key] = value
+		}
+		if len(messages) != n {
+			t.Errorf("expected %d messages, got %d", n, len(messages))
+		}
+	})
+
+	t.Run("should write the messages queued behind a write of their key together", func(t *testing.T) {
+		writer := newBlockingWriter()
+		messenger := newMessenger("transactions", "", nil, newOptions(nil))
+		messenger.producer = writer
+
+		deliveries := make([]*Delivery, 4)
+		for i := range deliveries {
+			deliveries[i] = messenger.PublishAsync(context.Background(), "account-1", strconv.Itoa(i))
+		}
+		close(writer.release)
+		if err := messenger.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		written := writer.written()
+		if len(written) != len(deliveries) {
+			t.Fatalf("expected %d messages, got %d", len(deliveries), len(written))
+		}
+		for i, msg := range written {
+			if string(msg.Value) != strconv.Itoa(i) {
+				t.Fatalf("expected the messages in order, got %q at %d", msg.Value, i)
+			}
+		}
+		if writer.writes() > 2 {
+			t.Errorf("expected the queued messages to be written in one batch, got %d writes", writer.writes())
+		}
+	})
+
+	t.Run("should not abort the delivery when the publishing context ends", func(t *testing.T) {
+		writer := newBlockingWriter()
+		messenger := newMessenger("transactions", "", nil, newOptions(nil))
+		messenger.producer = writer
+
+		ctx, cancel := context.WithCancel(context.Background())
+		delivery := messenger.PublishAsync(ctx, "account-1", "payload")
+		cancel()
+		close(writer.release)
+
+		if err := delivery.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(writer.written()) != 1 {
+			t.Errorf("expected the message to be written, got %d", len(writer.written()))
+		}
+	})
+
+	t.Run("should flush pending deliveries", func(t *testing.T) {
+		writer := newBlockingWriter()
+		messenger := newMessenger("transactions", "", nil, newOptions(nil))
+		messenger.producer = writer
+
+		deliveries := make([]*Delivery, 5)
+		for i := range deliveries {
+			deliveries[i] = messenger.PublishAsync(context.Background(), "account-1", "payload")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := messenger.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected Flush to wait for the blocked deliveries, got %v", err)
+		}
+
+		close(writer.release)
+		if err := messenger.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for i, delivery := range deliveries {
+			select {
+			case <-delivery.Done():
+			default:
+				t.Errorf("expected delivery %d to be complete after Flush", i)
+			}
+		}
+	})
+
+	t.Run("should wait for room when too many deliveries are pending", func(t *testing.T) {
+		writer := newBlockingWriter()
+		messenger := newMessenger("transactions", "", nil, newOptions([]Option{WithMaxPendingDeliveries(1)}))
+		messenger.producer = writer
+		defer close(writer.release)
+
+		messenger.PublishAsync(context.Background(), "account-1", "first")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := messenger.PublishAsync(ctx, "account-1", "second").Err(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the second message to wait for room, got %v", err)
+		}
+	})
+
+	t.Run("should drain pending deliveries on Close", func(t *testing.T) {
+		writer := newBlockingWriter()
+		messenger := newMessenger("transactions", "", nil, newOptions(nil))
+		messenger.producer = writer
+
+		delivery := messenger.PublishAsync(context.Background(), "account-1", "payload")
+		time.AfterFunc(10*time.Millisecond, func() { close(writer.release) })
+		if err := messenger.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := delivery.Err(); err != nil || len(writer.written()) != 1 {
+			t.Errorf("expected the message to be delivered before closing, got %v", err)
+		}
+		if writer.closedWithPending {
+			t.Error("expected the producer to be closed after the delivery")
+		}
+
+		if err := messenger.PublishAsync(context.Background(), "account-1", "late").Err(); err == nil {
+			t.Error("expected publishing after Close to fail")
+		}
+	})
+
+	t.Run("should give up draining after the drain timeout", func(t *testing.T) {
+		writer := newBlockingWriter()
+		messenger := newMessenger("transactions", "", nil, newOptions([]Option{WithDrainTimeout(10 * time.Millisecond)}))
+		messenger.producer = writer
+		defer close(writer.release)
+
+		messenger.PublishAsync(context.Background(), "account-1", "payload")
+		if err := messenger.Close(); err == nil {
+			t.Error("expected an error for the undelivered message")
+		}
+	})
+
+	t.Run("should report messages that cannot be queued", func(t *testing.T) {
+		messenger := newMessenger("", "", nil, newOptions(nil))
+		if err := messenger.PublishAsync(context.Background(), "account-1", "payload").Err(); err == nil {
+			t.Error("expected an error without a producer")
+		}
+
+		messenger.producer = newBlockingWriter()
+		if err := messenger.PublishAsync(context.Background(), "account-1", "payload").Err(); err == nil {
+			t.Error("expected an error without a topic")
+		}
+	})
+}
+
+// blockingWriter is a messageWriter whose writes block until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+
+	mu                sync.Mutex
+	messages          []kafka.Message
+	calls             int
+	pending           int
+	closedWithPending bool
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{release: make(chan struct{})}
+}
+
+func (w *blockingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	w.calls++
+	w.pending++
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		w.pending--
+		w.mu.Unlock()
+	}()
+
+	select {
+	case <-w.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *blockingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closedWithPending = w.pending > 0
+	return nil
+}
+
+func (w *blockingWriter) written() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka.Message(nil), w.messages...)
+}
+
+func (w *blockingWriter) writes() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.calls
+}
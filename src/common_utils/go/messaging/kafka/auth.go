@@ -0,0 +1,149 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const defaultDialTimeout = 10 * time.Second
+
+// SASLMechanism is the SASL mechanism used to authenticate to the brokers.
+type SASLMechanism string
+
+const (
+	SASLPlain       SASLMechanism = "PLAIN"
+	SASLScramSHA256 SASLMechanism = "SCRAM-SHA-256"
+	SASLScramSHA512 SASLMechanism = "SCRAM-SHA-512"
+)
+
+// TLSFiles points to the PEM files used to build a TLS configuration with NewTLSConfig.
+type TLSFiles struct {
+	// CAFile is the certificate authority used to verify the brokers. If empty, the system pool is used.
+	CAFile string
+	// CertFile and KeyFile are the client certificate and key, for brokers requiring mutual TLS.
+	// Both must be set, or neither.
+	CertFile string
+	KeyFile  string
+}
+
+// NewTLSConfig builds a TLS configuration for WithTLS from PEM files.
+//
+// Parameters:
+//   - files: the CA, client certificate and client key files, all optional
+//
+// Returns:
+//   - *tls.Config: the TLS configuration
+//   - error: an error if a file cannot be read or parsed
+//
+// Example usage:
+//
+//	tlsConfig, err := NewTLSConfig(TLSFiles{CAFile: "/etc/kafka/ca.pem"})
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	producer, err := NewProducer(brokers, WithTLS(tlsConfig), WithSASL(SASLScramSHA512, user, password))
+func NewTLSConfig(files TLSFiles) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if files.CAFile != "" {
+		ca, err := os.ReadFile(files.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", files.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if (files.CertFile == "") != (files.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be set together")
+	}
+	if files.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// WithTLS connects to the brokers over TLS with the given configuration.
+// It applies to the producer, the consumer and the connections used to create topics.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.tls = config
+	}
+}
+
+// WithSASL authenticates to the brokers with the given SASL mechanism and credentials.
+// It applies to the producer, the consumer and the connections used to create topics.
+// SASL is usually combined with WithTLS, since PLAIN sends the password in clear text.
+func WithSASL(mechanism SASLMechanism, username, password string) Option {
+	return func(o *options) {
+		o.sasl = &saslCredentials{mechanism: mechanism, username: username, password: password}
+	}
+}
+
+type saslCredentials struct {
+	mechanism SASLMechanism
+	username  string
+	password  string
+}
+
+func (c *saslCredentials) build() (sasl.Mechanism, error) {
+	switch c.mechanism {
+	case SASLPlain:
+		return plain.Mechanism{Username: c.username, Password: c.password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, c.username, c.password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, c.username, c.password)
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism %q", c.mechanism)
+	}
+}
+
+// connection holds what is needed to reach the brokers, shared by the producer, the consumer and the admin connections.
+type connection struct {
+	dialer    *kafka.Dialer
+	transport *kafka.Transport
+}
+
+func newConnection(o options) (connection, error) {
+	var mechanism sasl.Mechanism
+	if o.sasl != nil {
+		var err error
+		if mechanism, err = o.sasl.build(); err != nil {
+			return connection{}, err
+		}
+	}
+
+	conn := connection{
+		dialer: &kafka.Dialer{
+			Timeout:       defaultDialTimeout,
+			DualStack:     true,
+			TLS:           o.tls,
+			SASLMechanism: mechanism,
+		},
+	}
+	if o.tls != nil || mechanism != nil {
+		conn.transport = &kafka.Transport{
+			DialTimeout: defaultDialTimeout,
+			TLS:         o.tls,
+			SASL:        mechanism,
+		}
+	}
+	return conn, nil
+}
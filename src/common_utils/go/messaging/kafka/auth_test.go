@@ -0,0 +1,150 @@
+//go:build unit
+
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+
+	t.Run("should load the CA and the client certificate", func(t *testing.T) {
+		config, err := NewTLSConfig(TLSFiles{CAFile: certFile, CertFile: certFile, KeyFile: keyFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.RootCAs == nil || len(config.Certificates) != 1 {
+			t.Errorf("expected a CA pool and a client certificate, got %+v", config)
+		}
+	})
+
+	t.Run("should use the system pool without a CA file", func(t *testing.T) {
+		config, err := NewTLSConfig(TLSFiles{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.RootCAs != nil || len(config.Certificates) != 0 {
+			t.Errorf("expected the default TLS settings, got %+v", config)
+		}
+	})
+
+	t.Run("should reject invalid files", func(t *testing.T) {
+		if _, err := NewTLSConfig(TLSFiles{CAFile: keyFile}); err == nil {
+			t.Error("expected an error for a CA file without certificates")
+		}
+		if _, err := NewTLSConfig(TLSFiles{CertFile: certFile}); err == nil {
+			t.Error("expected an error for a certificate without a key")
+		}
+		if _, err := NewTLSConfig(TLSFiles{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+			t.Error("expected an error for a missing CA file")
+		}
+	})
+}
+
+func TestSASL(t *testing.T) {
+	for _, mechanism := range []SASLMechanism{SASLPlain, SASLScramSHA256, SASLScramSHA512} {
+		built, err := (&saslCredentials{mechanism: mechanism, username: "user", password: "secret"}).build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if built.Name() != string(mechanism) {
+			t.Errorf("expected mechanism %s, got %s", mechanism, built.Name())
+		}
+	}
+
+	if _, err := (&saslCredentials{mechanism: "GSSAPI"}).build(); err == nil {
+		t.Error("expected an error for an unsupported mechanism")
+	}
+	if _, err := NewProducer([]string{"localhost:9092"}, WithSASL("GSSAPI", "user", "secret")); err == nil {
+		t.Error("expected the producer to reject an unsupported mechanism")
+	}
+}
+
+func TestConnection(t *testing.T) {
+	t.Run("should use the default transport without authentication", func(t *testing.T) {
+		producer, err := NewProducer([]string{"localhost:9092"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer producer.Close()
+
+		if writer := producer.producer.(*kafka.Writer); writer.Transport != nil {
+			t.Errorf("expected the default transport, got %+v", writer.Transport)
+		}
+		if producer.dialer.TLS != nil || producer.dialer.SASLMechanism != nil {
+			t.Errorf("expected a plaintext dialer, got %+v", producer.dialer)
+		}
+	})
+
+	t.Run("should apply TLS and SASL to the producer, the consumer and the admin connections", func(t *testing.T) {
+		tlsConfig := &tls.Config{ServerName: "kafka.example.com"}
+		messenger, err := NewKafkaMessenger("transactions", "account_management", []string{"localhost:9092"},
+			WithAutoCreateTopics(false), WithTLS(tlsConfig), WithSASL(SASLScramSHA512, "user", "secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		transport, ok := messenger.producer.(*kafka.Writer).Transport.(*kafka.Transport)
+		if !ok || transport.TLS != tlsConfig || transport.SASL == nil || transport.SASL.Name() != "SCRAM-SHA-512" {
+			t.Errorf("expected the producer transport to use TLS and SCRAM, got %+v", transport)
+		}
+		if dialer := messenger.consumer.(*kafka.Reader).Config().Dialer; dialer != messenger.dialer {
+			t.Errorf("expected the consumer to share the admin dialer, got %+v", dialer)
+		}
+		if messenger.dialer.TLS != tlsConfig || messenger.dialer.SASLMechanism == nil {
+			t.Errorf("expected the dialer to use TLS and SCRAM, got %+v", messenger.dialer)
+		}
+	})
+}
+
+// writeCertificate writes a self-signed certificate and its key as PEM files.
+func writeCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: encodedKey}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
@@ -0,0 +1,249 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// BackpressureMode selects what the channel consumer started by StartConsumer and
+// StartMessageConsumer does when its message channel is full.
+type BackpressureMode int
+
+const (
+	// BackpressureBlock waits until there is room in the channel. This is the default.
+	BackpressureBlock BackpressureMode = iota
+	// BackpressureFail stops the consumer with ErrConsumerStalled if the channel stays full for FailAfter.
+	BackpressureFail
+	// BackpressureSpill writes messages to a bounded on-disk buffer while the channel is full,
+	// and feeds them back into the channel, in order, as room becomes available.
+	BackpressureSpill
+)
+
+const (
+	defaultChannelCapacity = 100
+	defaultFailAfter       = 1 * time.Second
+	defaultSpillMaxBytes   = 64 << 20
+)
+
+// ErrConsumerStalled is reported on the error channel when the BackpressureFail policy gives up
+// waiting for room in the message channel.
+var ErrConsumerStalled = errors.New("consumer channel is full")
+
+// BackpressurePolicy configures how the channel consumer reacts to a slow reader of its message channel.
+// In every mode a message's offset is committed once the message is in the channel or in the spill
+// buffer, before the reader takes it, so a slow reader never makes the consumer skip a message.
+// The channel consumer is at-most-once, though: the messages still in the channel, up to its
+// capacity of 100, are lost if the process stops or the reader stops reading, since their offsets are
+// already committed. BackpressureSpill keeps the messages of its buffer across restarts, but not the
+// ones already in the channel. Use Consume for at-least-once delivery.
+type BackpressurePolicy struct {
+	Mode BackpressureMode
+	// FailAfter is how long BackpressureFail waits for room before failing. Defaults to one second.
+	FailAfter time.Duration
+	// SpillDir is the directory holding the spill buffer. Required by BackpressureSpill.
+	// Messages left in the buffer when the consumer stops are delivered first on the next start.
+	SpillDir string
+	// SpillMaxBytes bounds the size of the spill buffer. Once it is reached, the consumer blocks
+	// until the buffer has been drained. Defaults to 64 MiB.
+	SpillMaxBytes int64
+}
+
+// channelConsumer feeds messages fetched by the messenger's reader into a channel,
+// applying the messenger's backpressure policy.
+type channelConsumer[T any] struct {
+	m        *KafkaMessenger
+	policy   BackpressurePolicy
+	convert  func(kafka.Message) T
+	messages chan T
+	errs     chan error
+	spill    *spillBuffer
+}
+
+func newChannelConsumer[T any](m *KafkaMessenger, convert func(kafka.Message) T) (*channelConsumer[T], error) {
+	c := &channelConsumer[T]{
+		m:        m,
+		policy:   m.Backpressure,
+		convert:  convert,
+		messages: make(chan T, defaultChannelCapacity),
+		errs:     make(chan error, defaultChannelCapacity),
+	}
+	if c.policy.FailAfter <= 0 {
+		c.policy.FailAfter = defaultFailAfter
+	}
+	if c.policy.SpillMaxBytes <= 0 {
+		c.policy.SpillMaxBytes = defaultSpillMaxBytes
+	}
+
+	switch c.policy.Mode {
+	case BackpressureBlock, BackpressureFail:
+	case BackpressureSpill:
+		if c.policy.SpillDir == "" {
+			return nil, fmt.Errorf("spill directory is empty")
+		}
+		name := fmt.Sprintf("%s.%s.spill", url.PathEscape(m.Topic), url.PathEscape(m.GroupID))
+		spill, err := openSpillBuffer(filepath.Join(c.policy.SpillDir, name), c.policy.SpillMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open spill buffer: %w", err)
+		}
+		c.spill = spill
+	default:
+		return nil, fmt.Errorf("unknown backpressure mode %d", c.policy.Mode)
+	}
+	return c, nil
+}
+
+// run fetches messages until the run stops fetching or the backpressure policy gives up,
+// then closes the message and error channels.
+func (c *channelConsumer[T]) run(run *consumerRun) {
+	ctx := run.fetchCtx
+	drained := make(chan struct{})
+	drainCtx, stopDraining := context.WithCancel(ctx)
+	if c.spill != nil {
+		go func() {
+			defer close(drained)
+			c.drainSpill(drainCtx)
+		}()
+	} else {
+		close(drained)
+	}
+
+	defer close(c.errs)
+	defer close(c.messages)
+	defer func() {
+		stopDraining()
+		<-drained
+		if c.spill != nil {
+			if err := c.spill.Close(); err != nil {
+				c.m.logger().Error("failed to close spill buffer", "error", err)
+			}
+		}
+	}()
+
+	for ctx.Err() == nil {
+		msg, err := c.m.consumer.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.m.metrics.observeError(c.m.Topic, c.m.GroupID, ErrorKindFetch)
+			if isNetworkError(err) {
+				c.m.logger().Warn("network error while fetching, retrying", "error", err)
+				if !sleepContext(ctx, 1*time.Second) {
+					return
+				}
+				continue
+			}
+
+			c.m.logger().Error("failed to read message", "error", err)
+			select {
+			case c.errs <- fmt.Errorf("failed to read message: %w", err):
+				// Error sent successfully
+			case <-ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+				// If error channel is full, log and continue
+				c.m.logger().Warn("error channel full, dropping error", "error", err)
+			}
+			continue
+		}
+
+		c.m.fetched(msg)
+		_, span := c.m.startConsumerSpan(ctx, msg, semconv.MessagingOperationTypeReceive)
+		err = c.deliver(ctx, msg)
+		endSpan(span, err)
+		if err != nil {
+			if ctx.Err() != nil {
+				run.abandon(msg)
+				return
+			}
+			c.m.metrics.observeError(c.m.Topic, c.m.GroupID, ErrorKindDeliver)
+			c.m.logger().Error("stopping consumer, message was not delivered", append(messageAttrs(msg), "error", err)...)
+			sendError(ctx, c.errs, fmt.Errorf("failed to deliver offset %d of partition %d: %w", msg.Offset, msg.Partition, err))
+			return
+		}
+		c.m.metrics.observeConsume(c.m.GroupID, msg)
+
+		if err := c.m.commit(ctx, msg); err != nil {
+			c.m.logger().Error("failed to commit message", append(messageAttrs(msg), "error", err)...)
+			sendError(ctx, c.errs, err)
+		}
+	}
+}
+
+// fillLevel returns the fill level of the message channel, from 0 to 1.
+func (c *channelConsumer[T]) fillLevel() float64 {
+	if cap(c.messages) == 0 {
+		return 0
+	}
+	return float64(len(c.messages)) / float64(cap(c.messages))
+}
+
+// deliver hands msg over to the message channel, or to the spill buffer, according to the policy.
+// Once deliver returns nil the message is safe to commit.
+func (c *channelConsumer[T]) deliver(ctx context.Context, msg kafka.Message) error {
+	switch c.policy.Mode {
+	case BackpressureFail:
+		timer := time.NewTimer(c.policy.FailAfter)
+		defer timer.Stop()
+
+		select {
+		case c.messages <- c.convert(msg):
+			return nil
+		case <-timer.C:
+			return ErrConsumerStalled
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case BackpressureSpill:
+		// Messages may only skip the spill buffer while it is empty, otherwise they would
+		// overtake the ones waiting in it.
+		if c.spill.Empty() {
+			select {
+			case c.messages <- c.convert(msg):
+				return nil
+			default:
+			}
+		}
+		return c.spill.Append(ctx, msg)
+	default:
+		select {
+		case c.messages <- c.convert(msg):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// drainSpill moves spilled messages into the message channel, oldest first.
+func (c *channelConsumer[T]) drainSpill(ctx context.Context) {
+	for {
+		msg, err := c.spill.Peek(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.m.logger().Error("failed to read spill buffer", "error", err)
+				sendError(ctx, c.errs, fmt.Errorf("failed to read spill buffer: %w", err))
+			}
+			return
+		}
+
+		select {
+		case c.messages <- c.convert(msg):
+		case <-ctx.Done():
+			return
+		}
+
+		if err := c.spill.Advance(); err != nil {
+			c.m.logger().Error("failed to advance spill buffer", "error", err)
+			sendError(ctx, c.errs, fmt.Errorf("failed to advance spill buffer: %w", err))
+			return
+		}
+	}
+}
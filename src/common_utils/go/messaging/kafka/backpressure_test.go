@@ -0,0 +1,200 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const slowConsumerMessages = 3 * defaultChannelCapacity
+
+func TestBackpressureBlock(t *testing.T) {
+	reader := newFakeReader(fakeMessages(slowConsumerMessages)...)
+	messenger := &KafkaMessenger{Topic: "test-topic", GroupID: "test-group", consumer: reader}
+
+	messages, _, err := messenger.StartMessageConsumer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer messenger.StopConsumer()
+
+	received := receiveSlowly(t, messages, slowConsumerMessages)
+
+	assertInOrder(t, received, slowConsumerMessages)
+	waitForCommits(t, reader, slowConsumerMessages)
+}
+
+func TestBackpressureFail(t *testing.T) {
+	reader := newFakeReader(fakeMessages(slowConsumerMessages)...)
+	messenger := &KafkaMessenger{
+		Topic:        "test-topic",
+		GroupID:      "test-group",
+		Backpressure: BackpressurePolicy{Mode: BackpressureFail, FailAfter: 50 * time.Millisecond},
+		consumer:     reader,
+	}
+
+	messages, errs, err := messenger.StartMessageConsumer(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer messenger.StopConsumer()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrConsumerStalled) {
+			t.Fatalf("expected %v, got %v", ErrConsumerStalled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the consumer to fail")
+	}
+
+	var received []Message
+	for msg := range messages {
+		received = append(received, msg)
+	}
+
+	assertInOrder(t, received, defaultChannelCapacity)
+	committed := reader.Committed()
+	if len(committed) != len(received) {
+		t.Errorf("expected exactly the %d delivered messages to be committed, got %d", len(received), len(committed))
+	}
+	for i, offset := range committed {
+		if offset != received[i].Offset {
+			t.Errorf("expected committed offset %d to have been delivered, got %d", offset, received[i].Offset)
+		}
+	}
+}
+
+func TestBackpressureSpill(t *testing.T) {
+	t.Run("should deliver every message in order through the spill buffer", func(t *testing.T) {
+		reader := newFakeReader(fakeMessages(slowConsumerMessages)...)
+		messenger := &KafkaMessenger{
+			Topic:        "test-topic",
+			GroupID:      "test-group",
+			Backpressure: BackpressurePolicy{Mode: BackpressureSpill, SpillDir: t.TempDir(), SpillMaxBytes: 4096},
+			consumer:     reader,
+		}
+
+		messages, _, err := messenger.StartMessageConsumer(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.StopConsumer()
+
+		received := receiveSlowly(t, messages, slowConsumerMessages)
+
+		assertInOrder(t, received, slowConsumerMessages)
+		waitForCommits(t, reader, slowConsumerMessages)
+	})
+
+	t.Run("should deliver spilled messages after a restart", func(t *testing.T) {
+		spillDir := t.TempDir()
+		policy := BackpressurePolicy{Mode: BackpressureSpill, SpillDir: spillDir}
+
+		reader := newFakeReader(fakeMessages(defaultChannelCapacity + 10)...)
+		messenger := &KafkaMessenger{Topic: "test-topic", GroupID: "test-group", Backpressure: policy, consumer: reader}
+		if _, _, err := messenger.StartMessageConsumer(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		waitForCommits(t, reader, defaultChannelCapacity+10)
+		if err := messenger.StopConsumer(); err != nil {
+			t.Fatal(err)
+		}
+
+		restarted := &KafkaMessenger{Topic: "test-topic", GroupID: "test-group", Backpressure: policy, consumer: newFakeReader()}
+		messages, _, err := restarted.StartMessageConsumer(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer restarted.StopConsumer()
+
+		received := receiveSlowly(t, messages, 10)
+		for i, msg := range received {
+			if expected := int64(defaultChannelCapacity + i); msg.Offset != expected {
+				t.Errorf("expected offset %d, got %d", expected, msg.Offset)
+			}
+		}
+	})
+
+	t.Run("should require a spill directory", func(t *testing.T) {
+		messenger := &KafkaMessenger{
+			Topic:        "test-topic",
+			Backpressure: BackpressurePolicy{Mode: BackpressureSpill},
+			consumer:     newFakeReader(),
+		}
+		if _, _, err := messenger.StartMessageConsumer(context.Background()); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if _, _, err := messenger.StartMessageConsumer(context.Background()); err == nil || err.Error() == "consumer is already started" {
+			t.Errorf("expected the failed start to leave the consumer stopped, got %v", err)
+		}
+	})
+
+	t.Run("should name the spill file after the topic and group", func(t *testing.T) {
+		spillDir := t.TempDir()
+		messenger := &KafkaMessenger{
+			Topic:        "test-topic",
+			GroupID:      "group/with/slashes",
+			Backpressure: BackpressurePolicy{Mode: BackpressureSpill, SpillDir: spillDir},
+			consumer:     newFakeReader(),
+		}
+		if _, _, err := messenger.StartMessageConsumer(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.StopConsumer()
+
+		if _, err := os.Stat(filepath.Join(spillDir, "test-topic.group%2Fwith%2Fslashes.spill")); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func receiveSlowly(t *testing.T, messages <-chan Message, count int) []Message {
+	t.Helper()
+
+	var received []Message
+	for len(received) < count {
+		select {
+		case msg := <-messages:
+			received = append(received, msg)
+			time.Sleep(time.Millisecond)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after receiving %d of %d messages", len(received), count)
+		}
+	}
+	return received
+}
+
+func assertInOrder(t *testing.T, received []Message, count int) {
+	t.Helper()
+
+	offsets := make([]int64, len(received))
+	for i, msg := range received {
+		offsets[i] = msg.Offset
+	}
+	expected := make([]int64, count)
+	for i := range expected {
+		expected[i] = int64(i)
+	}
+	if !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected offsets 0..%d in order, got %v", count-1, offsets)
+	}
+}
+
+func waitForCommits(t *testing.T, reader *fakeReader, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(reader.Committed()) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d commits, got %d", count, len(reader.Committed()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
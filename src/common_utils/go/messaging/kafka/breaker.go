@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenFor          = 10 * time.Second
+)
+
+// ErrCircuitOpen is returned by ProduceMessage and PublishAsync while the circuit breaker set with
+// WithCircuitBreaker is open, instead of waiting for the brokers to answer.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerPolicy configures the circuit breaker of a producer.
+//
+// The circuit opens after FailureThreshold consecutive failed writes. While it is open, writes fail
+// right away with ErrCircuitOpen. Once OpenFor has elapsed, a single write is let through to probe
+// the brokers: the circuit closes if it succeeds, and opens again otherwise.
+type CircuitBreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failed writes that open the circuit. Defaults to 5.
+	FailureThreshold int
+	// OpenFor is how long the circuit stays open before probing the brokers. Defaults to 10s.
+	OpenFor time.Duration
+}
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// WithCircuitBreaker makes the producer fail fast while the brokers are unavailable, see CircuitBreakerPolicy.
+// With WithSpool, the messages are spooled instead of failing.
+func WithCircuitBreaker(policy CircuitBreakerPolicy) Option {
+	return func(o *options) {
+		o.circuitBreaker = &policy
+	}
+}
+
+// circuitBreaker implements CircuitBreakerPolicy. A nil *circuitBreaker lets every write through.
+type circuitBreaker struct {
+	policy CircuitBreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(policy CircuitBreakerPolicy) *circuitBreaker {
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = defaultFailureThreshold
+	}
+	if policy.OpenFor <= 0 {
+		policy.OpenFor = defaultOpenFor
+	}
+	return &circuitBreaker{policy: policy, now: time.Now, state: CircuitClosed}
+}
+
+// newProducerBreaker returns the circuit breaker set with WithCircuitBreaker, one with the default
+// policy if only WithSpool is set, or nil.
+func newProducerBreaker(o options) *circuitBreaker {
+	switch {
+	case o.circuitBreaker != nil:
+		return newCircuitBreaker(*o.circuitBreaker)
+	case o.spool != nil:
+		return newCircuitBreaker(CircuitBreakerPolicy{})
+	default:
+		return nil
+	}
+}
+
+// allow returns ErrCircuitOpen if a write must not be attempted. Otherwise, the outcome of the
+// write must be reported with record.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.policy.OpenFor {
+			return ErrCircuitOpen
+		}
+		b.state = CircuitHalfOpen
+		return nil
+	case CircuitHalfOpen:
+		// A probe is already in flight.
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// record reports the outcome of a write let through by allow. A write interrupted by its own
+// context does not tell anything about the brokers, so it is not counted.
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case err == nil:
+		b.state, b.failures = CircuitClosed, 0
+	case ctx.Err() != nil:
+		if b.state == CircuitHalfOpen {
+			b.state = CircuitOpen
+		}
+	case b.state == CircuitHalfOpen:
+		b.state, b.openedAt = CircuitOpen, b.now()
+	default:
+		b.failures++
+		if b.failures >= b.policy.FailureThreshold {
+			b.state, b.openedAt = CircuitOpen, b.now()
+		}
+	}
+}
+
+// current returns the current state of the circuit.
+func (b *circuitBreaker) current() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.policy.OpenFor {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// retryIn returns how long to wait before allow lets a write through, zero if it would now.
+func (b *circuitBreaker) retryIn() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != CircuitOpen {
+		return 0
+	}
+	return max(b.policy.OpenFor-b.now().Sub(b.openedAt), 0)
+}
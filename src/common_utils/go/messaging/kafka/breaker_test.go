@@ -0,0 +1,116 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	errBroker := errors.New("broker unavailable")
+	newBreaker := func() (*circuitBreaker, *time.Time) {
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		breaker := newCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 2, OpenFor: time.Minute})
+		breaker.now = func() time.Time { return now }
+		return breaker, &now
+	}
+	fail := func(breaker *circuitBreaker) {
+		if err := breaker.allow(); err != nil {
+			t.Fatal(err)
+		}
+		breaker.record(context.Background(), errBroker)
+	}
+
+	t.Run("should open after consecutive failures", func(t *testing.T) {
+		breaker, _ := newBreaker()
+		fail(breaker)
+		if breaker.current() != CircuitClosed {
+			t.Fatalf("expected the circuit to stay closed after one failure, got %s", breaker.current())
+		}
+		fail(breaker)
+		if breaker.current() != CircuitOpen {
+			t.Fatalf("expected the circuit to open, got %s", breaker.current())
+		}
+		if err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("expected ErrCircuitOpen, got %v", err)
+		}
+		if wait := breaker.retryIn(); wait != time.Minute {
+			t.Errorf("expected to retry in a minute, got %v", wait)
+		}
+	})
+
+	t.Run("should reset the failures on success", func(t *testing.T) {
+		breaker, _ := newBreaker()
+		fail(breaker)
+		breaker.allow()
+		breaker.record(context.Background(), nil)
+		fail(breaker)
+		if breaker.current() != CircuitClosed {
+			t.Errorf("expected the circuit to stay closed, got %s", breaker.current())
+		}
+	})
+
+	t.Run("should let a single probe through once open for long enough", func(t *testing.T) {
+		breaker, now := newBreaker()
+		fail(breaker)
+		fail(breaker)
+
+		*now = now.Add(time.Minute)
+		if breaker.current() != CircuitHalfOpen {
+			t.Errorf("expected the circuit to be half-open, got %s", breaker.current())
+		}
+		if err := breaker.allow(); err != nil {
+			t.Fatalf("expected the probe to be let through, got %v", err)
+		}
+		if err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("expected a second write to be refused during the probe, got %v", err)
+		}
+
+		breaker.record(context.Background(), nil)
+		if breaker.current() != CircuitClosed {
+			t.Errorf("expected a successful probe to close the circuit, got %s", breaker.current())
+		}
+	})
+
+	t.Run("should open again when the probe fails", func(t *testing.T) {
+		breaker, now := newBreaker()
+		fail(breaker)
+		fail(breaker)
+
+		*now = now.Add(time.Minute)
+		fail(breaker)
+		if breaker.current() != CircuitOpen {
+			t.Errorf("expected a failed probe to open the circuit, got %s", breaker.current())
+		}
+		if wait := breaker.retryIn(); wait != time.Minute {
+			t.Errorf("expected to retry in a minute, got %v", wait)
+		}
+	})
+
+	t.Run("should not count writes interrupted by their context", func(t *testing.T) {
+		breaker, _ := newBreaker()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		for range 3 {
+			breaker.allow()
+			breaker.record(ctx, context.Canceled)
+		}
+		if breaker.current() != CircuitClosed {
+			t.Errorf("expected the circuit to stay closed, got %s", breaker.current())
+		}
+	})
+
+	t.Run("should let everything through when nil", func(t *testing.T) {
+		var breaker *circuitBreaker
+		if err := breaker.allow(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		breaker.record(context.Background(), errBroker)
+		if breaker.current() != CircuitClosed {
+			t.Errorf("expected a closed circuit, got %s", breaker.current())
+		}
+	})
+}
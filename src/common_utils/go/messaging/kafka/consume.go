@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultHandlerBackoff = 100 * time.Millisecond
+	maxHandlerBackoff     = 5 * time.Second
+	commitTimeout         = 5 * time.Second
+)
+
+// Handler processes a single message. Returning a non-nil error leaves the message
+// uncommitted, so it is delivered to the handler again.
+type Handler func(ctx context.Context, msg Message) error
+
+// Consume reads messages from the messenger's topic and passes them to handler one at a time,
+// with at-least-once semantics: a message's offset is committed only after handler returns nil.
+// If handler returns an error, the same message is handed to it again after an exponential
+// backoff, so later messages of the partition are never committed past a failed one.
+//
+// Consume blocks until ctx is cancelled, StopConsumer or Shutdown is called, or fetching fails
+// with a non-recoverable error. On Shutdown, the message being handled is given until the
+// shutdown deadline to finish. A message whose handler was interrupted is not committed and will
+// be redelivered to the next consumer of the group.
+//
+// Parameters:
+//   - ctx: context.Context for managing the consumer lifecycle
+//   - handler: the function that processes each message
+//
+// Returns:
+//   - error: ErrNoGroup if the messenger has no group ID, or an error if the consumer is not
+//     initialized, already started, or fails to fetch or commit
+//
+// Example usage:
+//
+//	err := messenger.Consume(ctx, func(ctx context.Context, msg Message) error {
+//	  return applyBalanceUpdate(ctx, msg.Value)
+//	})
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+func (m *KafkaMessenger) Consume(ctx context.Context, handler Handler) error {
+	run, err := m.beginConsuming(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.finishConsuming(run)
+
+	for run.fetchCtx.Err() == nil {
+		msg, err := m.consumer.FetchMessage(run.fetchCtx)
+		if err != nil {
+			if run.fetchCtx.Err() != nil {
+				return nil
+			}
+			m.metrics.observeError(m.Topic, m.GroupID, ErrorKindFetch)
+			if isNetworkError(err) {
+				m.logger().Warn("network error while fetching, retrying", "error", err)
+				if !sleepContext(run.fetchCtx, 1*time.Second) {
+					return nil
+				}
+				continue
+			}
+			return fmt.Errorf("failed to fetch message: %w", err)
+		}
+
+		m.fetched(msg)
+		if !m.handle(run.handleCtx, handler, msg) {
+			m.logger().Info("stopped before the message was handled, it will be redelivered", messageAttrs(msg)...)
+			run.abandon(msg)
+			return nil
+		}
+
+		if err := m.commit(run.handleCtx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handle passes msg to handler until it succeeds, within the message's process span.
+// It returns false if ctx is cancelled before the handler succeeds.
+func (m *KafkaMessenger) handle(ctx context.Context, handler Handler, msg kafka.Message) bool {
+	handleCtx, span := m.startConsumerSpan(ctx, msg, semconv.MessagingOperationTypeDeliver)
+	if !m.handleUntilSuccess(handleCtx, handler, msg) {
+		endSpan(span, ctx.Err())
+		return false
+	}
+	endSpan(span, nil)
+	m.metrics.observeConsume(m.GroupID, msg)
+	return true
+}
+
+// handleUntilSuccess calls handler until it succeeds, waiting an exponentially growing backoff between
+// attempts. It returns false if ctx is cancelled before the handler succeeds.
+func (m *KafkaMessenger) handleUntilSuccess(ctx context.Context, handler Handler, msg kafka.Message) bool {
+	message := fromKafkaMessage(msg)
+	backoff := defaultHandlerBackoff
+
+	for attempt := 1; ; attempt++ {
+		call := m.handlerCalls.begin()
+		err := handler(ctx, message)
+		m.handlerCalls.end(call)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		m.metrics.observeError(msg.Topic, m.GroupID, ErrorKindHandler)
+		trace.SpanFromContext(ctx).RecordError(err, trace.WithAttributes(attribute.Int("attempt", attempt)))
+		m.logger().Warn("handler failed, retrying", append(messageAttrs(msg), "attempt", attempt, "backoff", backoff, "error", err)...)
+		if !sleepContext(ctx, backoff) {
+			return false
+		}
+		backoff = min(backoff*2, maxHandlerBackoff)
+	}
+}
+
+// commit commits the message's offset. The commit is not bound to ctx, so that a message whose
+// handler already succeeded is still recorded when the consumer is being stopped.
+func (m *KafkaMessenger) commit(ctx context.Context, msgs ...kafka.Message) error {
+	commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), commitTimeout)
+	defer cancel()
+
+	if err := m.consumer.CommitMessages(commitCtx, msgs...); err != nil {
+		m.metrics.observeError(m.Topic, m.GroupID, ErrorKindCommit)
+		return fmt.Errorf("failed to commit offsets: %w", err)
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,232 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestConsume(t *testing.T) {
+	t.Run("should commit every message after its handler succeeds", func(t *testing.T) {
+		reader := newFakeReader(fakeMessages(3)...)
+		messenger := &KafkaMessenger{Topic: "test-topic", GroupID: "test-group", consumer: reader}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var handled []int64
+		err := messenger.Consume(ctx, func(ctx context.Context, msg Message) error {
+			handled = append(handled, msg.Offset)
+			if len(handled) == 3 {
+				cancel()
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		if expected := []int64{0, 1, 2}; !reflect.DeepEqual(handled, expected) {
+			t.Errorf("expected handled offsets %v, got %v", expected, handled)
+		}
+		if expected := []int64{0, 1, 2}; !reflect.DeepEqual(reader.Committed(), expected) {
+			t.Errorf("expected committed offsets %v, got %v", expected, reader.Committed())
+		}
+	})
+
+	t.Run("should redeliver a failed message before committing it", func(t *testing.T) {
+		reader := newFakeReader(fakeMessages(2)...)
+		messenger := &KafkaMessenger{Topic: "test-topic", GroupID: "test-group", consumer: reader}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var handled []int64
+		err := messenger.Consume(ctx, func(ctx context.Context, msg Message) error {
+			handled = append(handled, msg.Offset)
+			if msg.Offset == 0 && len(handled) < 3 {
+				if committed := reader.Committed(); len(committed) != 0 {
+					t.Errorf("expected nothing committed while the handler fails, got %v", committed)
+				}
+				return errors.New("balance store unavailable")
+			}
+			if msg.Offset == 1 {
+				cancel()
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		if expected := []int64{0, 0, 0, 1}; !reflect.DeepEqual(handled, expected) {
+			t.Errorf("expected handled offsets %v, got %v", expected, handled)
+		}
+		if expected := []int64{0, 1}; !reflect.DeepEqual(reader.Committed(), expected) {
+			t.Errorf("expected committed offsets %v, got %v", expected, reader.Committed())
+		}
+	})
+
+	t.Run("should not commit a message whose handler was interrupted", func(t *testing.T) {
+		reader := newFakeReader(fakeMessages(1)...)
+		messenger := &KafkaMessenger{Topic: "test-topic", GroupID: "test-group", consumer: reader}
+
+		started := make(chan struct{})
+		go func() {
+			<-started
+			if err := messenger.StopConsumer(); err != nil {
+				t.Errorf("expected nil error, got %v", err)
+			}
+		}()
+
+		err := messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		if committed := reader.Committed(); len(committed) != 0 {
+			t.Errorf("expected nothing committed, got %v", committed)
+		}
+	})
+
+	t.Run("should return fetch errors", func(t *testing.T) {
+		reader := newFakeReader()
+		reader.fetchErr = errors.New("unknown topic")
+		messenger := &KafkaMessenger{Topic: "test-topic", GroupID: "test-group", consumer: reader}
+
+		err := messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error { return nil })
+		if !errors.Is(err, reader.fetchErr) {
+			t.Fatalf("expected %v, got %v", reader.fetchErr, err)
+		}
+
+		err = messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error { return nil })
+		if !errors.Is(err, reader.fetchErr) {
+			t.Errorf("expected the consumer to be restartable after failing, got %v", err)
+		}
+	})
+
+	t.Run("should refuse to start twice", func(t *testing.T) {
+		messenger := &KafkaMessenger{Topic: "test-topic", GroupID: "test-group", consumer: newFakeReader()}
+
+		_, _, err := messenger.StartMessageConsumer(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.StopConsumer()
+
+		if err := messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error { return nil }); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
+	t.Run("should fail if the consumer is not initialized", func(t *testing.T) {
+		messenger := &KafkaMessenger{Topic: "test-topic"}
+		if err := messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error { return nil }); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
+	t.Run("should fail if the messenger has no group", func(t *testing.T) {
+		reader := newFakeReader(fakeMessages(1)...)
+		messenger := &KafkaMessenger{Topic: "test-topic", consumer: reader}
+
+		if err := messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error { return nil }); !errors.Is(err, ErrNoGroup) {
+			t.Errorf("expected %v, got %v", ErrNoGroup, err)
+		}
+		if _, _, err := messenger.StartConsumer(context.Background()); !errors.Is(err, ErrNoGroup) {
+			t.Errorf("expected %v, got %v", ErrNoGroup, err)
+		}
+		if reader.Position() != 0 {
+			t.Error("expected no message to be fetched")
+		}
+	})
+}
+
+// fakeReader serves a fixed list of messages and blocks once they are exhausted.
+type fakeReader struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	position  int
+	committed []int64
+	fetchErr  error
+	closed    bool
+}
+
+func newFakeReader(messages ...kafka.Message) *fakeReader {
+	return &fakeReader{messages: messages}
+}
+
+func fakeMessages(count int) []kafka.Message {
+	messages := make([]kafka.Message, count)
+	for i := range messages {
+		messages[i] = kafka.Message{
+			Topic:  "test-topic",
+			Offset: int64(i),
+			Key:    []byte("key"),
+			Value:  []byte("value"),
+			Time:   time.Date(2025, 4, 1, 12, 0, i, 0, time.UTC),
+		}
+	}
+	return messages
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if r.fetchErr != nil {
+		r.mu.Unlock()
+		return kafka.Message{}, r.fetchErr
+	}
+	if r.position < len(r.messages) {
+		msg := r.messages[r.position]
+		r.position++
+		r.mu.Unlock()
+		return msg, nil
+	}
+	r.mu.Unlock()
+
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, msg := range msgs {
+		r.committed = append(r.committed, msg.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	return nil
+}
+
+func (r *fakeReader) Committed() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]int64(nil), r.committed...)
+}
+
+func (r *fakeReader) Position() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.position
+}
@@ -0,0 +1,329 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// OccurredAtLayout is the ISO 8601 UTC layout mandated by contracts.md for every date and time
+// exchanged between services.
+const OccurredAtLayout = "2006-01-02T15:04:05Z"
+
+// DefaultSchemaVersion is the schema version assigned to envelopes created by NewEnvelope.
+const DefaultSchemaVersion = 1
+
+// Headers of the messages carrying an envelope, so that consumers can route or skip an event
+// without decoding it.
+const (
+	// HeaderEventType holds the type of the event, as in Envelope.Type.
+	HeaderEventType = "x-event-type"
+	// HeaderEventID holds the id of the event, as in Envelope.ID.
+	HeaderEventID = "x-event-id"
+)
+
+// Envelope is the standard wrapper for every event published on the bus.
+// It carries the metadata shared by all events and a typed payload, so that
+// services agree on one JSON shape instead of inventing their own.
+type Envelope[T any] struct {
+	ID            string
+	Type          string
+	Source        string
+	SchemaVersion int
+	OccurredAt    time.Time
+	CorrelationID string
+	Payload       T
+}
+
+type envelopeJSON[T any] struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"`
+	Source        string `json:"source"`
+	SchemaVersion int    `json:"schema_version"`
+	OccurredAt    string `json:"occurred_at"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	Payload       T      `json:"payload"`
+}
+
+// NewEnvelope creates an Envelope for the given payload with a fresh event ID,
+// the default schema version and the current UTC time as its occurrence time.
+//
+// Parameters:
+//   - eventType: the name of the event, e.g. "TransactionCreated"
+//   - source: the name of the service publishing the event
+//   - payload: the event payload
+//
+// Returns:
+//   - Envelope[T]: the new envelope
+//
+// Example usage:
+//
+//	envelope := NewEnvelope("TransactionCreated", "transaction_management", transaction)
+//	envelope.CorrelationID = requestID
+func NewEnvelope[T any](eventType, source string, payload T) Envelope[T] {
+	return Envelope[T]{
+		ID:            newEventID(),
+		Type:          eventType,
+		Source:        source,
+		SchemaVersion: DefaultSchemaVersion,
+		OccurredAt:    time.Now().UTC(),
+		Payload:       payload,
+	}
+}
+
+// MarshalJSON encodes the envelope with snake_case field names and the occurrence time
+// formatted with OccurredAtLayout.
+func (e Envelope[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(envelopeJSON[T]{
+		ID:            e.ID,
+		Type:          e.Type,
+		Source:        e.Source,
+		SchemaVersion: e.SchemaVersion,
+		OccurredAt:    e.OccurredAt.UTC().Format(OccurredAtLayout),
+		CorrelationID: e.CorrelationID,
+		Payload:       e.Payload,
+	})
+}
+
+// UnmarshalJSON decodes an envelope produced by MarshalJSON.
+// The occurrence time is also accepted in RFC 3339 with fractional seconds or offsets,
+// since not every publisher truncates it.
+func (e *Envelope[T]) UnmarshalJSON(data []byte) error {
+	var decoded envelopeJSON[T]
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	occurredAt, err := time.Parse(time.RFC3339Nano, decoded.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("invalid occurred_at %q: %w", decoded.OccurredAt, err)
+	}
+
+	*e = Envelope[T]{
+		ID:            decoded.ID,
+		Type:          decoded.Type,
+		Source:        decoded.Source,
+		SchemaVersion: decoded.SchemaVersion,
+		OccurredAt:    occurredAt.UTC(),
+		CorrelationID: decoded.CorrelationID,
+		Payload:       decoded.Payload,
+	}
+	return nil
+}
+
+// Validate checks that the envelope carries the metadata every consumer relies on.
+//
+// Returns:
+//   - error: an error describing the first missing field, or nil if the envelope is valid
+func (e Envelope[T]) Validate() error {
+	switch {
+	case e.ID == "":
+		return fmt.Errorf("envelope id is empty")
+	case e.Type == "":
+		return fmt.Errorf("envelope type is empty")
+	case e.Source == "":
+		return fmt.Errorf("envelope source is empty")
+	case e.SchemaVersion <= 0:
+		return fmt.Errorf("envelope schema version must be positive, got %d", e.SchemaVersion)
+	case e.OccurredAt.IsZero():
+		return fmt.Errorf("envelope occurred_at is empty")
+	}
+	return nil
+}
+
+// Validator checks the JSON payload of an event against the schema of its type and version.
+// *schema.Registry implements it.
+type Validator interface {
+	Validate(eventType string, schemaVersion int, payload []byte) error
+}
+
+// EnvelopeOption configures Publish and Subscribe.
+type EnvelopeOption func(*envelopeOptions)
+
+type envelopeOptions struct {
+	validator Validator
+}
+
+// WithSchemaValidation validates every payload against its schema: Publish refuses invalid events
+// and Subscribe reports them on the error channel instead of delivering them.
+func WithSchemaValidation(v Validator) EnvelopeOption {
+	return func(o *envelopeOptions) {
+		o.validator = v
+	}
+}
+
+func newEnvelopeOptions(opts []EnvelopeOption) envelopeOptions {
+	var o envelopeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// validatePayload checks the encoded payload of an event, if schema validation is enabled.
+func (o envelopeOptions) validatePayload(eventType string, schemaVersion int, payload []byte) error {
+	if o.validator == nil {
+		return nil
+	}
+	if err := o.validator.Validate(eventType, schemaVersion, payload); err != nil {
+		return fmt.Errorf("invalid %s payload: %w", eventType, err)
+	}
+	return nil
+}
+
+// Publish encodes the envelope as JSON and produces it to the publisher's topic, with its type and
+// id in the HeaderEventType and HeaderEventID headers.
+// The envelope is validated before being sent, so malformed events never reach the bus.
+//
+// Parameters:
+//   - ctx: the context to use for the write operation
+//   - p: the publisher to publish through
+//   - key: the key to use for the message, e.g. the account id the event refers to
+//   - envelope: the event to publish
+//   - opts: options such as WithSchemaValidation
+//
+// Returns:
+//   - error: an error if the envelope is invalid, cannot be encoded or cannot be written
+//
+// Example usage:
+//
+//	envelope := NewEnvelope("TransactionCreated", "transaction_management", transaction)
+//	if err := Publish(ctx, messenger, accountID, envelope, WithSchemaValidation(registry)); err != nil {
+//	  return err
+//	}
+func Publish[T any](ctx context.Context, p Publisher, key string, envelope Envelope[T], opts ...EnvelopeOption) error {
+	if err := envelope.Validate(); err != nil {
+		return fmt.Errorf("invalid envelope: %w", err)
+	}
+
+	o := newEnvelopeOptions(opts)
+	if o.validator != nil {
+		payload, err := json.Marshal(envelope.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode payload: %w", err)
+		}
+		if err := o.validatePayload(envelope.Type, envelope.SchemaVersion, payload); err != nil {
+			return err
+		}
+	}
+
+	encoded, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to encode envelope: %w", err)
+	}
+
+	return p.ProduceMessage(ctx, key, string(encoded),
+		WithHeader(HeaderEventType, envelope.Type),
+		WithHeader(HeaderEventID, envelope.ID),
+	)
+}
+
+// Subscribe starts the subscriber's consumer and decodes every message into an Envelope[T].
+// Messages that cannot be decoded, or whose payload does not match its schema when
+// WithSchemaValidation is given, are reported on the error channel, alongside the errors
+// reported by the underlying consumer. Both channels are closed when the consumer stops.
+//
+// Parameters:
+//   - ctx: context.Context for managing the consumer lifecycle
+//   - s: the subscriber to consume from
+//   - opts: options such as WithSchemaValidation
+//
+// Returns:
+//   - <-chan Envelope[T]: a channel for receiving decoded events
+//   - <-chan error: a channel for receiving consumer and decoding errors
+//   - error: an error if the consumer could not be started
+//
+// Example usage:
+//
+//	events, errs, err := Subscribe[TransactionCreated](ctx, messenger)
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	for event := range events {
+//	  applyTransaction(event.Payload)
+//	}
+func Subscribe[T any](ctx context.Context, s Subscriber, opts ...EnvelopeOption) (<-chan Envelope[T], <-chan error, error) {
+	o := newEnvelopeOptions(opts)
+	messages, errs, err := s.StartConsumer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	envelopes := make(chan Envelope[T], cap(messages))
+	envelopeErrs := make(chan error, cap(errs))
+
+	go func() {
+		defer close(envelopes)
+		defer close(envelopeErrs)
+
+		for messages != nil || errs != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					messages = nil
+					continue
+				}
+				envelope, err := decodeEnvelope[T]([]byte(message), o)
+				if err != nil {
+					sendError(ctx, envelopeErrs, err)
+					continue
+				}
+				select {
+				case envelopes <- envelope:
+				case <-ctx.Done():
+					return
+				}
+			case consumerErr, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				sendError(ctx, envelopeErrs, consumerErr)
+			}
+		}
+	}()
+
+	return envelopes, envelopeErrs, nil
+}
+
+// decodeEnvelope decodes a message into an Envelope[T], validating its payload first if schema
+// validation is enabled.
+func decodeEnvelope[T any](message []byte, o envelopeOptions) (Envelope[T], error) {
+	if o.validator != nil {
+		var raw Envelope[json.RawMessage]
+		if err := json.Unmarshal(message, &raw); err != nil {
+			return Envelope[T]{}, fmt.Errorf("failed to decode envelope: %w", err)
+		}
+		if err := o.validatePayload(raw.Type, raw.SchemaVersion, raw.Payload); err != nil {
+			return Envelope[T]{}, err
+		}
+	}
+
+	var envelope Envelope[T]
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return Envelope[T]{}, fmt.Errorf("failed to decode envelope: %w", err)
+	}
+	return envelope, nil
+}
+
+func sendError(ctx context.Context, errs chan<- error, err error) {
+	select {
+	case errs <- err:
+	case <-ctx.Done():
+	}
+}
+
+// newEventID returns a random (version 4) UUID.
+func newEventID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate event id: %v", err))
+	}
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
@@ -0,0 +1,247 @@
+//go:build unit
+
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/schema"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewEnvelope(t *testing.T) {
+	payload := TransactionCreated{ID: 1, AccountID: 2, Amount: 10.5, Currency: "BRL"}
+	envelope := kafka.NewEnvelope("TransactionCreated", "transaction_management", payload)
+
+	if !uuidPattern.MatchString(envelope.ID) {
+		t.Errorf("expected a version 4 uuid, got %s", envelope.ID)
+	}
+	if envelope.SchemaVersion != kafka.DefaultSchemaVersion {
+		t.Errorf("expected schema version %d, got %d", kafka.DefaultSchemaVersion, envelope.SchemaVersion)
+	}
+	if envelope.OccurredAt.Location() != time.UTC {
+		t.Errorf("expected occurred_at in UTC, got %s", envelope.OccurredAt.Location())
+	}
+	if envelope.Payload != payload {
+		t.Errorf("expected payload %+v, got %+v", payload, envelope.Payload)
+	}
+	if err := envelope.Validate(); err != nil {
+		t.Errorf("expected a valid envelope, got %v", err)
+	}
+
+	other := kafka.NewEnvelope("TransactionCreated", "transaction_management", payload)
+	if other.ID == envelope.ID {
+		t.Errorf("expected unique event ids, got %s twice", envelope.ID)
+	}
+}
+
+func TestEnvelopeJSON(t *testing.T) {
+	t.Run("should encode with contract field names and date format", func(t *testing.T) {
+		envelope := kafka.Envelope[TransactionCreated]{
+			ID:            "6f1c2b7e-1111-4222-8333-444455556666",
+			Type:          "TransactionCreated",
+			Source:        "transaction_management",
+			SchemaVersion: 2,
+			OccurredAt:    time.Date(2025, 4, 1, 12, 30, 15, 999, time.FixedZone("BRT", -3*60*60)),
+			CorrelationID: "request-1",
+			Payload:       TransactionCreated{ID: 1, AccountID: 2, Amount: 10.5, Currency: "BRL"},
+		}
+
+		encoded, err := json.Marshal(envelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded map[string]any
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]any{
+			"id":             "6f1c2b7e-1111-4222-8333-444455556666",
+			"type":           "TransactionCreated",
+			"source":         "transaction_management",
+			"schema_version": float64(2),
+			"occurred_at":    "2025-04-01T15:30:15Z",
+			"correlation_id": "request-1",
+			"payload": map[string]any{
+				"id":         float64(1),
+				"account_id": float64(2),
+				"amount":     10.5,
+				"currency":   "BRL",
+			},
+		}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("expected %v, got %v", expected, decoded)
+		}
+	})
+
+	t.Run("should decode what it encodes", func(t *testing.T) {
+		envelope := kafka.NewEnvelope("TransactionCreated", "transaction_management", TransactionCreated{ID: 3})
+		envelope.CorrelationID = "request-2"
+
+		encoded, err := json.Marshal(envelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded kafka.Envelope[TransactionCreated]
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		envelope.OccurredAt = envelope.OccurredAt.Truncate(time.Second)
+		if decoded != envelope {
+			t.Errorf("expected %+v, got %+v", envelope, decoded)
+		}
+	})
+
+	t.Run("should accept fractional seconds from other publishers", func(t *testing.T) {
+		raw := `{"id":"a","type":"UserCreated","source":"user_management","schema_version":1,"occurred_at":"2025-04-01T12:00:00.123456+00:00","payload":{}}`
+
+		var decoded kafka.Envelope[map[string]any]
+		if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := time.Date(2025, 4, 1, 12, 0, 0, 123456000, time.UTC)
+		if !decoded.OccurredAt.Equal(expected) {
+			t.Errorf("expected %s, got %s", expected, decoded.OccurredAt)
+		}
+	})
+
+	t.Run("should reject an invalid occurred_at", func(t *testing.T) {
+		raw := `{"id":"a","type":"UserCreated","source":"user_management","schema_version":1,"occurred_at":"yesterday","payload":{}}`
+
+		var decoded kafka.Envelope[map[string]any]
+		if err := json.Unmarshal([]byte(raw), &decoded); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestEnvelopeValidate(t *testing.T) {
+	valid := kafka.NewEnvelope("UserCreated", "user_management", struct{}{})
+
+	cases := map[string]func(e *kafka.Envelope[struct{}]){
+		"empty id":             func(e *kafka.Envelope[struct{}]) { e.ID = "" },
+		"empty type":           func(e *kafka.Envelope[struct{}]) { e.Type = "" },
+		"empty source":         func(e *kafka.Envelope[struct{}]) { e.Source = "" },
+		"zero schema version":  func(e *kafka.Envelope[struct{}]) { e.SchemaVersion = 0 },
+		"zero occurrence time": func(e *kafka.Envelope[struct{}]) { e.OccurredAt = time.Time{} },
+	}
+
+	for name, mutate := range cases {
+		t.Run("should reject "+name, func(t *testing.T) {
+			envelope := valid
+			mutate(&envelope)
+			if err := envelope.Validate(); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	registry, err := schema.Open(filepath.Join("..", "..", "..", "schemas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := kafka.NewEnvelope("TransactionCreated", "transaction_management", TransactionCreated{ID: 1, AccountID: 2, Amount: 10.5, Currency: "BRL"})
+	invalid := kafka.NewEnvelope("TransactionCreated", "transaction_management", TransactionCreated{ID: 1, AccountID: 2, Amount: 10.5, Currency: "R$"})
+
+	t.Run("should refuse to publish invalid payloads", func(t *testing.T) {
+		messenger, err := kafka.NewMemoryBroker(1).NewMessenger("transactions", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		if err := kafka.Publish(context.Background(), messenger, "2", invalid, kafka.WithSchemaValidation(registry)); err == nil {
+			t.Error("expected an error for an invalid payload")
+		}
+		unknown := kafka.NewEnvelope("TransactionDeleted", "transaction_management", TransactionCreated{ID: 1})
+		if err := kafka.Publish(context.Background(), messenger, "2", unknown, kafka.WithSchemaValidation(registry)); !errors.Is(err, schema.ErrUnknownSchema) {
+			t.Errorf("expected ErrUnknownSchema, got %v", err)
+		}
+		if err := kafka.Publish(context.Background(), messenger, "2", valid, kafka.WithSchemaValidation(registry)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("should publish the type and id of the event as headers", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		messenger, err := broker.NewMessenger("transactions", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		if err := kafka.Publish(context.Background(), messenger, "2", valid); err != nil {
+			t.Fatal(err)
+		}
+		messages := broker.Messages("transactions")
+		if len(messages) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(messages))
+		}
+		eventType, _ := messages[0].Header(kafka.HeaderEventType)
+		eventID, _ := messages[0].Header(kafka.HeaderEventID)
+		if eventType != "TransactionCreated" || eventID != valid.ID {
+			t.Errorf("expected the headers of %s, got %q and %q", valid.ID, eventType, eventID)
+		}
+	})
+
+	t.Run("should report invalid payloads instead of delivering them", func(t *testing.T) {
+		messenger, err := kafka.NewMemoryBroker(1).NewMessenger("transactions", "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		events, errs, err := kafka.Subscribe[TransactionCreated](ctx, messenger, kafka.WithSchemaValidation(registry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.StopConsumer()
+
+		if err := kafka.Publish(ctx, messenger, "2", invalid); err != nil {
+			t.Fatal(err)
+		}
+		if err := kafka.Publish(ctx, messenger, "2", valid); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Error("expected a validation error")
+			}
+		case received := <-events:
+			t.Fatalf("expected the invalid payload to be reported, got %+v", received)
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+
+		select {
+		case received := <-events:
+			if received.ID != valid.ID {
+				t.Errorf("expected envelope %s, got %s", valid.ID, received.ID)
+			}
+		case err := <-errs:
+			t.Fatal(err)
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	})
+}
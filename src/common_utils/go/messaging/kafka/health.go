@@ -0,0 +1,295 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const (
+	healthCheckTimeout  = 5 * time.Second
+	defaultStallTimeout = 5 * time.Minute
+	// groupStable is the state of a consumer group whose members have been assigned their partitions.
+	groupStable = "Stable"
+)
+
+// HealthStatus describes what a messenger can reach of its Kafka cluster, and whether the messenger
+// itself still works.
+type HealthStatus struct {
+	// Broker is the address of the first broker that could be reached.
+	Broker          string `json:"broker,omitempty"`
+	BrokerReachable bool   `json:"broker_reachable"`
+	Controller      string `json:"controller,omitempty"`
+	ControllerFound bool   `json:"controller_found"`
+	Topic           string `json:"topic,omitempty"`
+	// TopicPartitions is the number of partitions of the topic, 0 if it does not exist. For a
+	// multi-topic consumer, Topic lists its topics and TopicPartitions is the total of their
+	// partitions, 0 if one of them does not exist.
+	TopicPartitions int    `json:"topic_partitions"`
+	GroupID         string `json:"group_id,omitempty"`
+	// GroupState is the state of the consumer group as reported by its coordinator, e.g. "Stable",
+	// "PreparingRebalance" or "Empty".
+	GroupState   string `json:"group_state,omitempty"`
+	GroupMembers int    `json:"group_members"`
+	// ConsumerRunning tells whether Consume, ConsumeConcurrently or a channel consumer is running.
+	ConsumerRunning bool `json:"consumer_running"`
+	// LastFetch is when the consumer last fetched a message, zero if it never did. An idle topic
+	// leaves it unchanged, so it is informative rather than a health criterion.
+	LastFetch time.Time `json:"last_fetch,omitzero"`
+	// Circuit is the state of the producer's circuit breaker, if it has one.
+	Circuit CircuitState `json:"circuit,omitempty"`
+	// Spooled is the number of messages waiting in the producer's spool.
+	Spooled int `json:"spooled,omitempty"`
+	// Closed tells whether the messenger was closed.
+	Closed bool `json:"closed"`
+	// HandlingSince is when the oldest call to a Handler still running started, zero if none is.
+	HandlingSince time.Time `json:"handling_since,omitzero"`
+	// Stalled tells whether a call to a Handler has been running for longer than the stall timeout
+	// set with WithStallTimeout.
+	Stalled bool `json:"stalled"`
+	// Errors lists the checks that failed.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Live reports whether the messenger itself works: it is not closed and no Handler is stuck. It does
+// not depend on the cluster, since restarting a service does not help while Kafka is unreachable;
+// Ready does.
+func (s HealthStatus) Live() bool {
+	return !s.Closed && !s.Stalled
+}
+
+// Ready reports whether the messenger can do its job: a broker and the controller are reachable,
+// the topic exists and, while a consumer is running, its group is stable with at least one member.
+func (s HealthStatus) Ready() bool {
+	if !s.BrokerReachable || !s.ControllerFound {
+		return false
+	}
+	if s.Topic != "" && s.TopicPartitions == 0 {
+		return false
+	}
+	if s.GroupID != "" && s.ConsumerRunning && (s.GroupState != groupStable || s.GroupMembers == 0) {
+		return false
+	}
+	return true
+}
+
+// WithStallTimeout sets how long a call to a Handler may run before HealthStatus.Live reports the
+// messenger as stalled. The backoff between the attempts of a failing handler does not count.
+// Defaults to 5 minutes.
+func WithStallTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.stallTimeout = timeout
+	}
+}
+
+// HealthChecker reports the health of a messenger. KafkaMessenger implements it.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) HealthStatus
+}
+
+var _ HealthChecker = (*KafkaMessenger)(nil)
+
+// HealthCheck checks that a broker and the controller can be reached, that the messenger's topic
+// exists and, for consumers, the state of the consumer group. It also reports whether the messenger
+// is closed or stalled by a Handler.
+//
+// Parameters:
+//   - ctx: the context bounding the checks
+//
+// Returns:
+//   - HealthStatus: the outcome of every check, with the errors of those that failed
+//
+// Example usage:
+//
+//	status := messenger.HealthCheck(ctx)
+//	if !status.Ready() {
+//	  logger.Warn("kafka is not ready", "errors", status.Errors)
+//	}
+func (m *KafkaMessenger) HealthCheck(ctx context.Context) HealthStatus {
+	status := HealthStatus{Topic: m.Topic, GroupID: m.GroupID}
+
+	m.mu.Lock()
+	status.ConsumerRunning = m.run != nil
+	status.Closed = m.closed
+	m.mu.Unlock()
+	status.HandlingSince = m.handlerCalls.oldest()
+	status.Stalled = m.stallTimeout > 0 && !status.HandlingSince.IsZero() && time.Since(status.HandlingSince) > m.stallTimeout
+	if lastFetch := m.lastFetch.Load(); lastFetch != 0 {
+		status.LastFetch = time.Unix(0, lastFetch).UTC()
+	}
+	if m.breaker != nil {
+		status.Circuit = m.breaker.current()
+	}
+	status.Spooled = m.Spooled()
+
+	if m.inspector == nil {
+		status.Errors = append(status.Errors, "messenger is not connected to a cluster")
+		return status
+	}
+	m.inspector.inspect(ctx, &status)
+	return status
+}
+
+// fetched records that msg was fetched.
+func (m *KafkaMessenger) fetched(msg kafka.Message) {
+	m.lastFetch.Store(time.Now().UnixNano())
+	m.metrics.observeFetch(m.GroupID, msg)
+}
+
+// handlerCalls tracks the calls to a Handler still running.
+type handlerCalls struct {
+	mu      sync.Mutex
+	next    uint64
+	started map[uint64]time.Time
+}
+
+// begin records that a call starts and returns its id.
+func (c *handlerCalls) begin() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started == nil {
+		c.started = make(map[uint64]time.Time)
+	}
+	c.next++
+	c.started[c.next] = time.Now()
+	return c.next
+}
+
+func (c *handlerCalls) end(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.started, id)
+}
+
+// oldest returns when the oldest running call started, zero if none is running.
+func (c *handlerCalls) oldest() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var oldest time.Time
+	for _, started := range c.started {
+		if oldest.IsZero() || started.Before(oldest) {
+			oldest = started
+		}
+	}
+	return oldest
+}
+
+// LivenessHandler returns an HTTP handler answering 200 while checker is live and 503 otherwise,
+// with the HealthStatus as a JSON body.
+//
+// Example usage:
+//
+//	http.Handle("/healthz", kafka.LivenessHandler(messenger))
+//	http.Handle("/readyz", kafka.ReadinessHandler(messenger))
+func LivenessHandler(checker HealthChecker) http.Handler {
+	return healthHandler(checker, HealthStatus.Live)
+}
+
+// ReadinessHandler returns an HTTP handler answering 200 while checker is ready and 503 otherwise,
+// with the HealthStatus as a JSON body.
+func ReadinessHandler(checker HealthChecker) http.Handler {
+	return healthHandler(checker, HealthStatus.Ready)
+}
+
+func healthHandler(checker HealthChecker, healthy func(HealthStatus) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		status := checker.HealthCheck(ctx)
+		code := http.StatusOK
+		if !healthy(status) {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+// clusterInspector fills in the parts of a HealthStatus that depend on the cluster.
+type clusterInspector interface {
+	inspect(ctx context.Context, status *HealthStatus)
+}
+
+// kafkaInspector inspects a Kafka cluster.
+type kafkaInspector struct {
+	brokers   []string
+	dialer    *kafka.Dialer
+	transport kafka.RoundTripper
+}
+
+func newKafkaInspector(brokers []string, conn connection) *kafkaInspector {
+	inspector := &kafkaInspector{brokers: brokers, dialer: conn.dialer, transport: kafka.DefaultTransport}
+	if inspector.dialer == nil {
+		inspector.dialer = kafka.DefaultDialer
+	}
+	if conn.transport != nil {
+		inspector.transport = conn.transport
+	}
+	return inspector
+}
+
+func (i *kafkaInspector) inspect(ctx context.Context, status *HealthStatus) {
+	var conn *kafka.Conn
+	for _, broker := range i.brokers {
+		c, err := i.dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			status.Errors = append(status.Errors, fmt.Sprintf("broker %s: %v", broker, err))
+			continue
+		}
+		conn = c
+		status.Broker, status.BrokerReachable = broker, true
+		break
+	}
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	controller, err := conn.Controller()
+	if err != nil {
+		status.Errors = append(status.Errors, fmt.Sprintf("controller: %v", err))
+	} else {
+		status.Controller, status.ControllerFound = net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)), true
+	}
+
+	if status.Topic != "" {
+		for _, topic := range topicsOf(status) {
+			partitions, err := conn.ReadPartitions(topic)
+			if err != nil {
+				status.Errors = append(status.Errors, fmt.Sprintf("topic %s: %v", topic, err))
+				status.TopicPartitions = 0
+				break
+			}
+			status.TopicPartitions += len(partitions)
+		}
+	}
+
+	if status.GroupID != "" {
+		client := &kafka.Client{Addr: kafka.TCP(status.Broker), Transport: i.transport}
+		response, err := client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{status.GroupID}})
+		switch {
+		case err != nil:
+			status.Errors = append(status.Errors, fmt.Sprintf("group %s: %v", status.GroupID, err))
+		case len(response.Groups) != 1:
+			status.Errors = append(status.Errors, fmt.Sprintf("group %s: not described", status.GroupID))
+		case response.Groups[0].Error != nil:
+			status.Errors = append(status.Errors, fmt.Sprintf("group %s: %v", status.GroupID, response.Groups[0].Error))
+		default:
+			status.GroupState = response.Groups[0].GroupState
+			status.GroupMembers = len(response.Groups[0].Members)
+		}
+	}
+}
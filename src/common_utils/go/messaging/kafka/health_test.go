@@ -0,0 +1,145 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	t.Run("should report the topic and the group of a running consumer", func(t *testing.T) {
+		messenger, err := NewMemoryBroker(2).NewMessenger("transactions", "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		status := messenger.HealthCheck(context.Background())
+		if !status.Live() || !status.Ready() || status.TopicPartitions != 2 || status.ConsumerRunning || !status.LastFetch.IsZero() {
+			t.Errorf("expected a ready messenger without consumer, got %+v", status)
+		}
+
+		messages, _, err := messenger.StartConsumer(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		messenger.ProduceMessage(context.Background(), "account-1", "payload")
+		<-messages
+
+		status = messenger.HealthCheck(context.Background())
+		if !status.Ready() || !status.ConsumerRunning || status.GroupState != "Stable" || status.GroupMembers != 1 {
+			t.Errorf("expected a ready consumer, got %+v", status)
+		}
+		if time.Since(status.LastFetch) > time.Minute {
+			t.Errorf("expected the last fetch to be recent, got %v", status.LastFetch)
+		}
+	})
+
+	t.Run("should not be ready while the group has not joined", func(t *testing.T) {
+		status := HealthStatus{
+			BrokerReachable: true, ControllerFound: true, Topic: "transactions", TopicPartitions: 3,
+			GroupID: "account_management", GroupState: "PreparingRebalance", ConsumerRunning: true,
+		}
+		if !status.Live() || status.Ready() {
+			t.Errorf("expected a live but not ready status, got %+v", status)
+		}
+	})
+
+	t.Run("should report unreachable brokers", func(t *testing.T) {
+		messenger, err := NewProducer([]string{"127.0.0.1:1"}, WithTopic("transactions"), WithAutoCreateTopics(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		status := messenger.HealthCheck(ctx)
+		if !status.Live() || status.Ready() || len(status.Errors) == 0 {
+			t.Errorf("expected an unreachable broker to be reported without failing liveness, got %+v", status)
+		}
+	})
+
+	t.Run("should not be live once closed", func(t *testing.T) {
+		messenger, err := NewMemoryBroker(1).NewMessenger("transactions", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		messenger.Close()
+
+		if status := messenger.HealthCheck(context.Background()); status.Live() || !status.Closed {
+			t.Errorf("expected a closed messenger not to be live, got %+v", status)
+		}
+	})
+
+	t.Run("should not be live while a handler is stuck", func(t *testing.T) {
+		broker := NewMemoryBroker(1)
+		messenger, err := broker.NewMessenger("transactions", "account_management", WithStallTimeout(20*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		release := make(chan struct{})
+		handling := make(chan struct{}, 1)
+		go messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error {
+			handling <- struct{}{}
+			<-release
+			return nil
+		})
+		messenger.ProduceMessage(context.Background(), "account-1", "payload")
+		<-handling
+
+		if status := messenger.HealthCheck(context.Background()); !status.Live() || status.HandlingSince.IsZero() {
+			t.Errorf("expected a live messenger handling a message, got %+v", status)
+		}
+		time.Sleep(30 * time.Millisecond)
+		if status := messenger.HealthCheck(context.Background()); status.Live() || !status.Stalled {
+			t.Errorf("expected a stalled messenger not to be live, got %+v", status)
+		}
+
+		close(release)
+		waitFor(t, func() bool { return messenger.HealthCheck(context.Background()).Live() })
+	})
+}
+
+func TestHealthHandlers(t *testing.T) {
+	messenger, err := NewMemoryBroker(1).NewMessenger("transactions", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer messenger.Close()
+
+	for _, tc := range []struct {
+		name    string
+		checker HealthChecker
+		handler func(HealthChecker) http.Handler
+		code    int
+	}{
+		{"live", messenger, LivenessHandler, http.StatusOK},
+		{"ready", messenger, ReadinessHandler, http.StatusOK},
+		{"not live", &KafkaMessenger{Topic: "transactions", closed: true}, LivenessHandler, http.StatusServiceUnavailable},
+		{"not ready", &KafkaMessenger{Topic: "transactions"}, ReadinessHandler, http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			tc.handler(tc.checker).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if recorder.Code != tc.code {
+				t.Errorf("expected status %d, got %d", tc.code, recorder.Code)
+			}
+			var status HealthStatus
+			if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+			if status.Topic != "transactions" {
+				t.Errorf("expected the status of transactions, got %+v", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package kafka
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ProcessedStore records the events a consumer has processed, by envelope id, so that redelivered
+// events are not processed twice. LRUStore keeps them in memory, and gormstore.Store in a SQL table.
+type ProcessedStore interface {
+	// Processed reports whether the event has been processed.
+	Processed(ctx context.Context, eventID string) (bool, error)
+	// MarkProcessed records that the event has been processed. Marking an event twice is not an error.
+	MarkProcessed(ctx context.Context, eventID string) error
+}
+
+// IdempotencyOption configures Idempotent.
+type IdempotencyOption func(*idempotencyOptions)
+
+type idempotencyOptions struct {
+	metrics *Metrics
+	groupID string
+	logger  *slog.Logger
+}
+
+// IdempotencyMetrics counts the duplicates dropped by Idempotent in metrics, under the given consumer group.
+func IdempotencyMetrics(metrics *Metrics, groupID string) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.metrics = metrics
+		o.groupID = groupID
+	}
+}
+
+// IdempotencyLogger sets the logger of Idempotent. Without it, only warnings and errors are logged,
+// through slog.Default.
+func IdempotencyLogger(logger *slog.Logger) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.logger = logger
+	}
+}
+
+type eventIDKey struct{}
+
+// EventID returns the envelope id of the message being handled by a handler wrapped with Idempotent.
+// A handler writing to a database can use it to record the event in the same transaction as its
+// changes, e.g. with gormstore.Store.Claim, so that a crash between the two cannot apply it twice.
+func EventID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(eventIDKey{}).(string)
+	return id, ok
+}
+
+// Idempotent wraps handler so that it handles every event once: the messages whose envelope id is
+// already in store are acknowledged without calling handler, and the id of every message handled
+// successfully is added to store. Messages that are not envelopes, or have no id, are always handled.
+//
+// The id is only recorded after handler succeeds, so an event redelivered while it is being handled,
+// or after a crash before it is recorded, is handled again. Handlers that must never apply an event
+// twice should record it in the same transaction as their changes, see EventID.
+//
+// Parameters:
+//   - store: the store of the processed events
+//   - handler: the handler to wrap
+//   - opts: optional settings such as IdempotencyMetrics
+//
+// Returns:
+//   - Handler: the wrapped handler
+//
+// Example usage:
+//
+//	processed := NewLRUStore(100_000, 24*time.Hour)
+//	err := messenger.Consume(ctx, Idempotent(processed, applyBalanceUpdate, IdempotencyMetrics(metrics, "account_management")))
+func Idempotent(store ProcessedStore, handler Handler, opts ...IdempotencyOption) Handler {
+	var o idempotencyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	logger := o.logger
+	if logger == nil {
+		logger = quietLogger()
+	}
+
+	return func(ctx context.Context, msg Message) error {
+		id := peekEnvelope(msg.Value).ID
+		if id == "" {
+			return handler(ctx, msg)
+		}
+
+		processed, err := store.Processed(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to check whether event %s was processed: %w", id, err)
+		}
+		if processed {
+			o.metrics.observeDuplicate(msg.Topic, o.groupID)
+			logger.Debug("skipping duplicate event", "event_id", id, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+			return nil
+		}
+
+		if err := handler(context.WithValue(ctx, eventIDKey{}, id), msg); err != nil {
+			return err
+		}
+		// Failing here would handle the event again, which is what the store is meant to prevent.
+		if err := store.MarkProcessed(context.WithoutCancel(ctx), id); err != nil {
+			logger.Error("failed to record processed event, a redelivery would process it again", "event_id", id, "error", err)
+		}
+		return nil
+	}
+}
+
+// envelopeMeta holds the metadata of an envelope needed to route and deduplicate it, without its payload.
+type envelopeMeta struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// peekEnvelope decodes the metadata of the envelope encoded in value, which is empty if it is not an envelope.
+func peekEnvelope(value []byte) envelopeMeta {
+	var meta envelopeMeta
+	if err := json.Unmarshal(value, &meta); err != nil {
+		return envelopeMeta{}
+	}
+	return meta
+}
+
+// LRUStore is a ProcessedStore keeping the most recently processed events in memory. It forgets the
+// least recently processed events once it is full, and the events older than its TTL, so it only
+// drops the duplicates redelivered shortly after the original, which covers redeliveries after a
+// rebalance or a failed commit. It is lost on restart, and not shared between replicas.
+type LRUStore struct {
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	eventID     string
+	processedAt time.Time
+}
+
+// NewLRUStore creates an LRUStore.
+//
+// Parameters:
+//   - capacity: the maximum number of events remembered, at least 1
+//   - ttl: how long an event is remembered, 0 to remember it until it is evicted
+//
+// Returns:
+//   - *LRUStore: a new, empty LRUStore
+func NewLRUStore(capacity int, ttl time.Duration) *LRUStore {
+	return &LRUStore{
+		capacity: max(capacity, 1),
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Processed implements ProcessedStore.
+func (s *LRUStore) Processed(ctx context.Context, eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[eventID]
+	if !ok {
+		return false, nil
+	}
+	if s.expired(element.Value.(*lruEntry)) {
+		s.remove(element)
+		return false, nil
+	}
+	return true, nil
+}
+
+// MarkProcessed implements ProcessedStore.
+func (s *LRUStore) MarkProcessed(ctx context.Context, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if element, ok := s.entries[eventID]; ok {
+		element.Value.(*lruEntry).processedAt = now
+		s.order.MoveToFront(element)
+		return nil
+	}
+
+	s.entries[eventID] = s.order.PushFront(&lruEntry{eventID: eventID, processedAt: now})
+	// The oldest entries are at the back, so the expired ones are evicted first.
+	for element := s.order.Back(); element != nil && (s.order.Len() > s.capacity || s.expired(element.Value.(*lruEntry))); element = s.order.Back() {
+		s.remove(element)
+	}
+	return nil
+}
+
+// Len returns the number of events remembered, including the expired ones not evicted yet.
+func (s *LRUStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+func (s *LRUStore) expired(entry *lruEntry) bool {
+	return s.ttl > 0 && s.now().Sub(entry.processedAt) >= s.ttl
+}
+
+func (s *LRUStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*lruEntry).eventID)
+}
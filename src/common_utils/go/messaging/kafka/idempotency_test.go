@@ -0,0 +1,130 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIdempotent(t *testing.T) {
+	event := func(id string) Message {
+		value, err := json.Marshal(NewEnvelope("BalanceUpdated", "transaction_management", 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var envelope Envelope[int]
+		json.Unmarshal(value, &envelope)
+		envelope.ID = id
+		value, _ = json.Marshal(envelope)
+		return Message{Topic: "transactions", Value: value}
+	}
+
+	t.Run("should handle an event once and count the duplicates", func(t *testing.T) {
+		metrics := NewMetrics()
+		var handled []string
+		handler := Idempotent(NewLRUStore(10, 0), func(ctx context.Context, msg Message) error {
+			id, _ := EventID(ctx)
+			handled = append(handled, id)
+			return nil
+		}, IdempotencyMetrics(metrics, "account_management"))
+
+		for _, id := range []string{"event-1", "event-2", "event-1", "event-1"} {
+			if err := handler(context.Background(), event(id)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(handled) != 2 || handled[0] != "event-1" || handled[1] != "event-2" {
+			t.Errorf("expected [event-1 event-2] to be handled, got %v", handled)
+		}
+		if duplicates := testutil.ToFloat64(metrics.duplicates.WithLabelValues("transactions", "account_management")); duplicates != 2 {
+			t.Errorf("expected 2 duplicates, got %v", duplicates)
+		}
+	})
+
+	t.Run("should handle a failed event again", func(t *testing.T) {
+		attempts := 0
+		handler := Idempotent(NewLRUStore(10, 0), func(ctx context.Context, msg Message) error {
+			if attempts++; attempts == 1 {
+				return errors.New("temporary failure")
+			}
+			return nil
+		})
+
+		if err := handler(context.Background(), event("event-1")); err == nil {
+			t.Error("expected the handler's error")
+		}
+		if err := handler(context.Background(), event("event-1")); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != 2 {
+			t.Errorf("expected 2 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("should always handle messages without an event id", func(t *testing.T) {
+		handled := 0
+		handler := Idempotent(NewLRUStore(10, 0), func(ctx context.Context, msg Message) error {
+			handled++
+			return nil
+		})
+
+		for _, value := range []string{"not an envelope", `{"type":"BalanceUpdated"}`, "not an envelope"} {
+			if err := handler(context.Background(), Message{Value: []byte(value)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if handled != 3 {
+			t.Errorf("expected 3 messages handled, got %d", handled)
+		}
+	})
+}
+
+func TestLRUStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should evict the least recently processed events", func(t *testing.T) {
+		store := NewLRUStore(2, 0)
+		store.MarkProcessed(ctx, "event-1")
+		store.MarkProcessed(ctx, "event-2")
+		store.MarkProcessed(ctx, "event-1")
+		store.MarkProcessed(ctx, "event-3")
+
+		for id, expected := range map[string]bool{"event-1": true, "event-2": false, "event-3": true} {
+			if processed, _ := store.Processed(ctx, id); processed != expected {
+				t.Errorf("expected %s processed to be %t", id, expected)
+			}
+		}
+		if store.Len() != 2 {
+			t.Errorf("expected 2 events, got %d", store.Len())
+		}
+	})
+
+	t.Run("should forget the events older than its ttl", func(t *testing.T) {
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		store := NewLRUStore(10, time.Hour)
+		store.now = func() time.Time { return now }
+		store.MarkProcessed(ctx, "event-1")
+		now = now.Add(30 * time.Minute)
+		store.MarkProcessed(ctx, "event-2")
+
+		now = now.Add(30 * time.Minute)
+		if processed, _ := store.Processed(ctx, "event-1"); processed {
+			t.Error("expected event-1 to have expired")
+		}
+		if processed, _ := store.Processed(ctx, "event-2"); !processed {
+			t.Error("expected event-2 to be remembered")
+		}
+
+		now = now.Add(time.Hour)
+		store.MarkProcessed(ctx, "event-3")
+		if store.Len() != 1 {
+			t.Errorf("expected the expired events to be evicted, got %d events", store.Len())
+		}
+	})
+}
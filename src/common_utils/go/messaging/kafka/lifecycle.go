@@ -0,0 +1,216 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// ErrConsumerClosed is returned when starting a consumer on a messenger that is closing.
+var ErrConsumerClosed = errors.New("consumer is closed")
+
+// ShutdownReport lists what a messenger gave up on while shutting down.
+type ShutdownReport struct {
+	// Abandoned holds the messages fetched by the consumer whose handling did not finish before the
+	// deadline. Their offsets were not committed, so they will be delivered again to the group.
+	Abandoned []Message
+	// Undelivered holds the messages published with PublishAsync that were still being written at the
+	// deadline. Their deliveries fail once the producer is closed, although they may have reached the broker.
+	Undelivered []Message
+	// Spooled is the number of messages left in the spool set with WithSpool. They stay on disk and
+	// are forwarded by the next producer using the same spool.
+	Spooled int
+}
+
+// consumerRun is one run of Consume, ConsumeConcurrently or a channel consumer, from its start until it has stopped.
+type consumerRun struct {
+	// fetchCtx is cancelled to stop fetching new messages.
+	fetchCtx     context.Context
+	stopFetching context.CancelFunc
+	// handleCtx is cancelled once the messages being handled must be abandoned.
+	handleCtx context.Context
+	abort     context.CancelFunc
+	done      chan struct{}
+
+	mu        sync.Mutex
+	abandoned []Message
+}
+
+// abandon records that msg was fetched but will not be committed.
+func (r *consumerRun) abandon(msg kafka.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.abandoned = append(r.abandoned, fromKafkaMessage(msg))
+}
+
+func (r *consumerRun) Abandoned() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message(nil), r.abandoned...)
+}
+
+// beginConsuming marks the consumer as started and returns the run the consumer must follow.
+// Cancelling ctx stops the run right away, without waiting for the messages being handled.
+func (m *KafkaMessenger) beginConsuming(ctx context.Context) (*consumerRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrConsumerClosed
+	}
+	if m.consumer == nil {
+		return nil, fmt.Errorf("consumer is not initialized")
+	}
+	if m.GroupID == "" {
+		// Without a group, offsets cannot be committed, and the first commit would fail once the
+		// message has been handled.
+		return nil, ErrNoGroup
+	}
+	if m.run != nil {
+		return nil, fmt.Errorf("consumer is already started")
+	}
+
+	run := &consumerRun{done: make(chan struct{})}
+	run.handleCtx, run.abort = context.WithCancel(ctx)
+	run.fetchCtx, run.stopFetching = context.WithCancel(run.handleCtx)
+	m.run = run
+	return run, nil
+}
+
+// finishConsuming resets the consumer state, so that the consumer can be started again, and
+// signals that run has stopped.
+func (m *KafkaMessenger) finishConsuming(run *consumerRun) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run.abort()
+	if m.run == run {
+		m.run = nil
+	}
+	close(run.done)
+}
+
+// stopConsumer stops fetching and waits for the running consumer to finish handling the messages
+// it fetched, abandoning them once ctx is done. It returns false if no consumer is running.
+func (m *KafkaMessenger) stopConsumer(ctx context.Context) ([]Message, bool) {
+	m.mu.Lock()
+	run := m.run
+	m.mu.Unlock()
+
+	if run == nil {
+		return nil, false
+	}
+
+	m.logger().Debug("stopping consumer")
+	run.stopFetching()
+	select {
+	case <-run.done:
+	case <-ctx.Done():
+		run.abort()
+		<-run.done
+	}
+
+	abandoned := run.Abandoned()
+	if len(abandoned) > 0 {
+		m.logger().Info("abandoned messages being handled, they will be redelivered", "abandoned", len(abandoned))
+	}
+	return abandoned, true
+}
+
+// StopConsumer stops the running consumer right away and waits for it to exit: messages being
+// handled are interrupted and left uncommitted. The channels of a consumer started by StartConsumer
+// or StartMessageConsumer are closed. Use Shutdown to let the messages being handled finish first.
+//
+// Returns:
+//   - error: an error if the consumer is not running
+func (m *KafkaMessenger) StopConsumer() error {
+	stopped, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, ok := m.stopConsumer(stopped); !ok {
+		return fmt.Errorf("kafka consumer is not running")
+	}
+	return nil
+}
+
+// Shutdown closes the messenger gracefully, in order:
+//
+//  1. the consumer stops fetching, and the messages it is handling are given until ctx is done to
+//     finish and be committed; those still being handled are then interrupted and left uncommitted;
+//  2. the messages published with PublishAsync are given until ctx is done to be delivered;
+//  3. the messages in the spool set with WithSpool are given until ctx is done to be forwarded,
+//     unless the circuit breaker is open; the others stay on disk;
+//  4. the producer, then the consumer, are closed.
+//
+// Once Shutdown has been called, the messenger refuses to produce or start a consumer.
+// Calling it again does nothing.
+//
+// Parameters:
+//   - ctx: the deadline of the shutdown
+//
+// Returns:
+//   - ShutdownReport: the messages that were abandoned or not delivered
+//   - error: an error if messages were not delivered or the Kafka clients failed to close
+//
+// Example usage:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//	defer cancel()
+//	report, err := messenger.Shutdown(ctx)
+//	if err != nil {
+//	  logger.Error("unclean shutdown", "error", err, "abandoned", len(report.Abandoned))
+//	}
+func (m *KafkaMessenger) Shutdown(ctx context.Context) (report ShutdownReport, err error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ShutdownReport{}, nil
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	report.Abandoned, _ = m.stopConsumer(ctx)
+
+	report.Undelivered = m.async.drain(ctx)
+	if len(report.Undelivered) > 0 {
+		m.logger().Warn("closing with undelivered messages", "undelivered", len(report.Undelivered))
+		err = fmt.Errorf("%d messages were not delivered in time: %w", len(report.Undelivered), ctx.Err())
+	}
+
+	spooled, spoolErr := m.spool.close(ctx)
+	report.Spooled = spooled
+	if spoolErr != nil {
+		m.logger().Error("failed to close spool", "error", spoolErr)
+		err = errors.Join(err, spoolErr)
+	}
+
+	m.metrics.untrack(m.producer, m.consumer)
+
+	if m.producer != nil {
+		m.logger().Debug("closing producer")
+		if closeErr := m.producer.Close(); closeErr != nil {
+			m.logger().Error("failed to close producer", "error", closeErr)
+			err = errors.Join(err, fmt.Errorf("failed to close producer: %w", closeErr))
+		}
+	}
+
+	if m.consumer != nil {
+		m.logger().Debug("closing consumer")
+		if closeErr := m.consumer.Close(); closeErr != nil {
+			m.logger().Error("failed to close consumer", "error", closeErr)
+			err = errors.Join(err, fmt.Errorf("failed to close consumer: %w", closeErr))
+		}
+	}
+
+	return report, err
+}
+
+// isClosed reports whether Shutdown or Close has been called.
+func (m *KafkaMessenger) isClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
@@ -0,0 +1,212 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	t.Run("should let the message being handled finish and commit it", func(t *testing.T) {
+		reader := newFakeReader(fakeMessages(3)...)
+		messenger := newMessenger("test-topic", "test-group", nil, newOptions(nil))
+		messenger.consumer = reader
+
+		started, release := make(chan struct{}), make(chan struct{})
+		stopped := make(chan error)
+		go func() {
+			stopped <- messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error {
+				close(started)
+				<-release
+				return nil
+			})
+		}()
+		<-started
+
+		shutdown := make(chan ShutdownReport)
+		go func() {
+			report, err := messenger.Shutdown(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			shutdown <- report
+		}()
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+
+		report := <-shutdown
+		if err := <-stopped; err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Abandoned) != 0 {
+			t.Errorf("expected nothing abandoned, got %v", report.Abandoned)
+		}
+		if expected := []int64{0}; !reflect.DeepEqual(reader.Committed(), expected) {
+			t.Errorf("expected committed offsets %v, got %v", expected, reader.Committed())
+		}
+		if !reader.closed {
+			t.Error("expected the reader to be closed")
+		}
+	})
+
+	t.Run("should abandon the messages still being handled at the deadline", func(t *testing.T) {
+		reader := newFakeReader(fakeMessages(1)...)
+		messenger := newMessenger("test-topic", "test-group", nil, newOptions(nil))
+		messenger.consumer = reader
+
+		started := make(chan struct{})
+		go messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		report, err := messenger.Shutdown(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Abandoned) != 1 || report.Abandoned[0].Offset != 0 {
+			t.Errorf("expected offset 0 to be abandoned, got %v", report.Abandoned)
+		}
+		if committed := reader.Committed(); len(committed) != 0 {
+			t.Errorf("expected nothing committed, got %v", committed)
+		}
+	})
+
+	t.Run("should handle the queued messages of a worker pool", func(t *testing.T) {
+		reader := newFakeReader(fakeMessages(5)...)
+		messenger := newMessenger("test-topic", "test-group", nil, newOptions(nil))
+		messenger.consumer = reader
+
+		started, release := make(chan struct{}), make(chan struct{})
+		var once sync.Once
+		stopped := make(chan error)
+		go func() {
+			stopped <- messenger.ConsumeConcurrently(context.Background(), 2, func(ctx context.Context, msg Message) error {
+				once.Do(func() { close(started) })
+				<-release
+				return nil
+			})
+		}()
+		<-started
+		for deadline := time.Now().Add(5 * time.Second); reader.Position() < 5 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+
+		time.AfterFunc(10*time.Millisecond, func() { close(release) })
+		report, err := messenger.Shutdown(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := <-stopped; err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Abandoned) != 0 {
+			t.Errorf("expected nothing abandoned, got %v", report.Abandoned)
+		}
+		if committed := reader.Committed(); len(committed) == 0 || committed[len(committed)-1] != 4 {
+			t.Errorf("expected every offset to be committed, got %v", committed)
+		}
+	})
+
+	t.Run("should report undelivered messages", func(t *testing.T) {
+		writer := newBlockingWriter()
+		messenger := newMessenger("transactions", "", nil, newOptions(nil))
+		messenger.producer = writer
+		defer close(writer.release)
+
+		messenger.PublishAsync(context.Background(), "account-1", "first")
+		messenger.PublishAsync(context.Background(), "account-2", "second")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		report, err := messenger.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline to be reported, got %v", err)
+		}
+		if len(report.Undelivered) != 2 || report.Undelivered[0].Key != "account-1" || report.Undelivered[1].Key != "account-2" {
+			t.Errorf("expected both messages to be reported in order, got %v", report.Undelivered)
+		}
+	})
+
+	t.Run("should refuse to produce or consume once closed", func(t *testing.T) {
+		messenger, err := NewMemoryBroker(1).NewMessenger("transactions", "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := messenger.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := messenger.Close(); err != nil {
+			t.Errorf("expected closing twice to do nothing, got %v", err)
+		}
+
+		if err := messenger.ProduceMessage(context.Background(), "account-1", "payload"); !errors.Is(err, ErrProducerClosed) {
+			t.Errorf("expected ErrProducerClosed, got %v", err)
+		}
+		if err := messenger.PublishAsync(context.Background(), "account-1", "payload").Err(); !errors.Is(err, ErrProducerClosed) {
+			t.Errorf("expected ErrProducerClosed, got %v", err)
+		}
+		if _, _, err := messenger.StartConsumer(context.Background()); !errors.Is(err, ErrConsumerClosed) {
+			t.Errorf("expected ErrConsumerClosed, got %v", err)
+		}
+	})
+
+	t.Run("should coordinate concurrent starts, stops and closes", func(t *testing.T) {
+		broker := NewMemoryBroker(1)
+		messenger, err := broker.NewMessenger("transactions", "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 10 {
+			messenger.ProduceMessage(context.Background(), "account-1", "payload")
+		}
+
+		var wg sync.WaitGroup
+		for i := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 20 {
+					switch i % 3 {
+					case 0:
+						if messages, _, err := messenger.StartConsumer(context.Background()); err == nil {
+							go func() {
+								for range messages {
+								}
+							}()
+						}
+					case 1:
+						go messenger.Consume(context.Background(), func(ctx context.Context, msg Message) error { return nil })
+					default:
+						messenger.StopConsumer()
+					}
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(5 * time.Millisecond)
+			messenger.Close()
+		}()
+		wg.Wait()
+
+		if err := messenger.Close(); err != nil {
+			t.Fatal(err)
+		}
+		messenger.mu.Lock()
+		defer messenger.mu.Unlock()
+		if messenger.run != nil {
+			t.Error("expected no consumer to run after Close")
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// WithLogger sets the logger of the messenger, also used for the logs of the underlying Kafka client.
+// Without it, only warnings and errors are logged, through slog.Default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// quietLogger returns slog.Default restricted to warnings and errors.
+func quietLogger() *slog.Logger {
+	return slog.New(minLevelHandler{Handler: slog.Default().Handler(), level: slog.LevelWarn})
+}
+
+// minLevelHandler drops the records below level before they reach the wrapped handler.
+type minLevelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h minLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h minLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return minLevelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h minLevelHandler) WithGroup(name string) slog.Handler {
+	return minLevelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// logger returns the messenger's logger, annotated with its topic and group.
+func (m *KafkaMessenger) logger() *slog.Logger {
+	logger := m.Logger
+	if logger == nil {
+		logger = quietLogger()
+	}
+	return logger.With("topic", m.Topic, "group", m.GroupID)
+}
+
+// kafkaLoggers adapts the messenger's logger to the loggers of the Kafka client: its
+// informational logs become debug records, and its error logs become warnings, since the client
+// retries most of them on its own.
+func (m *KafkaMessenger) kafkaLoggers() (kafka.Logger, kafka.Logger) {
+	logAt := func(level slog.Level) kafka.Logger {
+		return kafka.LoggerFunc(func(format string, args ...interface{}) {
+			logger := m.logger()
+			if logger.Enabled(context.Background(), level) {
+				logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+			}
+		})
+	}
+	return logAt(slog.LevelDebug), logAt(slog.LevelWarn)
+}
+
+// messageAttrs returns the structured fields locating msg.
+func messageAttrs(msg kafka.Message) []any {
+	return []any{"partition", msg.Partition, "offset", msg.Offset, "key", string(msg.Key)}
+}
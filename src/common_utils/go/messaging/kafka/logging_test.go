@@ -0,0 +1,116 @@
+//go:build unit
+
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	t.Run("should only log warnings and errors by default", func(t *testing.T) {
+		records := &logRecords{}
+		previous := slog.Default()
+		slog.SetDefault(slog.New(slog.NewJSONHandler(records, &slog.HandlerOptions{Level: slog.LevelDebug})))
+		defer slog.SetDefault(previous)
+
+		m := &KafkaMessenger{Topic: "transactions", GroupID: "account_management"}
+		m.logger().Debug("debug")
+		m.logger().Info("info")
+		m.logger().Warn("warn")
+
+		logged := records.Decode(t)
+		if len(logged) != 1 || logged[0]["msg"] != "warn" {
+			t.Errorf("expected only the warning, got %v", logged)
+		}
+	})
+
+	t.Run("should log the client's logs at debug and its errors as warnings", func(t *testing.T) {
+		records := &logRecords{}
+		m := &KafkaMessenger{Topic: "transactions", Logger: slog.New(slog.NewJSONHandler(records, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+
+		logger, errorLogger := m.kafkaLoggers()
+		logger.Printf("fetched %d messages", 3)
+		errorLogger.Printf("leader not available")
+
+		logged := records.Decode(t)
+		if len(logged) != 2 || logged[0]["level"] != "DEBUG" || logged[0]["msg"] != "fetched 3 messages" || logged[1]["level"] != "WARN" {
+			t.Errorf("expected a debug record and a warning, got %v", logged)
+		}
+	})
+
+	t.Run("should log structured fields", func(t *testing.T) {
+		records := &logRecords{}
+		broker := NewMemoryBroker(1)
+		messenger, err := broker.NewMessenger("transactions", "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+		messenger.Logger = slog.New(slog.NewJSONHandler(records, nil))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		messenger.ProduceMessage(ctx, "account-1", "payload")
+
+		failed := false
+		messenger.Consume(ctx, func(ctx context.Context, msg Message) error {
+			if !failed {
+				failed = true
+				return errors.New("temporary failure")
+			}
+			cancel()
+			return nil
+		})
+
+		var retry map[string]any
+		for _, record := range records.Decode(t) {
+			if record["msg"] == "handler failed, retrying" {
+				retry = record
+			}
+		}
+		expected := map[string]any{"topic": "transactions", "group": "account_management", "partition": 0.0, "offset": 0.0, "key": "account-1", "attempt": 1.0, "error": "temporary failure"}
+		for field, value := range expected {
+			if retry[field] != value {
+				t.Errorf("expected %s to be %v, got %v in %v", field, value, retry[field], retry)
+			}
+		}
+	})
+}
+
+// logRecords collects JSON log records.
+type logRecords struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (r *logRecords) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Write(p)
+}
+
+func (r *logRecords) Decode(t *testing.T) []map[string]any {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(r.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
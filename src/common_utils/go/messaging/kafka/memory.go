@@ -0,0 +1,549 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const defaultMemoryPartitions = 3
+
+// ErrNoGroup is returned when starting a consumer, or committing offsets on a MemoryBroker messenger,
+// without a group ID.
+var ErrNoGroup = errors.New("unavailable when GroupID is not set")
+
+// MemoryBroker is an in-process stand-in for a Kafka cluster, for unit tests and local development.
+//
+// It keeps partitioned, append-only topics, and tracks consumer groups the way Kafka does: the
+// partitions of a topic are spread over the members of a group, offsets are committed per group
+// and partition, and when members join or leave the group the partitions are reassigned and
+// consumption resumes from the last committed offsets, redelivering uncommitted messages.
+type MemoryBroker struct {
+	mu                sync.Mutex
+	changed           chan struct{}
+	defaultPartitions int
+	balancer          kafka.Balancer
+	topics            map[string][][]kafka.Message
+	groups            map[memoryGroupKey]*memoryGroup
+}
+
+type memoryGroupKey struct {
+	group string
+	topic string
+}
+
+type memoryGroup struct {
+	generation int
+	members    []*memoryReader
+	committed  map[int]int64
+}
+
+// NewMemoryBroker creates an empty MemoryBroker. Topics are created on first use with the given
+// number of partitions, or 3 if partitions is not positive.
+//
+// Example usage:
+//
+//	broker := NewMemoryBroker(3)
+//	messenger, err := broker.NewMessenger("transactions", "account_management")
+//	if err != nil {
+//	  t.Fatal(err)
+//	}
+//	defer messenger.Close()
+func NewMemoryBroker(partitions int) *MemoryBroker {
+	if partitions <= 0 {
+		partitions = defaultMemoryPartitions
+	}
+	return &MemoryBroker{
+		changed:           make(chan struct{}),
+		defaultPartitions: partitions,
+		balancer:          &kafka.Hash{},
+		topics:            make(map[string][][]kafka.Message),
+		groups:            make(map[memoryGroupKey]*memoryGroup),
+	}
+}
+
+// NewMessenger creates a KafkaMessenger that produces to and consumes from the broker's topic,
+// creating the topic if it does not exist yet. The messenger joins its consumer group when it
+// starts consuming, and leaves it when it is closed.
+//
+// Parameters:
+//   - topic: the name of the topic to produce and consume messages from
+//   - groupID: the consumer group; if empty, the messenger reads every partition from the start and cannot commit
+//   - opts: optional settings; only those unrelated to the connection, such as WithLogger, WithBackpressure
+//     or WithTracerProvider, apply
+//
+// Returns:
+//   - *KafkaMessenger: a new KafkaMessenger backed by the broker
+//   - error: an error if the topic is empty
+func (b *MemoryBroker) NewMessenger(topic, groupID string, opts ...Option) (*KafkaMessenger, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("topic is empty")
+	}
+	b.CreateTopic(topic, b.defaultPartitions)
+
+	o := newOptions(opts)
+	messenger := newMessenger(topic, groupID, nil, o)
+	messenger.producer = &memoryWriter{broker: b, topic: topic}
+	messenger.consumer = &memoryReader{broker: b, topic: topic, groupID: groupID, listener: o.rebalanceListener, generation: -1}
+	messenger.inspector = memoryInspector{broker: b}
+	if err := messenger.startSpool(o); err != nil {
+		return nil, err
+	}
+	return messenger, nil
+}
+
+// NewDumper creates a Dumper that reads the broker's topics.
+func (b *MemoryBroker) NewDumper() *Dumper {
+	return &Dumper{source: memoryTopicReader{broker: b}}
+}
+
+// NewTable creates a Table of the broker's topic, creating the topic if it does not exist yet.
+// Only the WithStateFile and WithLogger options apply.
+func (b *MemoryBroker) NewTable(topic string, opts ...Option) (*Table, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("topic is empty")
+	}
+	b.CreateTopic(topic, b.defaultPartitions)
+	return newTable(topic, memoryTopicReader{broker: b}, newOptions(opts))
+}
+
+// CreateTopic creates a topic with the given number of partitions. It does nothing if the topic already exists.
+func (b *MemoryBroker) CreateTopic(topic string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.createTopic(topic, partitions)
+}
+
+// Messages returns every message of the topic, ordered by partition and offset.
+func (b *MemoryBroker) Messages(topic string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var messages []Message
+	for _, partition := range b.topics[topic] {
+		for _, msg := range partition {
+			messages = append(messages, fromKafkaMessage(msg))
+		}
+	}
+	return messages
+}
+
+// CommittedOffset returns the next offset the group will consume from the topic's partition,
+// or -1 if the group has not committed any offset for it.
+func (b *MemoryBroker) CommittedOffset(groupID, topic string, partition int) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group, ok := b.groups[memoryGroupKey{group: groupID, topic: topic}]
+	if !ok {
+		return -1
+	}
+	offset, ok := group.committed[partition]
+	if !ok {
+		return -1
+	}
+	return offset
+}
+
+func (b *MemoryBroker) createTopic(topic string, partitions int) [][]kafka.Message {
+	if existing, ok := b.topics[topic]; ok {
+		return existing
+	}
+	if partitions <= 0 {
+		partitions = b.defaultPartitions
+	}
+	b.topics[topic] = make([][]kafka.Message, partitions)
+	return b.topics[topic]
+}
+
+func (b *MemoryBroker) write(topic string, msgs ...kafka.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range msgs {
+		msgTopic := topic
+		if msg.Topic != "" {
+			msgTopic = msg.Topic
+		}
+		if msgTopic == "" {
+			return fmt.Errorf("topic is empty")
+		}
+
+		partitions := b.createTopic(msgTopic, b.defaultPartitions)
+		available := make([]int, len(partitions))
+		for i := range available {
+			available[i] = i
+		}
+		partition := b.balancer.Balance(msg, available...)
+
+		msg.Topic = msgTopic
+		msg.Partition = partition
+		msg.Offset = int64(len(partitions[partition]))
+		if msg.Time.IsZero() {
+			msg.Time = time.Now()
+		}
+		partitions[partition] = append(partitions[partition], msg)
+	}
+	b.notify()
+	return nil
+}
+
+// group returns the consumer group of the topic, creating it if needed. It must be called with mu held.
+func (b *MemoryBroker) group(groupID, topic string) *memoryGroup {
+	key := memoryGroupKey{group: groupID, topic: topic}
+	group, ok := b.groups[key]
+	if !ok {
+		group = &memoryGroup{committed: make(map[int]int64)}
+		b.groups[key] = group
+	}
+	return group
+}
+
+// notify wakes up every reader waiting for the broker to change. It must be called with mu held.
+func (b *MemoryBroker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// memoryWriter implements messageWriter on top of a MemoryBroker.
+type memoryWriter struct {
+	broker *MemoryBroker
+	topic  string
+}
+
+func (w *memoryWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.broker.write(w.topic, msgs...)
+}
+
+func (w *memoryWriter) Close() error {
+	return nil
+}
+
+// memoryReader implements messageReader on top of a MemoryBroker, as one member of a consumer group.
+type memoryReader struct {
+	broker   *MemoryBroker
+	topic    string
+	groupID  string
+	listener *RebalanceListener
+
+	// The fields below are guarded by broker.mu.
+	joined     bool
+	closed     bool
+	generation int
+	assigned   []int
+	positions  map[int]int64
+	next       int
+	// revoked and newlyAssigned are the partitions to notify the listener of.
+	revoked       []TopicPartition
+	newlyAssigned []TopicPartition
+}
+
+func (r *memoryReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return kafka.Message{}, err
+		}
+
+		r.broker.mu.Lock()
+		if r.closed {
+			r.broker.mu.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+		r.join()
+		r.rebalance()
+		if revoked, assigned := r.rebalanced(); len(revoked) > 0 || len(assigned) > 0 {
+			r.broker.mu.Unlock()
+			r.listener.notifyRevoked(ctx, revoked)
+			r.listener.notifyAssigned(ctx, assigned)
+			continue
+		}
+
+		if msg, ok := r.nextMessage(); ok {
+			r.broker.mu.Unlock()
+			return msg, nil
+		}
+		changed := r.broker.changed
+		r.broker.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		}
+	}
+}
+
+func (r *memoryReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if r.groupID == "" {
+		return ErrNoGroup
+	}
+
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	group := r.broker.group(r.groupID, r.topic)
+	for _, msg := range msgs {
+		if committed, ok := group.committed[msg.Partition]; !ok || msg.Offset+1 > committed {
+			group.committed[msg.Partition] = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+func (r *memoryReader) Close() error {
+	r.broker.mu.Lock()
+	revoked := r.close()
+	r.broker.mu.Unlock()
+
+	r.listener.notifyRevoked(context.Background(), revoked)
+	return nil
+}
+
+// close leaves the consumer group and returns the partitions the reader loses. It must be called
+// with broker.mu held.
+func (r *memoryReader) close() []TopicPartition {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	var revoked []TopicPartition
+	if r.joined && r.groupID != "" {
+		if r.listener != nil {
+			revoked = r.partitionsOf(r.assigned)
+		}
+		r.assigned = nil
+		group := r.broker.group(r.groupID, r.topic)
+		for i, member := range group.members {
+			if member == r {
+				group.members = append(group.members[:i], group.members[i+1:]...)
+				break
+			}
+		}
+		group.generation++
+	}
+	r.broker.notify()
+	return revoked
+}
+
+// join adds the reader to its consumer group on first use. It must be called with broker.mu held.
+func (r *memoryReader) join() {
+	if r.joined {
+		return
+	}
+	r.joined = true
+	if r.groupID != "" {
+		group := r.broker.group(r.groupID, r.topic)
+		group.members = append(group.members, r)
+		group.generation++
+		r.broker.notify()
+	}
+}
+
+// rebalance recomputes the reader's partitions when its group's generation changed, resuming each
+// partition from the group's committed offset. It must be called with broker.mu held.
+func (r *memoryReader) rebalance() {
+	partitions := len(r.broker.topics[r.topic])
+
+	if r.groupID == "" {
+		if r.positions == nil {
+			r.positions = make(map[int]int64)
+		}
+		r.assigned = r.assigned[:0]
+		for partition := 0; partition < partitions; partition++ {
+			r.assigned = append(r.assigned, partition)
+		}
+		return
+	}
+
+	group := r.broker.group(r.groupID, r.topic)
+	if group.generation == r.generation {
+		return
+	}
+	r.generation = group.generation
+	if r.listener != nil {
+		r.revoked = append(r.revoked, r.partitionsOf(r.assigned)...)
+	}
+
+	member := 0
+	for i, m := range group.members {
+		if m == r {
+			member = i
+		}
+	}
+	r.assigned = r.assigned[:0]
+	r.positions = make(map[int]int64)
+	for partition := 0; partition < partitions; partition++ {
+		if partition%len(group.members) != member {
+			continue
+		}
+		r.assigned = append(r.assigned, partition)
+		if committed, ok := group.committed[partition]; ok {
+			r.positions[partition] = committed
+		}
+	}
+	sort.Ints(r.assigned)
+	if r.listener != nil {
+		r.newlyAssigned = r.partitionsOf(r.assigned)
+	}
+}
+
+// rebalanced returns and forgets the partitions revoked and assigned by the last rebalances, to
+// notify the listener of. It must be called with broker.mu held.
+func (r *memoryReader) rebalanced() (revoked, assigned []TopicPartition) {
+	revoked, assigned = r.revoked, r.newlyAssigned
+	r.revoked, r.newlyAssigned = nil, nil
+	return revoked, assigned
+}
+
+func (r *memoryReader) assignments() []TopicPartition {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	if r.listener == nil || r.groupID == "" {
+		return nil
+	}
+	return r.partitionsOf(r.assigned)
+}
+
+// partitionsOf returns the given partitions of the reader's topic.
+func (r *memoryReader) partitionsOf(partitions []int) []TopicPartition {
+	var tps []TopicPartition
+	for _, partition := range partitions {
+		tps = append(tps, TopicPartition{Topic: r.topic, Partition: partition})
+	}
+	return tps
+}
+
+// nextMessage returns the next unread message of the assigned partitions, taking partitions in turns.
+// It must be called with broker.mu held.
+func (r *memoryReader) nextMessage() (kafka.Message, bool) {
+	partitions := r.broker.topics[r.topic]
+	for i := range r.assigned {
+		partition := r.assigned[(r.next+i)%len(r.assigned)]
+		position := r.positions[partition]
+		if position < int64(len(partitions[partition])) {
+			r.positions[partition] = position + 1
+			r.next = (r.next + i + 1) % len(r.assigned)
+			msg := partitions[partition][position]
+			msg.HighWaterMark = int64(len(partitions[partition]))
+			return msg, true
+		}
+	}
+	return kafka.Message{}, false
+}
+
+// memoryInspector reports the state of a MemoryBroker in a HealthStatus.
+type memoryInspector struct {
+	broker *MemoryBroker
+}
+
+func (i memoryInspector) inspect(ctx context.Context, status *HealthStatus) {
+	i.broker.mu.Lock()
+	defer i.broker.mu.Unlock()
+
+	status.Broker, status.BrokerReachable = "memory", true
+	status.Controller, status.ControllerFound = "memory", true
+	topics := topicsOf(status)
+	for _, topic := range topics {
+		partitions := len(i.broker.topics[topic])
+		if partitions == 0 {
+			status.TopicPartitions = 0
+			break
+		}
+		status.TopicPartitions += partitions
+	}
+	if status.GroupID == "" {
+		return
+	}
+	// The members of a multi-topic consumer join the groups of all its topics at once.
+	if group, ok := i.broker.groups[memoryGroupKey{group: status.GroupID, topic: topics[0]}]; ok && len(group.members) > 0 {
+		status.GroupState = groupStable
+		status.GroupMembers = len(group.members)
+	} else {
+		status.GroupState = "Empty"
+	}
+}
+
+// memoryTopicReader implements topicReader on top of a MemoryBroker.
+type memoryTopicReader struct {
+	broker *MemoryBroker
+}
+
+func (r memoryTopicReader) partitions(ctx context.Context, topic string) ([]PartitionInfo, error) {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	partitions, ok := r.broker.topics[topic]
+	if !ok {
+		return nil, fmt.Errorf("topic %s: %w", topic, kafka.UnknownTopicOrPartition)
+	}
+	infos := make([]PartitionInfo, len(partitions))
+	for i, messages := range partitions {
+		infos[i] = PartitionInfo{ID: i, LastOffset: int64(len(messages))}
+	}
+	return infos, nil
+}
+
+func (r memoryTopicReader) offsetAt(ctx context.Context, topic string, partition PartitionInfo, t time.Time) (int64, error) {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	messages := r.broker.topics[topic][partition.ID]
+	for _, msg := range messages {
+		if !msg.Time.Before(t) {
+			return msg.Offset, nil
+		}
+	}
+	return int64(len(messages)), nil
+}
+
+func (r memoryTopicReader) open(topic string, partition int, offset int64) (partitionReader, error) {
+	return &memoryPartitionReader{broker: r.broker, topic: topic, partition: partition, offset: offset}, nil
+}
+
+// memoryPartitionReader implements partitionReader on top of a MemoryBroker.
+type memoryPartitionReader struct {
+	broker    *MemoryBroker
+	topic     string
+	partition int
+	offset    int64
+}
+
+func (r *memoryPartitionReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return kafka.Message{}, err
+		}
+
+		r.broker.mu.Lock()
+		messages := r.broker.topics[r.topic][r.partition]
+		if r.offset < int64(len(messages)) {
+			msg := messages[r.offset]
+			r.offset++
+			r.broker.mu.Unlock()
+			return msg, nil
+		}
+		changed := r.broker.changed
+		r.broker.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		}
+	}
+}
+
+func (r *memoryPartitionReader) Close() error {
+	return nil
+}
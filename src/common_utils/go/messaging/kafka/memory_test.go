@@ -0,0 +1,265 @@
+//go:build unit
+
+package kafka_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+)
+
+func TestMemoryBrokerPartitions(t *testing.T) {
+	broker := kafka.NewMemoryBroker(3)
+	messenger := newMemoryMessenger(t, broker, "transactions", "")
+
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("account-%d", i%3)
+		if err := messenger.ProduceMessage(context.Background(), key, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	partitionOf := make(map[string]int)
+	lastOffset := make(map[int]int64)
+	for _, msg := range broker.Messages("transactions") {
+		if partition, ok := partitionOf[msg.Key]; ok && partition != msg.Partition {
+			t.Errorf("expected key %s to stay on partition %d, got %d", msg.Key, partition, msg.Partition)
+		}
+		partitionOf[msg.Key] = msg.Partition
+		if last, ok := lastOffset[msg.Partition]; ok && msg.Offset != last+1 {
+			t.Errorf("expected contiguous offsets on partition %d, got %d after %d", msg.Partition, msg.Offset, last)
+		}
+		lastOffset[msg.Partition] = msg.Offset
+	}
+	if len(broker.Messages("transactions")) != 30 {
+		t.Errorf("expected 30 messages, got %d", len(broker.Messages("transactions")))
+	}
+}
+
+func TestMemoryBrokerConsumerGroups(t *testing.T) {
+	t.Run("should split partitions between the members of a group", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(4)
+		first := newMemoryMessenger(t, broker, "transactions", "account_management")
+		second := newMemoryMessenger(t, broker, "transactions", "account_management")
+
+		handled := newHandledMessages()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go first.Consume(ctx, handled.Handler("first"))
+		go second.Consume(ctx, handled.Handler("second"))
+
+		time.Sleep(10 * time.Millisecond)
+		produceMessages(t, first, 40)
+		handled.WaitFor(t, 40)
+
+		partitionsOf := handled.PartitionsByConsumer()
+		if len(partitionsOf["first"]) == 0 || len(partitionsOf["second"]) == 0 {
+			t.Errorf("expected both members to get partitions, got %v", partitionsOf)
+		}
+		for partition := range partitionsOf["first"] {
+			if partitionsOf["second"][partition] {
+				t.Errorf("expected partition %d to be assigned to a single member", partition)
+			}
+		}
+	})
+
+	t.Run("should deliver every message to every group", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(3)
+		accounts := newMemoryMessenger(t, broker, "transactions", "account_management")
+		reports := newMemoryMessenger(t, broker, "transactions", "reporting")
+
+		handledByAccounts, handledByReports := newHandledMessages(), newHandledMessages()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go accounts.Consume(ctx, handledByAccounts.Handler("accounts"))
+		go reports.Consume(ctx, handledByReports.Handler("reports"))
+
+		produceMessages(t, accounts, 10)
+		handledByAccounts.WaitFor(t, 10)
+		handledByReports.WaitFor(t, 10)
+	})
+
+	t.Run("should resume from the committed offsets", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		first := newMemoryMessenger(t, broker, "transactions", "account_management")
+
+		produceMessages(t, first, 5)
+		handled := newHandledMessages()
+		ctx, cancel := context.WithCancel(context.Background())
+		go first.Consume(ctx, handled.Handler("first"))
+		handled.WaitFor(t, 5)
+		cancel()
+		if err := first.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if offset := broker.CommittedOffset("account_management", "transactions", 0); offset != 5 {
+			t.Errorf("expected committed offset 5, got %d", offset)
+		}
+
+		second := newMemoryMessenger(t, broker, "transactions", "account_management")
+		produceMessages(t, second, 5)
+		resumed := newHandledMessages()
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		go second.Consume(ctx, resumed.Handler("second"))
+		resumed.WaitFor(t, 5)
+
+		for _, msg := range resumed.Messages() {
+			if msg.Offset < 5 {
+				t.Errorf("expected only new messages, got offset %d", msg.Offset)
+			}
+		}
+	})
+
+	t.Run("should redeliver uncommitted messages after a rebalance", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		first := newMemoryMessenger(t, broker, "transactions", "account_management")
+		second := newMemoryMessenger(t, broker, "transactions", "account_management")
+
+		produceMessages(t, first, 1)
+		started := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			first.Consume(context.Background(), func(ctx context.Context, msg kafka.Message) error {
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			})
+		}()
+		<-started
+
+		handled := newHandledMessages()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go second.Consume(ctx, handled.Handler("second"))
+
+		if err := first.StopConsumer(); err != nil {
+			t.Fatal(err)
+		}
+		<-stopped
+		if err := first.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		handled.WaitFor(t, 1)
+		if msg := handled.Messages()[0]; msg.Offset != 0 {
+			t.Errorf("expected offset 0 to be redelivered, got %d", msg.Offset)
+		}
+	})
+}
+
+func TestMemoryBrokerTypedPubSub(t *testing.T) {
+	broker := kafka.NewMemoryBroker(3)
+	messenger := newMemoryMessenger(t, broker, "transactions", "account_management")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, errs, err := kafka.Subscribe[TransactionCreated](ctx, messenger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer messenger.StopConsumer()
+
+	envelope := kafka.NewEnvelope("TransactionCreated", "transaction_management", TransactionCreated{ID: 1, AccountID: 2, Amount: 10.5, Currency: "BRL"})
+	if err := kafka.Publish(ctx, messenger, "2", envelope); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case received := <-events:
+		if received.ID != envelope.ID || received.Payload != envelope.Payload {
+			t.Errorf("expected envelope %+v, got %+v", envelope, received)
+		}
+	case err := <-errs:
+		t.Fatal(err)
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+}
+
+func newMemoryMessenger(t *testing.T, broker *kafka.MemoryBroker, topic, groupID string) *kafka.KafkaMessenger {
+	t.Helper()
+
+	messenger, err := broker.NewMessenger(topic, groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { messenger.Close() })
+	return messenger
+}
+
+func produceMessages(t *testing.T, publisher kafka.Publisher, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		if err := publisher.ProduceMessage(context.Background(), fmt.Sprintf("key-%d", i), fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// handledMessages records the messages handled by one or more consumers.
+type handledMessages struct {
+	mu         sync.Mutex
+	messages   []kafka.Message
+	consumedBy []string
+}
+
+func newHandledMessages() *handledMessages {
+	return &handledMessages{}
+}
+
+func (h *handledMessages) Handler(consumer string) kafka.Handler {
+	return func(ctx context.Context, msg kafka.Message) error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		h.messages = append(h.messages, msg)
+		h.consumedBy = append(h.consumedBy, consumer)
+		return nil
+	}
+}
+
+func (h *handledMessages) Messages() []kafka.Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]kafka.Message(nil), h.messages...)
+}
+
+func (h *handledMessages) PartitionsByConsumer() map[string]map[int]bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	partitions := make(map[string]map[int]bool)
+	for i, msg := range h.messages {
+		if partitions[h.consumedBy[i]] == nil {
+			partitions[h.consumedBy[i]] = make(map[int]bool)
+		}
+		partitions[h.consumedBy[i]][msg.Partition] = true
+	}
+	return partitions
+}
+
+func (h *handledMessages) WaitFor(t *testing.T, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(h.Messages()) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d handled messages, got %d", count, len(h.Messages()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if handled := len(h.Messages()); handled != count {
+		t.Errorf("expected exactly %d handled messages, got %d", count, handled)
+	}
+}
@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Header is a key/value pair attached to a Kafka message.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message is a Kafka message together with the metadata the broker delivered it with.
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       string
+	Value     []byte
+	Headers   []Header
+	Time      time.Time
+}
+
+// Header returns the value of the first header with the given key.
+//
+// Parameters:
+//   - key: the header key to look up
+//
+// Returns:
+//   - string: the header value, or an empty string if the header is not present
+//   - bool: whether the header is present
+func (m Message) Header(key string) (string, bool) {
+	for _, header := range m.Headers {
+		if header.Key == key {
+			return string(header.Value), true
+		}
+	}
+	return "", false
+}
+
+// ProduceOption customizes a message before ProduceMessage writes it.
+type ProduceOption func(msg *kafka.Message)
+
+// WithHeaders attaches the given headers to the produced message.
+func WithHeaders(headers ...Header) ProduceOption {
+	return func(msg *kafka.Message) {
+		for _, header := range headers {
+			msg.Headers = append(msg.Headers, kafka.Header{Key: header.Key, Value: header.Value})
+		}
+	}
+}
+
+// WithHeader attaches a single string header to the produced message.
+func WithHeader(key, value string) ProduceOption {
+	return WithHeaders(Header{Key: key, Value: []byte(value)})
+}
+
+// WithTimestamp sets an explicit timestamp on the produced message instead of the time it is written.
+func WithTimestamp(timestamp time.Time) ProduceOption {
+	return func(msg *kafka.Message) {
+		msg.Time = timestamp
+	}
+}
+
+// ToTopic produces the message to the given topic instead of the messenger's own topic.
+func ToTopic(topic string) ProduceOption {
+	return func(msg *kafka.Message) {
+		msg.Topic = topic
+	}
+}
+
+func fromKafkaMessage(msg kafka.Message) Message {
+	message := Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       string(msg.Key),
+		Value:     msg.Value,
+		Time:      msg.Time,
+	}
+	if len(msg.Headers) > 0 {
+		message.Headers = make([]Header, len(msg.Headers))
+		for i, header := range msg.Headers {
+			message.Headers[i] = Header{Key: header.Key, Value: header.Value}
+		}
+	}
+	return message
+}
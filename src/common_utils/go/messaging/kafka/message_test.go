@@ -0,0 +1,61 @@
+//go:build unit
+
+package kafka_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+	segmentio "github.com/segmentio/kafka-go"
+)
+
+func TestMessageHeader(t *testing.T) {
+	message := kafka.Message{Headers: []kafka.Header{
+		{Key: "traceparent", Value: []byte("00-abc-def-01")},
+		{Key: "source", Value: []byte("first")},
+		{Key: "source", Value: []byte("second")},
+	}}
+
+	t.Run("should return the first matching header", func(t *testing.T) {
+		value, ok := message.Header("source")
+		if !ok {
+			t.Fatal("expected header to be present")
+		}
+		if value != "first" {
+			t.Errorf("expected first, got %s", value)
+		}
+	})
+
+	t.Run("should report missing headers", func(t *testing.T) {
+		if value, ok := message.Header("missing"); ok || value != "" {
+			t.Errorf("expected missing header, got %q", value)
+		}
+	})
+}
+
+func TestProduceOptions(t *testing.T) {
+	timestamp := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	msg := segmentio.Message{}
+
+	for _, opt := range []kafka.ProduceOption{
+		kafka.WithHeader("source", "category_management"),
+		kafka.WithHeaders(kafka.Header{Key: "a", Value: []byte("1")}, kafka.Header{Key: "b", Value: []byte("2")}),
+		kafka.WithTimestamp(timestamp),
+	} {
+		opt(&msg)
+	}
+
+	expected := []segmentio.Header{
+		{Key: "source", Value: []byte("category_management")},
+		{Key: "a", Value: []byte("1")},
+		{Key: "b", Value: []byte("2")},
+	}
+	if fmt.Sprint(msg.Headers) != fmt.Sprint(expected) {
+		t.Errorf("expected headers %v, got %v", expected, msg.Headers)
+	}
+	if !msg.Time.Equal(timestamp) {
+		t.Errorf("expected timestamp %s, got %s", timestamp, msg.Time)
+	}
+}
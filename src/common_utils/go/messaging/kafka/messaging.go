@@ -5,25 +5,51 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	kafka "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type KafkaMessenger struct {
-	Topic           string
+	Topic string
+	// Topics lists the topics of a consumer created with NewMultiTopicConsumer or NewPatternConsumer.
+	// Topic is then their comma-separated list, which labels its logs and metrics.
+	Topics          []string
 	GroupID         string
 	BrokerAddresses []string
-
-	producer *kafka.Writer
-	consumer *kafka.Reader
-
-	messageChannel chan string
-	errorChannel   chan error
-	consumerCancel context.CancelFunc
-	consumerDone   chan struct{}
+	// Backpressure decides what the consumer started by StartConsumer does while its channel is full.
+	// The zero value blocks until there is room.
+	Backpressure BackpressurePolicy
+	// Logger receives the messenger's logs, with the topic and group as fields.
+	// If nil, only warnings and errors are logged, through slog.Default.
+	Logger *slog.Logger
+
+	producer messageWriter
+	consumer messageReader
+	dialer   *kafka.Dialer
+
+	inspector    clusterInspector
+	lastFetch    atomic.Int64
+	handlerCalls handlerCalls
+	stallTimeout time.Duration
+
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+	metrics        *Metrics
+	async          *asyncProducer
+	breaker        *circuitBreaker
+	spool          *producerSpool
+	shutdownAfter  time.Duration
+
+	mu     sync.Mutex
+	run    *consumerRun
+	closed bool
 }
 
 const (
@@ -34,8 +60,8 @@ const (
 )
 
 // NewKafkaMessenger creates a new KafkaMessenger with the given topic, group ID, and broker address.
-// It ensures the topic exists with the default number of partitions and replication factor, and
-// sets up a producer and consumer for the topic.
+// It ensures the topic exists (unless disabled with WithAutoCreateTopics), and sets up a producer
+// and consumer for the topic. Use NewProducer or NewConsumer when only one side is needed.
 // If the topic cannot be created or there is a problem communicating with the kafka broker,
 // it returns an error.
 //
@@ -43,6 +69,7 @@ const (
 //   - topic: the name of the Kafka topic to produce and consume messages from
 //   - groupID: the group ID for the Kafka consumer
 //   - brokerAddress: the address of the Kafka broker to connect to
+//   - opts: optional settings for the topic, the producer and the consumer
 //
 // Returns:
 //   - *KafkaMessenger: a new KafkaMessenger instance
@@ -55,7 +82,7 @@ const (
 //	  log.Fatal(err)
 //	}
 //	defer messenger.Close()
-func NewKafkaMessenger(topic string, groupID string, brokerAddresses []string) (*KafkaMessenger, error) {
+func NewKafkaMessenger(topic string, groupID string, brokerAddresses []string, opts ...Option) (*KafkaMessenger, error) {
 	if len(brokerAddresses) == 0 {
 		return nil, fmt.Errorf("broker address is empty")
 	}
@@ -63,63 +90,222 @@ func NewKafkaMessenger(topic string, groupID string, brokerAddresses []string) (
 		return nil, fmt.Errorf("topic is empty")
 	}
 
-	messenger := &KafkaMessenger{
+	o := newOptions(opts)
+	conn, err := newConnection(o)
+	if err != nil {
+		return nil, err
+	}
+	messenger := newMessenger(topic, groupID, brokerAddresses, o)
+	messenger.dialer = conn.dialer
+	messenger.inspector = newKafkaInspector(brokerAddresses, conn)
+	messenger.producer = messenger.newWriter(o, conn)
+	if messenger.consumer, err = messenger.newConsumer(o, conn); err != nil {
+		if closeErr := messenger.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+		return nil, err
+	}
+
+	if err := messenger.startSpool(o); err != nil {
+		return nil, err
+	}
+	if err := messenger.ensureTopic(o); err != nil {
+		return nil, err
+	}
+	return messenger, nil
+}
+
+// NewProducer creates a KafkaMessenger that can only produce messages.
+// It is not tied to a single topic: the default topic set with WithTopic can be overridden
+// per message with ToTopic. The default topic, if any, is created unless disabled with
+// WithAutoCreateTopics.
+//
+// Parameters:
+//   - brokerAddresses: the addresses of the Kafka brokers to connect to
+//   - opts: optional settings for the topic and the producer
+//
+// Returns:
+//   - *KafkaMessenger: a new producer-only KafkaMessenger
+//   - error: an error if the topic cannot be created or if there is a problem communicating with the kafka broker
+//
+// Example usage:
+//
+//	producer, err := NewProducer(brokers, WithTopic("transactions"), WithCompression(CompressionSnappy))
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer producer.Close()
+//	err = producer.ProduceMessage(ctx, key, message, ToTopic("audit"))
+func NewProducer(brokerAddresses []string, opts ...Option) (*KafkaMessenger, error) {
+	if len(brokerAddresses) == 0 {
+		return nil, fmt.Errorf("broker address is empty")
+	}
+
+	o := newOptions(opts)
+	conn, err := newConnection(o)
+	if err != nil {
+		return nil, err
+	}
+	producer := newMessenger(o.topic, "", brokerAddresses, o)
+	producer.dialer = conn.dialer
+	producer.inspector = newKafkaInspector(brokerAddresses, conn)
+	producer.producer = producer.newWriter(o, conn)
+
+	if err := producer.startSpool(o); err != nil {
+		return nil, err
+	}
+	if producer.Topic != "" {
+		if err := producer.ensureTopic(o); err != nil {
+			return nil, err
+		}
+	}
+	return producer, nil
+}
+
+// NewConsumer creates a KafkaMessenger that can only consume messages of the given topic as a member
+// of the given consumer group. The topic is created unless disabled with WithAutoCreateTopics.
+//
+// Parameters:
+//   - topic: the name of the Kafka topic to consume messages from
+//   - groupID: the group ID for the Kafka consumer
+//   - brokerAddresses: the addresses of the Kafka brokers to connect to
+//   - opts: optional settings for the topic and the consumer
+//
+// Returns:
+//   - *KafkaMessenger: a new consumer-only KafkaMessenger
+//   - error: an error if the topic cannot be created or if there is a problem communicating with the kafka broker
+//
+// Example usage:
+//
+//	consumer, err := NewConsumer("transactions", "account_management", brokers, WithStartOffset(StartFromLast))
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer consumer.Close()
+func NewConsumer(topic, groupID string, brokerAddresses []string, opts ...Option) (*KafkaMessenger, error) {
+	if len(brokerAddresses) == 0 {
+		return nil, fmt.Errorf("broker address is empty")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("topic is empty")
+	}
+	if groupID == "" {
+		return nil, fmt.Errorf("group ID is empty")
+	}
+
+	o := newOptions(opts)
+	conn, err := newConnection(o)
+	if err != nil {
+		return nil, err
+	}
+	consumer := newMessenger(topic, groupID, brokerAddresses, o)
+	consumer.dialer = conn.dialer
+	consumer.inspector = newKafkaInspector(brokerAddresses, conn)
+	if consumer.consumer, err = consumer.newConsumer(o, conn); err != nil {
+		return nil, err
+	}
+
+	if err := consumer.ensureTopic(o); err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// newMessenger creates a messenger with the settings shared by every constructor, without its producer and consumer.
+func newMessenger(topic, groupID string, brokerAddresses []string, o options) *KafkaMessenger {
+	return &KafkaMessenger{
 		Topic:           topic,
 		GroupID:         groupID,
 		BrokerAddresses: brokerAddresses,
+		Backpressure:    o.backpressure,
+		Logger:          o.logger,
+		tracerProvider:  o.tracerProvider,
+		propagator:      o.propagator,
+		metrics:         o.metrics,
+		async:           newAsyncProducer(o),
+		breaker:         newProducerBreaker(o),
+		shutdownAfter:   o.drainTimeout,
+		stallTimeout:    o.stallTimeout,
 	}
+}
 
-	messenger.producer = kafka.NewWriter(kafka.WriterConfig{
-		Brokers: brokerAddresses,
-		Topic:   topic,
-		Logger: kafka.LoggerFunc(func(s string, i ...interface{}) {
-			log.Printf("[DEBUG] "+s, i...)
-		}),
-		ErrorLogger: kafka.LoggerFunc(func(s string, i ...interface{}) {
-			log.Printf("[ERROR] "+s, i...)
-		}),
-		BatchSize:    defaultBatchSize,
-		BatchTimeout: defaultBatchTimeout,
-	})
+func (m *KafkaMessenger) newWriter(o options, conn connection) *kafka.Writer {
+	logger, errorLogger := m.kafkaLoggers()
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(m.BrokerAddresses...),
+		Balancer:               &kafka.Hash{},
+		Logger:                 logger,
+		ErrorLogger:            errorLogger,
+		BatchSize:              o.batchSize,
+		BatchTimeout:           o.batchTimeout,
+		Compression:            o.compression,
+		RequiredAcks:           o.requiredAcks,
+		AllowAutoTopicCreation: o.autoCreateTopics,
+	}
+	if conn.transport != nil {
+		writer.Transport = conn.transport
+	}
+	m.metrics.trackWriter(writer, m.Topic)
+	return writer
+}
 
-	messenger.consumer = kafka.NewReader(kafka.ReaderConfig{
-		Brokers: brokerAddresses,
-		Topic:   topic,
-		GroupID: groupID,
-		Logger: kafka.LoggerFunc(func(s string, i ...interface{}) {
-			log.Printf("[DEBUG] "+s, i...)
-		}),
-		ErrorLogger: kafka.LoggerFunc(func(s string, i ...interface{}) {
-			log.Printf("[ERROR] "+s, i...)
-		}),
-		QueueCapacity: 100,
-		StartOffset:   kafka.FirstOffset,
-		RetentionTime: time.Hour * 24 * 7,
-		HeartbeatInterval: 3 * time.Second,
-		SessionTimeout: 30 * time.Second,
-		MaxAttempts: 5,
+func (m *KafkaMessenger) newReader(o options, conn connection) *kafka.Reader {
+	logger, errorLogger := m.kafkaLoggers()
+	topic := m.Topic
+	if len(m.Topics) > 0 {
+		topic = ""
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:           m.BrokerAddresses,
+		Topic:             topic,
+		GroupTopics:       m.Topics,
+		GroupID:           m.GroupID,
+		Dialer:            conn.dialer,
+		Logger:            logger,
+		ErrorLogger:       errorLogger,
+		QueueCapacity:     o.queueCapacity,
+		StartOffset:       int64(o.startOffset),
+		RetentionTime:     defaultRetentionTime,
+		HeartbeatInterval: o.heartbeatInterval,
+		SessionTimeout:    o.sessionTimeout,
+		MaxAttempts:       defaultReaderMaxAttempts,
 	})
+	m.metrics.trackReader(reader, m.Topic, m.GroupID)
+	return reader
+}
 
-	if err := messenger.EnsureTopicExists(defaultNumPartitions, defaultReplicationFactor); err != nil {
-		if closeErr := messenger.Close(); closeErr != nil {
-			err = fmt.Errorf("failed to close producer: %w", closeErr)
+// newConsumer creates the messenger's reader: a groupReader if a RebalanceListener is set and the
+// messenger has a group, a kafka.Reader otherwise.
+func (m *KafkaMessenger) newConsumer(o options, conn connection) (messageReader, error) {
+	if o.rebalanceListener != nil && m.GroupID != "" {
+		reader, err := m.newGroupReader(o, conn)
+		if err != nil {
+			return nil, err
 		}
-		if closeErr := messenger.consumer.Close(); closeErr != nil {
-			err = fmt.Errorf("failed to close consumer: %w", closeErr)
+		return reader, nil
+	}
+	return m.newReader(o, conn), nil
+}
+
+// ensureTopic creates the messenger's topic if auto-creation is enabled, closing the messenger if it fails.
+func (m *KafkaMessenger) ensureTopic(o options) error {
+	if !o.autoCreateTopics {
+		return nil
+	}
+	if err := m.EnsureTopicExists(o.numPartitions, o.replicationFactor); err != nil {
+		if closeErr := m.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
 		}
-		return nil, fmt.Errorf("failed to ensure topic %s: %w", topic, err)
+		return fmt.Errorf("failed to ensure topic %s: %w", m.Topic, err)
 	}
-	return messenger, nil
+	return nil
 }
 
-// Close closes the underlying Kafka producer and consumer.
-//
-// If the producer is not nil, it attempts to close the producer and logs an error if it fails.
-// If the consumer is not nil, it attempts to close the consumer and logs an error if it fails.
-// If any of the close operations fail, it returns an error that includes all the errors.
+// Close shuts the messenger down like Shutdown, with the drain timeout set with WithDrainTimeout
+// as its deadline.
 //
 // Returns:
-//   - error: an error if any of the close operations fail
+//   - error: an error if messages were not delivered or the Kafka clients failed to close
 //
 // Example usage:
 //
@@ -127,62 +313,149 @@ func NewKafkaMessenger(topic string, groupID string, brokerAddresses []string) (
 //	if err != nil {
 //	  log.Fatal(err)
 //	}
-func (m *KafkaMessenger) Close() (err error) {
-	if m.producer != nil {
-		log.Println("KAFKA-PRODUCER: Closing producer")
-		if closeErr := m.producer.Close(); closeErr != nil {
-			log.Printf("KAFKA-PRODUCER: Failed to close producer: %v", closeErr)
-			err = fmt.Errorf("failed to close producer: %w", closeErr)
-		}
-		m.producer = nil
-	}
-
-	if m.consumer != nil {
-		log.Println("KAFKA-CONSUMER: Closing consumer")
-		if closeErr := m.consumer.Close(); closeErr != nil {
-			log.Printf("KAFKA-CONSUMER: Failed to close consumer: %v", closeErr)
-			if err == nil {
-				err = fmt.Errorf("failed to close consumer: %w", closeErr)
-			} else {
-				err = fmt.Errorf("%w; and also failed to close consumer: %w", err, closeErr)
-			}
-		}
-		m.consumer = nil
+func (m *KafkaMessenger) Close() error {
+	timeout := m.shutdownAfter
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	return
+	_, err := m.Shutdown(ctx)
+	return err
 }
 
-// ProduceMessage produces a message to the Kafka topic associated with this messenger.
+// ProduceMessage produces a message to the Kafka topic associated with this messenger,
+// or to the topic chosen with ToTopic.
+// It blocks until the message is written, which may take up to the batch timeout; use PublishAsync
+// to publish without waiting.
 // Parameters:
 //   - ctx: the context to use for the write operation
 //   - key: the key to use for the message (may be empty)
 //   - message: the content of the message
+//   - opts: optional settings such as headers (WithHeaders), an explicit timestamp (WithTimestamp)
+//     or another destination topic (ToTopic)
 //
 // Returns:
 //   - error: an error if the message could not be written to the topic
 //
 // Example:
 //
-//	  err := messenger.ProduceMessage(context.Background(), "key", "message")
+//	  err := messenger.ProduceMessage(context.Background(), "key", "message", WithHeader("source", "category_management"))
 //	  if err != nil {
 //			handle error
 //	  }
-func (m *KafkaMessenger) ProduceMessage(ctx context.Context, key, message string) error {
+func (m *KafkaMessenger) ProduceMessage(ctx context.Context, key, message string, opts ...ProduceOption) error {
+	if m.producer == nil {
+		return fmt.Errorf("producer is not initialized")
+	}
+	if m.isClosed() {
+		return ErrProducerClosed
+	}
+
+	msg, err := m.newMessage(key, message, opts)
+	if err != nil {
+		return err
+	}
+	return m.produce(ctx, msg)
+}
+
+// Record is a message written by ProduceMessages.
+type Record struct {
+	Key     string
+	Value   string
+	Options []ProduceOption
+}
+
+// ProduceMessages writes records to Kafka in a single write, in order, so that they share the
+// batching delay instead of waiting for it one after another. The records of a partition are
+// written in the given order.
+//
+// Parameters:
+//   - ctx: the context to use for the write operation
+//   - records: the messages to write, with their options such as ToTopic
+//
+// Returns:
+//   - error: an error if the messages could not be written; some of them may have been written anyway
+//
+// Example usage:
+//
+//	err := messenger.ProduceMessages(ctx,
+//	  Record{Key: accountID, Value: created},
+//	  Record{Key: accountID, Value: updated, Options: []ProduceOption{ToTopic("audit")}},
+//	)
+func (m *KafkaMessenger) ProduceMessages(ctx context.Context, records ...Record) error {
 	if m.producer == nil {
 		return fmt.Errorf("producer is not initialized")
 	}
+	if m.isClosed() {
+		return ErrProducerClosed
+	}
+	if len(records) == 0 {
+		return nil
+	}
 
+	msgs := make([]kafka.Message, len(records))
+	for i, record := range records {
+		msg, err := m.newMessage(record.Key, record.Value, record.Options)
+		if err != nil {
+			return err
+		}
+		msgs[i] = msg
+	}
+	return m.produce(ctx, msgs...)
+}
+
+// produce writes msgs through the circuit breaker and, if the messenger has one, the spool.
+func (m *KafkaMessenger) produce(ctx context.Context, msgs ...kafka.Message) error {
+	if m.spool != nil {
+		return m.spool.produce(ctx, msgs...)
+	}
+	if err := m.breaker.allow(); err != nil {
+		return err
+	}
+	err := m.write(ctx, m.producer, msgs...)
+	m.breaker.record(ctx, err)
+	return err
+}
+
+// newMessage builds a message written by ProduceMessage, ProduceMessages or PublishAsync.
+func (m *KafkaMessenger) newMessage(key, message string, opts []ProduceOption) (kafka.Message, error) {
 	msg := kafka.Message{
 		Key:   []byte(key),
 		Value: []byte(message),
 	}
+	for _, opt := range opts {
+		opt(&msg)
+	}
+	if msg.Topic == "" {
+		msg.Topic = m.Topic
+	}
+	if msg.Topic == "" {
+		return kafka.Message{}, fmt.Errorf("topic is empty")
+	}
+	return msg, nil
+}
 
-	if err := m.producer.WriteMessages(ctx, msg); err != nil {
-		return fmt.Errorf("failed to write message: %w", err)
+// write writes msgs with producer in a single write, tracing each message and measuring the write.
+func (m *KafkaMessenger) write(ctx context.Context, producer messageWriter, msgs ...kafka.Message) error {
+	spans := make([]trace.Span, len(msgs))
+	for i := range msgs {
+		spans[i] = m.startProducerSpan(spanParent(ctx, i, len(msgs)), &msgs[i])
 	}
 
-	return nil
+	start := time.Now()
+	err := producer.WriteMessages(ctx, msgs...)
+	duration := time.Since(start)
+	if err != nil {
+		err = fmt.Errorf("failed to write message: %w", err)
+	}
+	m.metrics.observeWrite(msgs, duration)
+	for i, msg := range msgs {
+		m.metrics.observeProduce(msg.Topic, msg, err)
+		endSpan(spans[i], err)
+	}
+	return err
 }
 
 // EnsureTopicExists ensures that the topic exists with the given number of partitions and replication factor.
@@ -204,15 +477,20 @@ func (m *KafkaMessenger) ProduceMessage(ctx context.Context, key, message string
 //	  log.Fatal(err)
 //	}
 func (m *KafkaMessenger) EnsureTopicExists(numPartitions, replicationFactor int) error {
+	dialer := m.dialer
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+
 	var conn *kafka.Conn
 	var dialErr error
 
 	for _, broker := range m.BrokerAddresses {
-		conn, dialErr = kafka.Dial("tcp", broker)
+		conn, dialErr = dialer.Dial("tcp", broker)
 		if dialErr == nil {
 			break
 		}
-		log.Printf("Failed to connect to %s: %v", broker, dialErr)
+		m.logger().Warn("failed to connect to broker", "broker", broker, "error", dialErr)
 	}
 	if dialErr != nil {
 		return fmt.Errorf("couldn't connect to any broker: %w", dialErr)
@@ -224,14 +502,14 @@ func (m *KafkaMessenger) EnsureTopicExists(numPartitions, replicationFactor int)
 		return fmt.Errorf("failed to get controller connection: %w", err)
 	}
 
-	controllerConn, err := kafka.DialContext(context.Background(), "tcp", fmt.Sprintf("%s:%d", controller.Host, controller.Port))
+	controllerConn, err := dialer.DialContext(context.Background(), "tcp", fmt.Sprintf("%s:%d", controller.Host, controller.Port))
 	if err != nil {
 		return fmt.Errorf("failed to dial controller: %w", err)
 	}
 	defer controllerConn.Close()
 
 	if existingConfigs, err := controllerConn.ReadPartitions(m.Topic); err == nil && len(existingConfigs) > 0 {
-		log.Printf("KAFKA-PRODUCER: Topic %s already exists", m.Topic)
+		m.logger().Debug("topic already exists")
 		return nil
 	} else if err != kafka.UnknownTopicOrPartition {
 		return fmt.Errorf("failed to read partitions for topic %s: %w", m.Topic, err)
@@ -245,13 +523,13 @@ func (m *KafkaMessenger) EnsureTopicExists(numPartitions, replicationFactor int)
 
 	if err := controllerConn.CreateTopics(topicConfigs...); err != nil {
 		if err == kafka.TopicAlreadyExists {
-			log.Printf("KAFKA-PRODUCER: Topic %s already exists", m.Topic)
+			m.logger().Debug("topic already exists")
 			return nil
 		}
 		return fmt.Errorf("failed to create topic: %w", err)
 	}
 
-	log.Printf("KAFKA-PRODUCER: Created topic %s with %d partitions and replication factor %d\n", m.Topic, numPartitions, replicationFactor)
+	m.logger().Info("created topic", "partitions", numPartitions, "replication_factor", replicationFactor)
 	return nil
 }
 
@@ -269,108 +547,62 @@ func (m *KafkaMessenger) EnsureTopicExists(numPartitions, replicationFactor int)
 // The function checks if the consumer is already started or not initialized, and returns an error in such cases.
 // It sets up message and error channels, and a done channel for the consumer lifecycle. The consumer goroutine
 // reads messages from the Kafka topic, sends them to the message channel, and handles errors by sending them
-// to the error channel. It also commits message offsets after successful handling. The goroutine listens for
-// context cancellation to gracefully shut down.
+// to the error channel. A message's offset is committed once it has been handed over to the message channel
+// (or to the spill buffer), so the messages left in the channel when the process stops are not delivered again;
+// what happens while the channel is full is decided by the messenger's Backpressure policy. The goroutine
+// listens for context cancellation to gracefully shut down.
 func (m *KafkaMessenger) StartConsumer(ctx context.Context) (<-chan string, <-chan error, error) {
-	if m.consumer == nil {
-		return nil, nil, fmt.Errorf("consumer is not initialized")
-	}
-
-	if m.messageChannel != nil || m.errorChannel != nil {
-		return nil, nil, fmt.Errorf("consumer is already started")
-	}
-
-	m.messageChannel = make(chan string, 100)
-	m.errorChannel = make(chan error, 100)
-	m.consumerDone = make(chan struct{})
-
-	consumerCtx, cancel := context.WithCancel(ctx)
-	m.consumerCancel = cancel
-	log.Printf("KAFKA-CONSUMER: Started consumer goroutine for topic '%s' in group '%s'\n", m.Topic, m.GroupID)
-	log.Printf("KAFKA-CONSUMER: Consuming from topic '%s' in group '%s'\n", m.Topic, m.GroupID)
-
-	go func() {
-		defer close(m.consumerDone)
-		log.Printf("KAFKA-CONSUMER: Goroutine started for topic '%s'\n", m.Topic)
-
-		for {
-			select {
-			case <-consumerCtx.Done():
-				log.Printf("KAFKA-CONSUMER: Goroutine received cancellation signal for topic '%s' in group '%s'\n", m.Topic, m.GroupID)
-				close(m.messageChannel)
-				close(m.errorChannel)
-				log.Printf("KAFKA-CONSUMER: Goroutine for topic '%s' is exiting\n", m.Topic)
-				return
-			default:
-				msg, err := m.consumer.ReadMessage(consumerCtx)
-				if err != nil {
-					if isNetworkError(err) {
-						log.Printf("Network error occurred for topic '%s': %v, retrying...", m.Topic, err)
-						time.Sleep(1 * time.Second)
-						continue
-					}
-					if err == context.Canceled || err == context.DeadlineExceeded {
-						log.Printf("KAFKA-CONSUMER: FetchMessage cancelled/timed out for topic '%s'", m.Topic)
-						continue
-					}
-
-					log.Printf("KAFKA-CONSUMER: Failed to read message from topic '%s': %v", m.Topic, err)
-					select {
-					case m.errorChannel <- fmt.Errorf("failed to read message: %w", err):
-						// Error sent successfully
-					case <-consumerCtx.Done():
-						return
-					case <-time.After(100 * time.Millisecond):
-						// If error channel is full, log and continue
-						log.Printf("KAFKA-CONSUMER: Error channel full, dropping error: %v", err)
-					}
-					continue
-				}
-
-				select {
-				case m.messageChannel <- string(msg.Value):
-					log.Printf("KAFKA-CONSUMER: Sent message to channel from offset %d", msg.Offset)
-				case <-time.After(1 * time.Second):
-					log.Printf("KAFKA-CONSUMER: Channel full, possible consumer stall\n")
-				case <-consumerCtx.Done():
-					log.Printf("KAFKA-CONSUMER: Context cancelled while sending message for topic '%s'", m.Topic)
-					return
-				}
-			}
-		}
-	}()
-
-	return m.messageChannel, m.errorChannel, nil
+	return startConsumer(ctx, m, func(msg kafka.Message) string {
+		return string(msg.Value)
+	})
 }
 
-// StopConsumer signals the consumer goroutine to stop and waits for it to exit.
-// It closes the message and error channels and resets the consumer state.
-// If the consumer is not running, it returns an error.
+// StartMessageConsumer works like StartConsumer, but delivers every message together with its
+// key, headers, partition, offset and timestamp instead of only its value.
+//
+// Parameters:
+//   - ctx: context.Context for managing the consumer lifecycle
 //
 // Returns:
-//   - error: an error if the consumer is not running
-func (m *KafkaMessenger) StopConsumer() error {
-	if m.consumerCancel == nil {
-		return fmt.Errorf("kafka consumer is not running")
-	}
-
-	log.Printf("KAFKA-CONSUMER: Signaling consumer goroutine to stop for topic '%s'", m.Topic)
-	m.consumerCancel()
+//   - <-chan Message: a channel for receiving messages with their metadata
+//   - <-chan error: a channel for receiving errors that occur during message consumption
+//   - error: an error if the consumer is already started or not initialized
+//
+// Example usage:
+//
+//	messages, errs, err := messenger.StartMessageConsumer(ctx)
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	for msg := range messages {
+//	  log.Printf("partition %d offset %d key %s", msg.Partition, msg.Offset, msg.Key)
+//	}
+func (m *KafkaMessenger) StartMessageConsumer(ctx context.Context) (<-chan Message, <-chan error, error) {
+	return startConsumer(ctx, m, fromKafkaMessage)
+}
 
-	select {
-	case <-m.consumerDone:
-	case <-time.After(5 * time.Second):
-		log.Printf("Force closing consumer after timeout")
+func startConsumer[T any](ctx context.Context, m *KafkaMessenger, convert func(kafka.Message) T) (<-chan T, <-chan error, error) {
+	run, err := m.beginConsuming(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	log.Printf("KAFKA-CONSUMER: Consumer goroutine for topic '%s' has stopped.", m.Topic)
+	consumer, err := newChannelConsumer(m, convert)
+	if err != nil {
+		m.finishConsuming(run)
+		return nil, nil, err
+	}
+	m.logger().Info("started consumer")
+	m.metrics.trackChannel(m, consumer.fillLevel)
 
-	m.messageChannel = nil
-	m.errorChannel = nil
-	m.consumerCancel = nil
-	m.consumerDone = nil
+	go func() {
+		defer m.finishConsuming(run)
+		defer m.metrics.untrackChannel(m)
+		consumer.run(run)
+		m.logger().Info("consumer stopped")
+	}()
 
-	return nil
+	return consumer.messages, consumer.errs, nil
 }
 
 func isNetworkError(err error) bool {
@@ -1,3 +1,5 @@
+//go:build integration
+
 package kafka_test
 
 import (
@@ -84,3 +86,143 @@ func TestPubSub(t *testing.T) {
 
 	t.Log("TestPubSub finished successfully.")
 }
+
+func TestTypedPubSub(t *testing.T) {
+	if kafkaBroker == "" {
+		kafkaBroker = "localhost:9092"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	messenger, err := kafka.NewKafkaMessenger("test-envelope-topic", fmt.Sprintf("test-group-%d", time.Now().UnixNano()), []string{kafkaBroker})
+	if err != nil {
+		t.Fatalf("Failed to create Kafka messenger: %v", err)
+	}
+	defer func() {
+		if closeErr := messenger.Close(); closeErr != nil {
+			t.Errorf("Failed to close Kafka messenger: %v", closeErr)
+		}
+	}()
+
+	events, errs, err := kafka.Subscribe[TransactionCreated](ctx, messenger)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	envelope := kafka.NewEnvelope("TransactionCreated", "transaction_management", TransactionCreated{ID: 1, AccountID: 2, Amount: 10.5, Currency: "BRL"})
+	if err := kafka.Publish(ctx, messenger, "2", envelope); err != nil {
+		t.Fatalf("Failed to publish envelope: %v", err)
+	}
+
+	select {
+	case received := <-events:
+		if received.ID != envelope.ID || received.Payload != envelope.Payload {
+			t.Errorf("Expected envelope %+v, got %+v", envelope, received)
+		}
+	case consumerErr := <-errs:
+		t.Fatalf("Consumer reported error: %v", consumerErr)
+	case <-ctx.Done():
+		t.Fatalf("Test context cancelled or timed out while waiting for event. Error: %v", ctx.Err())
+	}
+
+	if err := messenger.StopConsumer(); err != nil {
+		t.Errorf("Failed to stop Kafka consumer: %v", err)
+	}
+}
+
+func TestMessagePubSub(t *testing.T) {
+	if kafkaBroker == "" {
+		kafkaBroker = "localhost:9092"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	messenger, err := kafka.NewKafkaMessenger("test-message-topic", fmt.Sprintf("test-group-%d", time.Now().UnixNano()), []string{kafkaBroker})
+	if err != nil {
+		t.Fatalf("Failed to create Kafka messenger: %v", err)
+	}
+	defer func() {
+		if closeErr := messenger.Close(); closeErr != nil {
+			t.Errorf("Failed to close Kafka messenger: %v", closeErr)
+		}
+	}()
+
+	messages, errs, err := messenger.StartMessageConsumer(ctx)
+	if err != nil {
+		t.Fatalf("Failed to start Kafka consumer: %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	timestamp := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	if err := messenger.ProduceMessage(ctx, "test-key", "Hello, Kafka!", kafka.WithHeader("source", "test"), kafka.WithTimestamp(timestamp)); err != nil {
+		t.Fatalf("Failed to produce message: %v", err)
+	}
+
+	select {
+	case received := <-messages:
+		if received.Topic != "test-message-topic" {
+			t.Errorf("Expected topic test-message-topic, got %s", received.Topic)
+		}
+		if received.Key != "test-key" {
+			t.Errorf("Expected key test-key, got %s", received.Key)
+		}
+		if string(received.Value) != "Hello, Kafka!" {
+			t.Errorf("Expected value 'Hello, Kafka!', got '%s'", received.Value)
+		}
+		if source, _ := received.Header("source"); source != "test" {
+			t.Errorf("Expected source header test, got %s", source)
+		}
+		if !received.Time.Equal(timestamp) {
+			t.Errorf("Expected timestamp %s, got %s", timestamp, received.Time)
+		}
+	case consumerErr := <-errs:
+		t.Fatalf("Consumer reported error: %v", consumerErr)
+	case <-ctx.Done():
+		t.Fatalf("Test context cancelled or timed out while waiting for message. Error: %v", ctx.Err())
+	}
+
+	if err := messenger.StopConsumer(); err != nil {
+		t.Errorf("Failed to stop Kafka consumer: %v", err)
+	}
+}
+
+func TestRequestReplyLatency(t *testing.T) {
+	if kafkaBroker == "" {
+		kafkaBroker = "localhost:9092"
+	}
+	topic := fmt.Sprintf("test-request-topic-%d", time.Now().UnixNano())
+
+	server, err := kafka.NewKafkaMessenger(topic, fmt.Sprintf("test-group-%d", time.Now().UnixNano()), []string{kafkaBroker},
+		kafka.WithBatchTimeout(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create Kafka messenger: %v", err)
+	}
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Consume(ctx, kafka.Reply(server, func(ctx context.Context, request kafka.Message) (string, error) {
+		return string(request.Value), nil
+	}))
+
+	requester, err := kafka.NewRequester(fmt.Sprintf("test-replies-%d", time.Now().UnixNano()), []string{kafkaBroker})
+	if err != nil {
+		t.Fatalf("Failed to create requester: %v", err)
+	}
+	defer requester.Close()
+
+	// The first request also waits for the server to join its group.
+	if _, err := requester.Request(ctx, topic, "warm-up"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := requester.Request(ctx, topic, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	// With the default batch timeout of 1s, the request alone would take a second.
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the round trip to take less than 500ms, took %s", elapsed)
+	}
+}
@@ -0,0 +1,49 @@
+package kafka
+
+import (
+	"context"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Publisher produces messages to a topic.
+type Publisher interface {
+	ProduceMessage(ctx context.Context, key, message string, opts ...ProduceOption) error
+	PublishAsync(ctx context.Context, key, message string, opts ...ProduceOption) *Delivery
+	Flush(ctx context.Context) error
+	Shutdown(ctx context.Context) (ShutdownReport, error)
+	Close() error
+}
+
+// Subscriber consumes messages from a topic.
+type Subscriber interface {
+	StartConsumer(ctx context.Context) (<-chan string, <-chan error, error)
+	StartMessageConsumer(ctx context.Context) (<-chan Message, <-chan error, error)
+	Consume(ctx context.Context, handler Handler) error
+	ConsumeConcurrently(ctx context.Context, workers int, handler Handler) error
+	StopConsumer() error
+	Shutdown(ctx context.Context) (ShutdownReport, error)
+	Close() error
+}
+
+// Messenger both produces to and consumes from a topic.
+// KafkaMessenger implements it, whether it talks to Kafka brokers or to a MemoryBroker.
+type Messenger interface {
+	Publisher
+	Subscriber
+}
+
+var _ Messenger = (*KafkaMessenger)(nil)
+
+// messageReader is the subset of *kafka.Reader used by the messenger.
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// messageWriter is the subset of *kafka.Writer used by the messenger.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
@@ -0,0 +1,343 @@
+package kafka
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Kinds of errors counted by Metrics.
+const (
+	ErrorKindProduce = "produce"
+	ErrorKindFetch   = "fetch"
+	ErrorKindHandler = "handler"
+	ErrorKindDeliver = "deliver"
+	ErrorKindCommit  = "commit"
+)
+
+// Metrics is a Prometheus collector for the messengers created with WithMetrics.
+//
+// It counts the messages and bytes produced and consumed, the errors by kind, the time taken to write
+// each batch and the consumer lag of every partition, computed from the high watermark of the fetched
+// messages. When it is collected, it also reports the fill level of the channels of the running channel
+// consumers, and the statistics of the underlying Kafka writers and readers.
+//
+// Example usage:
+//
+//	metrics := NewMetrics()
+//	prometheus.MustRegister(metrics)
+//	messenger, err := NewConsumer("transactions", "account_management", brokers, WithMetrics(metrics))
+type Metrics struct {
+	produced      *prometheus.CounterVec
+	producedBytes *prometheus.CounterVec
+	consumed      *prometheus.CounterVec
+	consumedBytes *prometheus.CounterVec
+	errors        *prometheus.CounterVec
+	writeDuration *prometheus.HistogramVec
+	lag           *prometheus.GaugeVec
+	channelFill   *prometheus.GaugeVec
+	spooled       *prometheus.CounterVec
+	duplicates    *prometheus.CounterVec
+
+	writerWrites    *prometheus.CounterVec
+	writerRetries   *prometheus.CounterVec
+	writerErrors    *prometheus.CounterVec
+	writerBatchTime *prometheus.GaugeVec
+	writerBatchSize *prometheus.GaugeVec
+	readerFetches   *prometheus.CounterVec
+	readerErrors    *prometheus.CounterVec
+	readerTimeouts  *prometheus.CounterVec
+	readerRebalance *prometheus.CounterVec
+	readerQueue     *prometheus.GaugeVec
+
+	mu       sync.Mutex
+	writers  map[*kafka.Writer]string
+	readers  map[*kafka.Reader][2]string
+	channels map[*KafkaMessenger]func() float64
+}
+
+var _ prometheus.Collector = (*Metrics)(nil)
+
+// NewMetrics creates the collector. It must be registered, e.g. with prometheus.MustRegister, to be exported.
+func NewMetrics() *Metrics {
+	topic := []string{"topic"}
+	topicGroup := []string{"topic", "group"}
+
+	return &Metrics{
+		produced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_messages_produced_total",
+			Help: "Number of messages successfully produced.",
+		}, topic),
+		producedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_produced_bytes_total",
+			Help: "Size of the values of the messages successfully produced.",
+		}, topic),
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_messages_consumed_total",
+			Help: "Number of messages handled or delivered to a consumer channel.",
+		}, topicGroup),
+		consumedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_consumed_bytes_total",
+			Help: "Size of the values of the messages handled or delivered to a consumer channel.",
+		}, topicGroup),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_errors_total",
+			Help: "Number of errors, by kind: produce, fetch, handler, deliver or commit.",
+		}, []string{"topic", "group", "kind"}),
+		writeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kafka_producer_batch_duration_seconds",
+			Help:    "Time taken to write a batch of messages, including the producer's batching delay.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, topic),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Number of messages of the partition behind the last fetched one.",
+		}, []string{"topic", "group", "partition"}),
+		channelFill: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kafka_consumer_channel_fill_ratio",
+			Help: "Fill level of the message channel of a running channel consumer, from 0 to 1.",
+		}, topicGroup),
+		spooled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_messages_spooled_total",
+			Help: "Number of messages written to the producer's spool because they could not be written to the brokers right away.",
+		}, topic),
+		duplicates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_duplicate_messages_total",
+			Help: "Number of redelivered events acknowledged without being handled again by an idempotent handler.",
+		}, topicGroup),
+
+		writerWrites: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_writer_writes_total",
+			Help: "Number of write requests sent by the Kafka writer.",
+		}, topic),
+		writerRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_writer_retries_total",
+			Help: "Number of write retries of the Kafka writer.",
+		}, topic),
+		writerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_writer_errors_total",
+			Help: "Number of errors reported by the Kafka writer.",
+		}, topic),
+		writerBatchTime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kafka_writer_batch_seconds",
+			Help: "Average and maximum batch time of the Kafka writer since the previous collection.",
+		}, []string{"topic", "stat"}),
+		writerBatchSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kafka_writer_batch_size",
+			Help: "Average and maximum number of messages per batch of the Kafka writer since the previous collection.",
+		}, []string{"topic", "stat"}),
+		readerFetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_reader_fetches_total",
+			Help: "Number of fetch requests sent by the Kafka reader.",
+		}, topicGroup),
+		readerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_reader_errors_total",
+			Help: "Number of errors reported by the Kafka reader.",
+		}, topicGroup),
+		readerTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_reader_timeouts_total",
+			Help: "Number of fetch timeouts of the Kafka reader.",
+		}, topicGroup),
+		readerRebalance: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_reader_rebalances_total",
+			Help: "Number of consumer group rebalances seen by the Kafka reader.",
+		}, topicGroup),
+		readerQueue: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kafka_reader_queue_length",
+			Help: "Number of prefetched messages waiting in the Kafka reader's queue.",
+		}, topicGroup),
+
+		writers:  make(map[*kafka.Writer]string),
+		readers:  make(map[*kafka.Reader][2]string),
+		channels: make(map[*KafkaMessenger]func() float64),
+	}
+}
+
+// WithMetrics reports the messenger's activity to the given collector.
+func WithMetrics(metrics *Metrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+func (c *Metrics) vectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.produced, c.producedBytes, c.consumed, c.consumedBytes, c.errors, c.writeDuration, c.lag, c.channelFill, c.spooled, c.duplicates,
+		c.writerWrites, c.writerRetries, c.writerErrors, c.writerBatchTime, c.writerBatchSize,
+		c.readerFetches, c.readerErrors, c.readerTimeouts, c.readerRebalance, c.readerQueue,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, vector := range c.vectors() {
+		vector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector. It reads the statistics of the Kafka writers and readers,
+// which resets them, so a Metrics should be the only reader of these statistics.
+func (c *Metrics) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	for writer, topic := range c.writers {
+		stats := writer.Stats()
+		c.writerWrites.WithLabelValues(topic).Add(float64(stats.Writes))
+		c.writerRetries.WithLabelValues(topic).Add(float64(stats.Retries))
+		c.writerErrors.WithLabelValues(topic).Add(float64(stats.Errors))
+		c.writerBatchTime.WithLabelValues(topic, "avg").Set(stats.BatchTime.Avg.Seconds())
+		c.writerBatchTime.WithLabelValues(topic, "max").Set(stats.BatchTime.Max.Seconds())
+		c.writerBatchSize.WithLabelValues(topic, "avg").Set(float64(stats.BatchSize.Avg))
+		c.writerBatchSize.WithLabelValues(topic, "max").Set(float64(stats.BatchSize.Max))
+	}
+	// A consumer with a RebalanceListener reads each of its partitions with its own reader, whose
+	// queues add up.
+	queues := make(map[[2]string]int64)
+	for reader, labels := range c.readers {
+		stats := reader.Stats()
+		c.readerFetches.WithLabelValues(labels[:]...).Add(float64(stats.Fetches))
+		c.readerErrors.WithLabelValues(labels[:]...).Add(float64(stats.Errors))
+		c.readerTimeouts.WithLabelValues(labels[:]...).Add(float64(stats.Timeouts))
+		c.readerRebalance.WithLabelValues(labels[:]...).Add(float64(stats.Rebalances))
+		queues[labels] += stats.QueueLength
+	}
+	for labels, length := range queues {
+		c.readerQueue.WithLabelValues(labels[:]...).Set(float64(length))
+	}
+	for m, fill := range c.channels {
+		c.channelFill.WithLabelValues(m.Topic, m.GroupID).Set(fill())
+	}
+	c.mu.Unlock()
+
+	for _, vector := range c.vectors() {
+		vector.Collect(ch)
+	}
+}
+
+func (c *Metrics) trackWriter(writer *kafka.Writer, topic string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writers[writer] = topic
+}
+
+func (c *Metrics) trackReader(reader *kafka.Reader, topic, groupID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readers[reader] = [2]string{topic, groupID}
+}
+
+// untrackReader stops collecting the statistics of reader, before it is closed.
+func (c *Metrics) untrackReader(reader *kafka.Reader) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.readers, reader)
+}
+
+// untrack stops collecting the statistics of the messenger's clients, before they are closed.
+func (c *Metrics) untrack(producer messageWriter, consumer messageReader) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if writer, ok := producer.(*kafka.Writer); ok {
+		delete(c.writers, writer)
+	}
+	if reader, ok := consumer.(*kafka.Reader); ok {
+		delete(c.readers, reader)
+	}
+}
+
+func (c *Metrics) trackChannel(m *KafkaMessenger, fill func() float64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channels[m] = fill
+}
+
+func (c *Metrics) untrackChannel(m *KafkaMessenger) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.channels, m)
+	c.channelFill.DeleteLabelValues(m.Topic, m.GroupID)
+}
+
+// observeWrite records the duration of one write, once for each topic the written messages belong to.
+func (c *Metrics) observeWrite(msgs []kafka.Message, duration time.Duration) {
+	if c == nil {
+		return
+	}
+	observed := make(map[string]bool, 1)
+	for _, msg := range msgs {
+		if !observed[msg.Topic] {
+			observed[msg.Topic] = true
+			c.writeDuration.WithLabelValues(msg.Topic).Observe(duration.Seconds())
+		}
+	}
+}
+
+func (c *Metrics) observeProduce(topic string, msg kafka.Message, err error) {
+	if c == nil {
+		return
+	}
+	if err != nil {
+		c.errors.WithLabelValues(topic, "", ErrorKindProduce).Inc()
+		return
+	}
+	c.produced.WithLabelValues(topic).Inc()
+	c.producedBytes.WithLabelValues(topic).Add(float64(len(msg.Value)))
+}
+
+func (c *Metrics) observeSpool(topic string) {
+	if c == nil {
+		return
+	}
+	c.spooled.WithLabelValues(topic).Inc()
+}
+
+func (c *Metrics) observeDuplicate(topic, groupID string) {
+	if c == nil {
+		return
+	}
+	c.duplicates.WithLabelValues(topic, groupID).Inc()
+}
+
+// observeFetch updates the lag of the message's partition.
+func (c *Metrics) observeFetch(groupID string, msg kafka.Message) {
+	if c == nil || msg.HighWaterMark <= 0 {
+		return
+	}
+	lag := max(msg.HighWaterMark-msg.Offset-1, 0)
+	c.lag.WithLabelValues(msg.Topic, groupID, strconv.Itoa(msg.Partition)).Set(float64(lag))
+}
+
+func (c *Metrics) observeConsume(groupID string, msg kafka.Message) {
+	if c == nil {
+		return
+	}
+	c.consumed.WithLabelValues(msg.Topic, groupID).Inc()
+	c.consumedBytes.WithLabelValues(msg.Topic, groupID).Add(float64(len(msg.Value)))
+}
+
+func (c *Metrics) observeError(topic, groupID, kind string) {
+	if c == nil {
+		return
+	}
+	c.errors.WithLabelValues(topic, groupID, kind).Inc()
+}
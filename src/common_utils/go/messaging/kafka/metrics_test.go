@@ -0,0 +1,158 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("should count produced and consumed messages, errors and lag", func(t *testing.T) {
+		metrics := NewMetrics()
+		messenger, err := NewMemoryBroker(1).NewMessenger("transactions", "account_management", WithMetrics(metrics))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		for _, value := range []string{"a", "bb", "ccc"} {
+			if err := messenger.ProduceMessage(ctx, "account-1", value); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		failed, handled := false, 0
+		messenger.Consume(ctx, func(ctx context.Context, msg Message) error {
+			if !failed {
+				failed = true
+				return errors.New("temporary failure")
+			}
+			if handled++; handled == 2 {
+				cancel()
+			}
+			return nil
+		})
+
+		for _, tc := range []struct {
+			name      string
+			collector prometheus.Collector
+			expected  float64
+		}{
+			{"produced", metrics.produced.WithLabelValues("transactions"), 3},
+			{"produced bytes", metrics.producedBytes.WithLabelValues("transactions"), 6},
+			{"consumed", metrics.consumed.WithLabelValues("transactions", "account_management"), 2},
+			{"consumed bytes", metrics.consumedBytes.WithLabelValues("transactions", "account_management"), 3},
+			{"handler errors", metrics.errors.WithLabelValues("transactions", "account_management", ErrorKindHandler), 1},
+			{"lag", metrics.lag.WithLabelValues("transactions", "account_management", "0"), 1},
+		} {
+			if value := testutil.ToFloat64(tc.collector); value != tc.expected {
+				t.Errorf("expected %s to be %v, got %v", tc.name, tc.expected, value)
+			}
+		}
+
+		var batches dto.Metric
+		if err := metrics.writeDuration.WithLabelValues("transactions").(prometheus.Histogram).Write(&batches); err != nil {
+			t.Fatal(err)
+		}
+		if count := batches.GetHistogram().GetSampleCount(); count != 3 {
+			t.Errorf("expected 3 batch durations, got %d", count)
+		}
+	})
+
+	t.Run("should measure a batch once", func(t *testing.T) {
+		metrics := NewMetrics()
+		messenger, err := NewMemoryBroker(1).NewMessenger("transactions", "", WithMetrics(metrics))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		records := []Record{{Key: "account-1", Value: "a"}, {Key: "account-1", Value: "bb"}, {Key: "account-2", Value: "ccc"}}
+		if err := messenger.ProduceMessages(context.Background(), records...); err != nil {
+			t.Fatal(err)
+		}
+
+		if produced := testutil.ToFloat64(metrics.produced.WithLabelValues("transactions")); produced != 3 {
+			t.Errorf("expected 3 produced messages, got %v", produced)
+		}
+		var batches dto.Metric
+		if err := metrics.writeDuration.WithLabelValues("transactions").(prometheus.Histogram).Write(&batches); err != nil {
+			t.Fatal(err)
+		}
+		if count := batches.GetHistogram().GetSampleCount(); count != 1 {
+			t.Errorf("expected 1 batch duration, got %d", count)
+		}
+	})
+
+	t.Run("should report the fill level of the consumer channel", func(t *testing.T) {
+		metrics := NewMetrics()
+		messenger, err := NewMemoryBroker(1).NewMessenger("transactions", "account_management", WithMetrics(metrics))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		messages, _, err := messenger.StartConsumer(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 26 {
+			messenger.ProduceMessage(context.Background(), "account-1", "payload")
+		}
+		<-messages
+
+		deadline := time.Now().Add(5 * time.Second)
+		for len(messages) < 25 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		expected := `
+# HELP kafka_consumer_channel_fill_ratio Fill level of the message channel of a running channel consumer, from 0 to 1.
+# TYPE kafka_consumer_channel_fill_ratio gauge
+kafka_consumer_channel_fill_ratio{group="account_management",topic="transactions"} 0.25
+`
+		if err := testutil.CollectAndCompare(metrics, strings.NewReader(expected), "kafka_consumer_channel_fill_ratio"); err != nil {
+			t.Error(err)
+		}
+
+		if err := messenger.StopConsumer(); err != nil {
+			t.Fatal(err)
+		}
+		if count := testutil.CollectAndCount(metrics, "kafka_consumer_channel_fill_ratio"); count != 0 {
+			t.Errorf("expected the stopped consumer not to be reported, got %d series", count)
+		}
+	})
+
+	t.Run("should collect the statistics of the Kafka clients until they are closed", func(t *testing.T) {
+		metrics := NewMetrics()
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(metrics)
+
+		messenger, err := NewKafkaMessenger("transactions", "account_management", []string{"localhost:9092"},
+			WithAutoCreateTopics(false), WithMetrics(metrics))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count := testutil.CollectAndCount(metrics, "kafka_writer_writes_total", "kafka_reader_fetches_total"); count != 2 {
+			t.Errorf("expected the writer and the reader to be reported, got %d series", count)
+		}
+		if _, err := registry.Gather(); err != nil {
+			t.Fatal(err)
+		}
+
+		messenger.Close()
+		if len(metrics.writers) != 0 || len(metrics.readers) != 0 {
+			t.Errorf("expected the closed clients not to be collected, got %d writers and %d readers", len(metrics.writers), len(metrics.readers))
+		}
+	})
+}
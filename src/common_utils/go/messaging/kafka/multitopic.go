@@ -0,0 +1,297 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// NewMultiTopicConsumer creates a KafkaMessenger that consumes several topics as a single member of
+// the given consumer group, so that one Consume loop handles all of them. Use a Router to dispatch
+// the messages by topic and event type. The topics are created unless disabled with WithAutoCreateTopics.
+//
+// Parameters:
+//   - topics: the names of the Kafka topics to consume messages from
+//   - groupID: the group ID for the Kafka consumer
+//   - brokerAddresses: the addresses of the Kafka brokers to connect to
+//   - opts: optional settings for the topics and the consumer
+//
+// Returns:
+//   - *KafkaMessenger: a new consumer-only KafkaMessenger
+//   - error: an error if a topic cannot be created or if there is a problem communicating with the kafka broker
+//
+// Example usage:
+//
+//	consumer, err := NewMultiTopicConsumer([]string{"transactions", "users"}, "account_management", brokers)
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer consumer.Close()
+//	err = consumer.Consume(ctx, router.Dispatch)
+func NewMultiTopicConsumer(topics []string, groupID string, brokerAddresses []string, opts ...Option) (*KafkaMessenger, error) {
+	if len(brokerAddresses) == 0 {
+		return nil, fmt.Errorf("broker address is empty")
+	}
+	topics, err := uniqueTopics(topics)
+	if err != nil {
+		return nil, err
+	}
+	if groupID == "" {
+		return nil, fmt.Errorf("group ID is empty")
+	}
+
+	o := newOptions(opts)
+	conn, err := newConnection(o)
+	if err != nil {
+		return nil, err
+	}
+	consumer := newMessenger(strings.Join(topics, ","), groupID, brokerAddresses, o)
+	consumer.Topics = topics
+	consumer.dialer = conn.dialer
+	consumer.inspector = newKafkaInspector(brokerAddresses, conn)
+	if consumer.consumer, err = consumer.newConsumer(o, conn); err != nil {
+		return nil, err
+	}
+
+	if o.autoCreateTopics {
+		if err := consumer.ensureTopics(newAdmin(brokerAddresses, conn), o); err != nil {
+			return nil, err
+		}
+	}
+	return consumer, nil
+}
+
+// NewPatternConsumer creates a KafkaMessenger that consumes every topic whose name matches pattern,
+// like NewMultiTopicConsumer. The topics are listed when the consumer is created: the topics created
+// afterwards are only consumed by the consumers created after them.
+//
+// Parameters:
+//   - pattern: the pattern the names of the topics must match
+//   - groupID: the group ID for the Kafka consumer
+//   - brokerAddresses: the addresses of the Kafka brokers to connect to
+//   - opts: optional settings for the consumer
+//
+// Returns:
+//   - *KafkaMessenger: a new consumer-only KafkaMessenger
+//   - error: an error if no topic matches pattern or if there is a problem communicating with the kafka broker
+//
+// Example usage:
+//
+//	consumer, err := NewPatternConsumer(regexp.MustCompile(`^transactions(\.retry\.\d+)?$`), "account_management", brokers)
+func NewPatternConsumer(pattern *regexp.Regexp, groupID string, brokerAddresses []string, opts ...Option) (*KafkaMessenger, error) {
+	admin, err := NewAdmin(brokerAddresses, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+	existing, err := admin.ListTopics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(existing))
+	for i, topic := range existing {
+		names[i] = topic.Name
+	}
+	topics, err := matchTopics(pattern, names)
+	if err != nil {
+		return nil, err
+	}
+	return NewMultiTopicConsumer(topics, groupID, brokerAddresses, append(opts, WithAutoCreateTopics(false))...)
+}
+
+// ensureTopics creates the consumer's topics, closing the consumer if it fails.
+func (m *KafkaMessenger) ensureTopics(admin *Admin, o options) error {
+	specs := make([]TopicSpec, len(m.Topics))
+	for i, topic := range m.Topics {
+		specs[i] = TopicSpec{Name: topic, Partitions: o.numPartitions, ReplicationFactor: o.replicationFactor}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+	created, err := admin.CreateTopics(ctx, specs...)
+	if err != nil {
+		if closeErr := m.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+		return fmt.Errorf("failed to ensure topics: %w", err)
+	}
+	for _, topic := range created {
+		m.logger().Info("created topic", "created", topic, "partitions", o.numPartitions, "replication_factor", o.replicationFactor)
+	}
+	return nil
+}
+
+// uniqueTopics returns the sorted topics without duplicates.
+func uniqueTopics(topics []string) ([]string, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("topics are empty")
+	}
+	if slices.Contains(topics, "") {
+		return nil, fmt.Errorf("topic is empty")
+	}
+	return slices.Compact(slices.Sorted(slices.Values(topics))), nil
+}
+
+// matchTopics returns the names matching pattern.
+func matchTopics(pattern *regexp.Regexp, names []string) ([]string, error) {
+	var topics []string
+	for _, name := range names {
+		if pattern.MatchString(name) {
+			topics = append(topics, name)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("no topic matches %s", pattern)
+	}
+	return topics, nil
+}
+
+// topicsOf returns the topics of a HealthStatus, which lists those of a multi-topic consumer
+// separated by commas. Topic names cannot contain commas.
+func topicsOf(status *HealthStatus) []string {
+	return strings.Split(status.Topic, ",")
+}
+
+// memoryMultiReader implements messageReader on top of a MemoryBroker, as one member of the
+// consumer groups of several topics.
+type memoryMultiReader struct {
+	broker   *MemoryBroker
+	readers  []*memoryReader
+	listener *RebalanceListener
+
+	// next is guarded by broker.mu.
+	next int
+}
+
+func (r *memoryMultiReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return kafka.Message{}, err
+		}
+
+		r.broker.mu.Lock()
+		if r.readers[0].closed {
+			r.broker.mu.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+		var revoked, assigned []TopicPartition
+		for _, reader := range r.readers {
+			reader.join()
+			reader.rebalance()
+			readerRevoked, readerAssigned := reader.rebalanced()
+			revoked = append(revoked, readerRevoked...)
+			assigned = append(assigned, readerAssigned...)
+		}
+		if len(revoked) > 0 || len(assigned) > 0 {
+			r.broker.mu.Unlock()
+			r.listener.notifyRevoked(ctx, revoked)
+			r.listener.notifyAssigned(ctx, assigned)
+			continue
+		}
+
+		// The topics are taken in turns, so that a busy topic does not starve the others.
+		for i := range r.readers {
+			index := (r.next + i) % len(r.readers)
+			if msg, ok := r.readers[index].nextMessage(); ok {
+				r.next = (index + 1) % len(r.readers)
+				r.broker.mu.Unlock()
+				return msg, nil
+			}
+		}
+		changed := r.broker.changed
+		r.broker.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		}
+	}
+}
+
+func (r *memoryMultiReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, reader := range r.readers {
+		var topicMsgs []kafka.Message
+		for _, msg := range msgs {
+			if msg.Topic == reader.topic {
+				topicMsgs = append(topicMsgs, msg)
+			}
+		}
+		if len(topicMsgs) == 0 {
+			continue
+		}
+		if err := reader.CommitMessages(ctx, topicMsgs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryMultiReader) Close() error {
+	r.broker.mu.Lock()
+	var revoked []TopicPartition
+	for _, reader := range r.readers {
+		revoked = append(revoked, reader.close()...)
+	}
+	r.broker.mu.Unlock()
+
+	r.listener.notifyRevoked(context.Background(), revoked)
+	return nil
+}
+
+func (r *memoryMultiReader) assignments() []TopicPartition {
+	var partitions []TopicPartition
+	for _, reader := range r.readers {
+		partitions = append(partitions, reader.assignments()...)
+	}
+	return partitions
+}
+
+// NewMultiTopicConsumer creates a KafkaMessenger that consumes the broker's topics as a single member
+// of the group, creating the topics that do not exist yet. See NewMultiTopicConsumer.
+func (b *MemoryBroker) NewMultiTopicConsumer(topics []string, groupID string, opts ...Option) (*KafkaMessenger, error) {
+	topics, err := uniqueTopics(topics)
+	if err != nil {
+		return nil, err
+	}
+	if groupID == "" {
+		return nil, fmt.Errorf("group ID is empty")
+	}
+
+	o := newOptions(opts)
+	consumer := newMessenger(strings.Join(topics, ","), groupID, nil, o)
+	consumer.Topics = topics
+	reader := &memoryMultiReader{broker: b, listener: o.rebalanceListener}
+	for _, topic := range topics {
+		b.CreateTopic(topic, b.defaultPartitions)
+		reader.readers = append(reader.readers, &memoryReader{broker: b, topic: topic, groupID: groupID, listener: o.rebalanceListener, generation: -1})
+	}
+	consumer.consumer = reader
+	consumer.inspector = memoryInspector{broker: b}
+	return consumer, nil
+}
+
+// NewPatternConsumer creates a KafkaMessenger that consumes the broker's topics whose name matches
+// pattern, as a single member of the group. See NewPatternConsumer.
+func (b *MemoryBroker) NewPatternConsumer(pattern *regexp.Regexp, groupID string, opts ...Option) (*KafkaMessenger, error) {
+	b.mu.Lock()
+	names := make([]string, 0, len(b.topics))
+	for topic := range b.topics {
+		names = append(names, topic)
+	}
+	b.mu.Unlock()
+
+	topics, err := matchTopics(pattern, names)
+	if err != nil {
+		return nil, err
+	}
+	return b.NewMultiTopicConsumer(topics, groupID, opts...)
+}
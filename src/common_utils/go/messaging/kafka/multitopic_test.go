@@ -0,0 +1,244 @@
+//go:build unit
+
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+)
+
+func TestMultiTopicConsumer(t *testing.T) {
+	t.Run("should consume every topic under one group", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(2)
+		transactions := newMemoryMessenger(t, broker, "transactions", "")
+		users := newMemoryMessenger(t, broker, "users", "")
+		produceMessages(t, transactions, 6)
+		produceMessages(t, users, 4)
+
+		consumer, err := broker.NewMultiTopicConsumer([]string{"users", "transactions", "users"}, "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer consumer.Close()
+		if fmt.Sprint(consumer.Topics) != "[transactions users]" || consumer.Topic != "transactions,users" {
+			t.Errorf("expected topics [transactions users], got %v (%s)", consumer.Topics, consumer.Topic)
+		}
+
+		handled := newHandledMessages()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- consumer.Consume(ctx, handled.Handler("consumer")) }()
+		handled.WaitFor(t, 10)
+		status := consumer.HealthCheck(ctx)
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		byTopic := make(map[string]int)
+		for _, msg := range handled.Messages() {
+			byTopic[msg.Topic]++
+		}
+		if byTopic["transactions"] != 6 || byTopic["users"] != 4 {
+			t.Errorf("expected 6 transactions and 4 users, got %v", byTopic)
+		}
+		committed := 0
+		for _, topic := range []string{"transactions", "users"} {
+			for partition := 0; partition < 2; partition++ {
+				committed += max(int(broker.CommittedOffset("account_management", topic, partition)), 0)
+			}
+		}
+		if committed != 10 {
+			t.Errorf("expected 10 offsets committed, got %d", committed)
+		}
+		if !status.Ready() || status.TopicPartitions != 4 {
+			t.Errorf("expected a ready consumer of 4 partitions, got %+v", status)
+		}
+	})
+
+	t.Run("should consume the topics matching a pattern", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		for _, topic := range []string{"transactions", "transactions.retry.1", "users"} {
+			broker.CreateTopic(topic, 1)
+		}
+
+		consumer, err := broker.NewPatternConsumer(regexp.MustCompile(`^transactions(\.retry\.\d+)?$`), "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer consumer.Close()
+		if fmt.Sprint(consumer.Topics) != "[transactions transactions.retry.1]" {
+			t.Errorf("expected topics [transactions transactions.retry.1], got %v", consumer.Topics)
+		}
+
+		if _, err := broker.NewPatternConsumer(regexp.MustCompile(`^budgets$`), "account_management"); err == nil {
+			t.Error("expected an error when no topic matches")
+		}
+	})
+
+	t.Run("should refuse invalid topics", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		for _, topics := range [][]string{nil, {"transactions", ""}} {
+			if _, err := broker.NewMultiTopicConsumer(topics, "account_management"); err == nil {
+				t.Errorf("expected an error for topics %q", topics)
+			}
+		}
+		if _, err := broker.NewMultiTopicConsumer([]string{"transactions"}, ""); err == nil {
+			t.Error("expected an error without a group")
+		}
+	})
+}
+
+func TestRouter(t *testing.T) {
+	envelope := func(topic, eventType string) kafka.Message {
+		value := fmt.Sprintf(`{"id":"1","type":%q,"source":"test","schema_version":1,"occurred_at":"2024-05-01T12:00:00Z","payload":{}}`, eventType)
+		return kafka.Message{Topic: topic, Value: []byte(value)}
+	}
+	var mu sync.Mutex
+	var routed []string
+	route := func(name string) kafka.Handler {
+		return func(ctx context.Context, msg kafka.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			routed = append(routed, name)
+			return nil
+		}
+	}
+	dispatched := func(t *testing.T, router *kafka.Router, msg kafka.Message) string {
+		t.Helper()
+		routed = nil
+		if err := router.Dispatch(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(routed, ",")
+	}
+
+	router := kafka.NewRouter().
+		Handle("transactions", "TransactionCreated", route("created on transactions")).
+		HandleType("TransactionCreated", route("created")).
+		HandleType("UserDeleted", route("user deleted")).
+		HandleTopic("transactions", route("transactions"))
+
+	t.Run("should dispatch to the most specific handler", func(t *testing.T) {
+		cases := map[string]kafka.Message{
+			"created on transactions": envelope("transactions", "TransactionCreated"),
+			"created":                 envelope("transactions.retry.1", "TransactionCreated"),
+			"user deleted":            envelope("users", "UserDeleted"),
+			"transactions":            envelope("transactions", "TransactionUpdated"),
+		}
+		for expected, msg := range cases {
+			if handler := dispatched(t, router, msg); handler != expected {
+				t.Errorf("expected %s %s to be handled by %q, got %q", msg.Topic, msg.Value, expected, handler)
+			}
+		}
+		if handler := dispatched(t, router, kafka.Message{Topic: "transactions", Value: []byte("not an envelope")}); handler != "transactions" {
+			t.Errorf("expected a message that is not an envelope to be routed by topic, got %q", handler)
+		}
+	})
+
+	t.Run("should route on the event type header before the envelope", func(t *testing.T) {
+		msg := envelope("users", "UserCreated")
+		msg.Headers = []kafka.Header{{Key: kafka.HeaderEventType, Value: []byte("UserDeleted")}}
+		if handler := dispatched(t, router, msg); handler != "user deleted" {
+			t.Errorf("expected the header to choose the handler, got %q", handler)
+		}
+
+		headerOnly := kafka.Message{Topic: "users", Value: []byte("not an envelope"), Headers: msg.Headers}
+		if handler := dispatched(t, router, headerOnly); handler != "user deleted" {
+			t.Errorf("expected a message with the header to be routed without decoding it, got %q", handler)
+		}
+	})
+
+	t.Run("should acknowledge unknown messages without a fallback", func(t *testing.T) {
+		if handler := dispatched(t, router, envelope("users", "UserCreated")); handler != "" {
+			t.Errorf("expected no handler, got %q", handler)
+		}
+	})
+
+	t.Run("should send unknown messages to the fallback", func(t *testing.T) {
+		failing := kafka.NewRouter().HandleTopic("transactions", route("transactions")).Fallback(func(ctx context.Context, msg kafka.Message) error {
+			return errors.New("unknown event")
+		})
+		if err := failing.Dispatch(context.Background(), envelope("users", "UserCreated")); err == nil || err.Error() != "unknown event" {
+			t.Errorf("expected the fallback's error, got %v", err)
+		}
+	})
+
+	t.Run("should refuse a duplicate route", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+		kafka.NewRouter().HandleType("UserDeleted", route("a")).HandleType("UserDeleted", route("b"))
+	})
+}
+
+func TestRouterWithMultiTopicConsumer(t *testing.T) {
+	broker := kafka.NewMemoryBroker(1)
+	producer := newMemoryMessenger(t, broker, "transactions", "")
+	for _, event := range []struct{ topic, eventType string }{
+		{"transactions", "TransactionCreated"},
+		{"users", "UserDeleted"},
+		{"transactions", "TransactionDeleted"},
+	} {
+		err := kafka.Publish(context.Background(), producerTo{producer, event.topic}, "account-1", kafka.NewEnvelope(event.eventType, "test", struct{}{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	consumer, err := broker.NewMultiTopicConsumer([]string{"transactions", "users"}, "account_management")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	var mu sync.Mutex
+	var types []string
+	record := func(ctx context.Context, msg kafka.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		types = append(types, msg.Topic)
+		return nil
+	}
+	router := kafka.NewRouter().
+		HandleType("TransactionCreated", record).
+		HandleType("TransactionDeleted", record).
+		HandleType("UserDeleted", record)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Consume(ctx, router.Dispatch) }()
+	waitUntil(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(types) == 3
+	})
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(types)
+	if fmt.Sprint(types) != "[transactions transactions users]" {
+		t.Errorf("expected 2 transactions and 1 user event, got %v", types)
+	}
+}
+
+// producerTo publishes through a messenger to another topic.
+type producerTo struct {
+	*kafka.KafkaMessenger
+	topic string
+}
+
+func (p producerTo) ProduceMessage(ctx context.Context, key, message string, opts ...kafka.ProduceOption) error {
+	return p.KafkaMessenger.ProduceMessage(ctx, key, message, append(opts, kafka.ToTopic(p.topic))...)
+}
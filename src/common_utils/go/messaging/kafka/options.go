@@ -0,0 +1,211 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Compression is the codec used by a producer to compress message batches.
+type Compression = kafka.Compression
+
+const (
+	CompressionNone   Compression = 0
+	CompressionGzip               = kafka.Gzip
+	CompressionSnappy             = kafka.Snappy
+	CompressionLz4                = kafka.Lz4
+	CompressionZstd               = kafka.Zstd
+)
+
+// RequiredAcks is the number of acknowledgements a producer waits for before a write succeeds.
+type RequiredAcks = kafka.RequiredAcks
+
+const (
+	// RequireNone does not wait for any acknowledgement.
+	RequireNone = kafka.RequireNone
+	// RequireOne waits for the partition leader to acknowledge the write.
+	RequireOne = kafka.RequireOne
+	// RequireAll waits for every in-sync replica to acknowledge the write.
+	RequireAll = kafka.RequireAll
+)
+
+// StartOffset is where a consumer group with no committed offset starts reading a partition.
+type StartOffset int64
+
+const (
+	// StartFromFirst reads the partition from its oldest retained message.
+	StartFromFirst StartOffset = StartOffset(kafka.FirstOffset)
+	// StartFromLast only reads messages produced after the consumer joined.
+	StartFromLast StartOffset = StartOffset(kafka.LastOffset)
+)
+
+const (
+	defaultQueueCapacity     = 100
+	defaultRetentionTime     = 24 * 7 * time.Hour
+	defaultHeartbeatInterval = 3 * time.Second
+	defaultSessionTimeout    = 30 * time.Second
+	defaultReaderMaxAttempts = 5
+)
+
+// Option configures a messenger created by NewProducer, NewConsumer or NewKafkaMessenger.
+// Options that only apply to one side, such as WithBatchSize or WithStartOffset, are ignored by the other.
+type Option func(*options)
+
+type options struct {
+	topic             string
+	numPartitions     int
+	replicationFactor int
+	autoCreateTopics  bool
+
+	batchSize    int
+	batchTimeout time.Duration
+	compression  Compression
+	requiredAcks RequiredAcks
+
+	startOffset       StartOffset
+	queueCapacity     int
+	sessionTimeout    time.Duration
+	heartbeatInterval time.Duration
+	backpressure      BackpressurePolicy
+	rebalanceListener *RebalanceListener
+	stallTimeout      time.Duration
+
+	maxPendingDeliveries int
+	drainTimeout         time.Duration
+	circuitBreaker       *CircuitBreakerPolicy
+	spool                *SpoolPolicy
+
+	stateFile      string
+	requestTimeout time.Duration
+
+	tls  *tls.Config
+	sasl *saslCredentials
+
+	logger         *slog.Logger
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+	metrics        *Metrics
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		numPartitions:     defaultNumPartitions,
+		replicationFactor: defaultReplicationFactor,
+		autoCreateTopics:  true,
+		batchSize:         defaultBatchSize,
+		batchTimeout:      defaultBatchTimeout,
+		compression:       CompressionNone,
+		requiredAcks:      RequireAll,
+		startOffset:       StartFromFirst,
+		queueCapacity:     defaultQueueCapacity,
+		sessionTimeout:    defaultSessionTimeout,
+		heartbeatInterval: defaultHeartbeatInterval,
+		stallTimeout:      defaultStallTimeout,
+
+		maxPendingDeliveries: defaultMaxPendingDeliveries,
+		drainTimeout:         defaultDrainTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTopic sets the default topic of a producer created by NewProducer.
+// Without it, every message must name its topic with ToTopic.
+func WithTopic(topic string) Option {
+	return func(o *options) {
+		o.topic = topic
+	}
+}
+
+// WithPartitions sets the number of partitions of the topics created by the messenger. Defaults to 3.
+func WithPartitions(numPartitions int) Option {
+	return func(o *options) {
+		o.numPartitions = numPartitions
+	}
+}
+
+// WithReplicationFactor sets the replication factor of the topics created by the messenger. Defaults to 1.
+func WithReplicationFactor(replicationFactor int) Option {
+	return func(o *options) {
+		o.replicationFactor = replicationFactor
+	}
+}
+
+// WithAutoCreateTopics decides whether the messenger creates its topic when it does not exist.
+// Defaults to true; turn it off where topics are provisioned ahead of time.
+func WithAutoCreateTopics(enabled bool) Option {
+	return func(o *options) {
+		o.autoCreateTopics = enabled
+	}
+}
+
+// WithBatchSize sets the maximum number of messages the producer sends in one batch. Defaults to 100.
+func WithBatchSize(batchSize int) Option {
+	return func(o *options) {
+		o.batchSize = batchSize
+	}
+}
+
+// WithBatchTimeout sets how long the producer waits for a batch to fill before sending it. Defaults to 1s.
+func WithBatchTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.batchTimeout = timeout
+	}
+}
+
+// WithCompression sets the codec the producer compresses batches with. Defaults to CompressionNone.
+func WithCompression(codec Compression) Option {
+	return func(o *options) {
+		o.compression = codec
+	}
+}
+
+// WithRequiredAcks sets the acknowledgements the producer waits for. Defaults to RequireAll.
+func WithRequiredAcks(acks RequiredAcks) Option {
+	return func(o *options) {
+		o.requiredAcks = acks
+	}
+}
+
+// WithStartOffset sets where the consumer starts when its group has no committed offset.
+// Defaults to StartFromFirst.
+func WithStartOffset(offset StartOffset) Option {
+	return func(o *options) {
+		o.startOffset = offset
+	}
+}
+
+// WithQueueCapacity sets how many messages the consumer prefetches. Defaults to 100.
+func WithQueueCapacity(capacity int) Option {
+	return func(o *options) {
+		o.queueCapacity = capacity
+	}
+}
+
+// WithSessionTimeout sets how long the group coordinator waits for a heartbeat before
+// evicting the consumer from its group. Defaults to 30s.
+func WithSessionTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.sessionTimeout = timeout
+	}
+}
+
+// WithHeartbeatInterval sets how often the consumer sends heartbeats to the group coordinator. Defaults to 3s.
+func WithHeartbeatInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.heartbeatInterval = interval
+	}
+}
+
+// WithBackpressure sets the messenger's Backpressure policy.
+func WithBackpressure(policy BackpressurePolicy) Option {
+	return func(o *options) {
+		o.backpressure = policy
+	}
+}
@@ -0,0 +1,213 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestOptions(t *testing.T) {
+	t.Run("should keep the previous defaults", func(t *testing.T) {
+		o := newOptions(nil)
+
+		if o.numPartitions != 3 || o.replicationFactor != 1 || !o.autoCreateTopics {
+			t.Errorf("expected 3 partitions, replication factor 1 and auto-creation, got %+v", o)
+		}
+		if o.batchSize != 100 || o.batchTimeout != time.Second || o.requiredAcks != RequireAll {
+			t.Errorf("expected the default producer settings, got %+v", o)
+		}
+		if o.startOffset != StartFromFirst || o.queueCapacity != 100 || o.sessionTimeout != 30*time.Second || o.heartbeatInterval != 3*time.Second {
+			t.Errorf("expected the default consumer settings, got %+v", o)
+		}
+	})
+
+	t.Run("should configure the producer", func(t *testing.T) {
+		m := &KafkaMessenger{BrokerAddresses: []string{"localhost:9092"}}
+		writer := m.newWriter(newOptions([]Option{
+			WithBatchSize(10),
+			WithBatchTimeout(10 * time.Millisecond),
+			WithCompression(CompressionSnappy),
+			WithRequiredAcks(RequireOne),
+			WithAutoCreateTopics(false),
+		}), connection{})
+		defer writer.Close()
+
+		if writer.BatchSize != 10 || writer.BatchTimeout != 10*time.Millisecond {
+			t.Errorf("expected batches of 10 messages or 10ms, got %d and %s", writer.BatchSize, writer.BatchTimeout)
+		}
+		if writer.Compression != kafka.Snappy || writer.RequiredAcks != kafka.RequireOne || writer.AllowAutoTopicCreation {
+			t.Errorf("expected snappy, leader acks and no auto-creation, got %v, %v and %v", writer.Compression, writer.RequiredAcks, writer.AllowAutoTopicCreation)
+		}
+		if writer.Topic != "" {
+			t.Errorf("expected the writer not to be tied to a topic, got %s", writer.Topic)
+		}
+	})
+
+	t.Run("should configure the consumer", func(t *testing.T) {
+		m := &KafkaMessenger{Topic: "transactions", GroupID: "account_management", BrokerAddresses: []string{"localhost:9092"}}
+		reader := m.newReader(newOptions([]Option{
+			WithStartOffset(StartFromLast),
+			WithQueueCapacity(10),
+			WithSessionTimeout(10 * time.Second),
+			WithHeartbeatInterval(time.Second),
+		}), connection{})
+		defer reader.Close()
+
+		config := reader.Config()
+		if config.StartOffset != kafka.LastOffset || config.QueueCapacity != 10 {
+			t.Errorf("expected to start from the last offset with a queue of 10, got %d and %d", config.StartOffset, config.QueueCapacity)
+		}
+		if config.SessionTimeout != 10*time.Second || config.HeartbeatInterval != time.Second {
+			t.Errorf("expected a 10s session and 1s heartbeats, got %s and %s", config.SessionTimeout, config.HeartbeatInterval)
+		}
+	})
+
+	t.Run("should configure a consumer of several topics", func(t *testing.T) {
+		consumer, err := NewMultiTopicConsumer([]string{"users", "transactions"}, "account_management", []string{"localhost:9092"}, WithAutoCreateTopics(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer consumer.Close()
+
+		config := consumer.consumer.(*kafka.Reader).Config()
+		if config.Topic != "" || fmt.Sprint(config.GroupTopics) != "[transactions users]" {
+			t.Errorf("expected the group topics [transactions users], got %q and %v", config.Topic, config.GroupTopics)
+		}
+	})
+}
+
+func TestNewProducer(t *testing.T) {
+	t.Run("should only produce", func(t *testing.T) {
+		producer, err := NewProducer([]string{"localhost:9092"}, WithTopic("transactions"), WithAutoCreateTopics(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer producer.Close()
+
+		if producer.Topic != "transactions" || producer.producer == nil || producer.consumer != nil {
+			t.Errorf("expected a producer-only messenger for transactions, got %+v", producer)
+		}
+		if err := producer.Consume(context.Background(), nil); err == nil {
+			t.Error("expected consuming from a producer to fail")
+		}
+	})
+
+	t.Run("should require a topic for every message", func(t *testing.T) {
+		producer, err := NewProducer([]string{"localhost:9092"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer producer.Close()
+
+		if err := producer.ProduceMessage(context.Background(), "key", "message"); err == nil {
+			t.Error("expected producing without a topic to fail")
+		}
+	})
+
+	t.Run("should require brokers", func(t *testing.T) {
+		if _, err := NewProducer(nil); err == nil {
+			t.Error("expected an error without brokers")
+		}
+	})
+}
+
+func TestNewConsumer(t *testing.T) {
+	t.Run("should only consume", func(t *testing.T) {
+		consumer, err := NewConsumer("transactions", "account_management", []string{"localhost:9092"},
+			WithAutoCreateTopics(false), WithBackpressure(BackpressurePolicy{Mode: BackpressureFail}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer consumer.Close()
+
+		if consumer.producer != nil || consumer.consumer == nil {
+			t.Errorf("expected a consumer-only messenger, got %+v", consumer)
+		}
+		if consumer.Backpressure.Mode != BackpressureFail {
+			t.Errorf("expected the backpressure policy to be set, got %+v", consumer.Backpressure)
+		}
+		if err := consumer.ProduceMessage(context.Background(), "key", "message"); err == nil {
+			t.Error("expected producing from a consumer to fail")
+		}
+	})
+
+	t.Run("should require a topic and a group", func(t *testing.T) {
+		if _, err := NewConsumer("", "account_management", []string{"localhost:9092"}); err == nil {
+			t.Error("expected an error without a topic")
+		}
+		if _, err := NewConsumer("transactions", "", []string{"localhost:9092"}); err == nil {
+			t.Error("expected an error without a group")
+		}
+	})
+}
+
+func TestToTopic(t *testing.T) {
+	broker := NewMemoryBroker(1)
+	messenger, err := broker.NewMessenger("transactions", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer messenger.Close()
+
+	if err := messenger.ProduceMessage(context.Background(), "key", "message", ToTopic("audit")); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := broker.Messages("audit"); len(messages) != 1 || string(messages[0].Value) != "message" {
+		t.Errorf("expected the message on audit, got %+v", messages)
+	}
+	if messages := broker.Messages("transactions"); len(messages) != 0 {
+		t.Errorf("expected nothing on transactions, got %+v", messages)
+	}
+}
+
+func TestRequestProducerOptions(t *testing.T) {
+	if o := newOptions(requestProducerOptions("replies", nil)); o.batchTimeout != defaultRequestBatchTimeout || o.topic != "replies" {
+		t.Errorf("expected a batch timeout of %s on replies, got %s on %q", defaultRequestBatchTimeout, o.batchTimeout, o.topic)
+	}
+	if o := newOptions(requestProducerOptions("replies", []Option{WithBatchTimeout(time.Second)})); o.batchTimeout != time.Second {
+		t.Errorf("expected the given batch timeout, got %s", o.batchTimeout)
+	}
+}
+
+func TestProduceMessages(t *testing.T) {
+	broker := NewMemoryBroker(1)
+	messenger, err := broker.NewMessenger("transactions", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = messenger.ProduceMessages(context.Background(),
+		Record{Key: "account-1", Value: "created"},
+		Record{Key: "account-1", Value: "audited", Options: []ProduceOption{ToTopic("audit")}},
+		Record{Key: "account-1", Value: "updated", Options: []ProduceOption{WithHeader("source", "test")}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := broker.Messages("transactions")
+	if len(messages) != 2 || string(messages[0].Value) != "created" || string(messages[1].Value) != "updated" {
+		t.Errorf("expected created and updated in order, got %+v", messages)
+	}
+	if source, _ := messages[len(messages)-1].Header("source"); source != "test" {
+		t.Errorf("expected the header of the record, got %q", source)
+	}
+	if audit := broker.Messages("audit"); len(audit) != 1 || string(audit[0].Value) != "audited" {
+		t.Errorf("expected the record on audit, got %+v", audit)
+	}
+
+	if err := messenger.ProduceMessages(context.Background()); err != nil {
+		t.Errorf("expected no error without records, got %v", err)
+	}
+	messenger.Close()
+	if err := messenger.ProduceMessages(context.Background(), Record{Value: "late"}); !errors.Is(err, ErrProducerClosed) {
+		t.Errorf("expected ErrProducerClosed, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const workerQueueCapacity = 16
+
+// ConsumeConcurrently works like Consume, but passes messages to handler from the given number of
+// workers at once.
+//
+// Messages are assigned to a worker by key, so messages sharing a key (e.g. an account id) are
+// handled one at a time and in order by the same worker, while messages with different keys are
+// handled in parallel. Messages without a key are assigned by partition instead.
+//
+// When fetching stops on Shutdown, the messages already queued are still handled until the shutdown
+// deadline. Since messages complete out of order, an offset is committed only once every earlier message of
+// its partition has been handled, so a restarted consumer never skips a message, although it may
+// handle again messages that had completed after a still pending one.
+//
+// Parameters:
+//   - ctx: context.Context for managing the consumer lifecycle
+//   - workers: the number of messages handled at once, at least 1
+//   - handler: the function that processes each message; it must be safe for concurrent use
+//
+// Returns:
+//   - error: an error if the consumer is not initialized, already started, or fails to fetch or commit
+//
+// Example usage:
+//
+//	err := messenger.ConsumeConcurrently(ctx, 8, func(ctx context.Context, msg Message) error {
+//	  return applyTransaction(ctx, msg.Key, msg.Value)
+//	})
+func (m *KafkaMessenger) ConsumeConcurrently(ctx context.Context, workers int, handler Handler) error {
+	if workers < 1 {
+		return fmt.Errorf("workers must be at least 1, got %d", workers)
+	}
+
+	run, err := m.beginConsuming(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.finishConsuming(run)
+
+	poolCtx, cancel := context.WithCancel(run.handleCtx)
+	defer cancel()
+	fetchCtx, stopFetching := context.WithCancel(run.fetchCtx)
+	defer stopFetching()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+			stopFetching()
+		})
+	}
+
+	tracker := newOffsetTracker()
+	queues := make([]chan kafka.Message, workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, workerQueueCapacity)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			for msg := range queue {
+				// Once aborted, queued messages are left uncommitted, to be redelivered.
+				if poolCtx.Err() != nil || !m.handle(poolCtx, handler, msg) {
+					run.abandon(msg)
+					continue
+				}
+				if err := m.commitCompleted(poolCtx, tracker, msg); err != nil {
+					fail(err)
+				}
+			}
+		}(queues[i])
+	}
+
+	// Once fetching stops, the queued messages are still handled until the run is aborted.
+	m.dispatch(fetchCtx, run, tracker, queues, fail)
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// dispatch fetches messages and queues them for their worker until ctx is done.
+func (m *KafkaMessenger) dispatch(ctx context.Context, run *consumerRun, tracker *offsetTracker, queues []chan kafka.Message, fail func(error)) {
+	for ctx.Err() == nil {
+		msg, err := m.consumer.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			m.metrics.observeError(m.Topic, m.GroupID, ErrorKindFetch)
+			if isNetworkError(err) {
+				m.logger().Warn("network error while fetching, retrying", "error", err)
+				if !sleepContext(ctx, 1*time.Second) {
+					return
+				}
+				continue
+			}
+			fail(fmt.Errorf("failed to fetch message: %w", err))
+			return
+		}
+		m.fetched(msg)
+
+		tracker.Fetched(msg)
+		select {
+		case queues[workerFor(msg, len(queues))] <- msg:
+		case <-ctx.Done():
+			run.abandon(msg)
+			return
+		}
+	}
+}
+
+// commitCompleted marks msg as handled and commits the highest offset of its partition below which
+// every message has been handled, if it moved forward.
+func (m *KafkaMessenger) commitCompleted(ctx context.Context, tracker *offsetTracker, msg kafka.Message) error {
+	tracker.commitMu.Lock()
+	defer tracker.commitMu.Unlock()
+
+	completed, ok := tracker.Completed(msg)
+	if !ok {
+		return nil
+	}
+	return m.commit(ctx, completed)
+}
+
+// workerFor returns the worker handling msg: the same one for every message with the same key.
+func workerFor(msg kafka.Message, workers int) int {
+	hash := fnv.New32a()
+	if len(msg.Key) > 0 {
+		hash.Write(msg.Key)
+	} else {
+		hash.Write([]byte(msg.Topic + "/" + strconv.Itoa(msg.Partition)))
+	}
+	return int(hash.Sum32() % uint32(workers))
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// offsetTracker follows the messages being handled, to find which offsets can be committed.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+
+	// commitMu keeps commits in order, so that an older offset never overwrites a newer one.
+	commitMu sync.Mutex
+}
+
+type partitionOffsets struct {
+	// pending holds the messages fetched and not yet committable, in offset order.
+	pending []kafka.Message
+	// handled holds the offsets of the pending messages that have been handled.
+	handled map[int64]bool
+	// committed is the offset of the last message found committable, or -1.
+	committed int64
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[partitionKey]*partitionOffsets)}
+}
+
+// Fetched records that msg was fetched and is about to be handled.
+//
+// A message at or below the last offset found committable was already handled, so it is not
+// tracked. A message at or below the last pending offset means the partition was rewound, e.g.
+// redelivered from its committed offset after a rebalance: the pending messages are fetched again,
+// so they are forgotten instead of being tracked twice.
+func (t *offsetTracker) Fetched(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{topic: msg.Topic, partition: msg.Partition}
+	offsets, ok := t.partitions[key]
+	if !ok {
+		offsets = &partitionOffsets{handled: make(map[int64]bool), committed: -1}
+		t.partitions[key] = offsets
+	}
+	if msg.Offset <= offsets.committed {
+		return
+	}
+	if n := len(offsets.pending); n > 0 && msg.Offset <= offsets.pending[n-1].Offset {
+		offsets.pending = nil
+		clear(offsets.handled)
+	}
+	offsets.pending = append(offsets.pending, msg)
+}
+
+// Completed records that msg was handled. If this completes a run of handled messages at the start
+// of its partition's pending messages, it returns the last of them, which is safe to commit.
+func (t *offsetTracker) Completed(msg kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	offsets, ok := t.partitions[partitionKey{topic: msg.Topic, partition: msg.Partition}]
+	if !ok || msg.Offset <= offsets.committed {
+		return kafka.Message{}, false
+	}
+	offsets.handled[msg.Offset] = true
+
+	var last kafka.Message
+	committable := false
+	for len(offsets.pending) > 0 && offsets.handled[offsets.pending[0].Offset] {
+		last = offsets.pending[0]
+		delete(offsets.handled, last.Offset)
+		offsets.pending = offsets.pending[1:]
+		committable = true
+	}
+	if committable {
+		offsets.committed = last.Offset
+	}
+	return last, committable
+}
@@ -0,0 +1,227 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestConsumeConcurrently(t *testing.T) {
+	t.Run("should handle messages with the same key in order and different keys in parallel", func(t *testing.T) {
+		broker := NewMemoryBroker(3)
+		messenger, err := broker.NewMessenger("transactions", "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		const keys, perKey = 8, 20
+		for i := 0; i < perKey; i++ {
+			for key := 0; key < keys; key++ {
+				messenger.ProduceMessage(context.Background(), fmt.Sprintf("account-%d", key), strconv.Itoa(i))
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var mu sync.Mutex
+		seen := make(map[string][]int)
+		var running, maxRunning, handled atomic.Int32
+		err = messenger.ConsumeConcurrently(ctx, 4, func(ctx context.Context, msg Message) error {
+			now := running.Add(1)
+			defer running.Add(-1)
+			for {
+				previous := maxRunning.Load()
+				if now <= previous || maxRunning.CompareAndSwap(previous, now) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+
+			value, _ := strconv.Atoi(string(msg.Value))
+			mu.Lock()
+			seen[msg.Key] = append(seen[msg.Key], value)
+			mu.Unlock()
+
+			if handled.Add(1) == keys*perKey {
+				cancel()
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for key, values := range seen {
+			for i, value := range values {
+				if value != i {
+					t.Fatalf("expected the messages of %s in order, got %v", key, values)
+				}
+			}
+		}
+		if maxRunning.Load() < 2 {
+			t.Errorf("expected messages to be handled in parallel, got at most %d at once", maxRunning.Load())
+		}
+	})
+
+	t.Run("should only commit contiguous handled offsets", func(t *testing.T) {
+		broker := NewMemoryBroker(1)
+		messenger, err := broker.NewMessenger("transactions", "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		slowKey, fastKey := keysOnDifferentWorkers(2)
+		messenger.ProduceMessage(context.Background(), slowKey, "slow")
+		for i := 0; i < 5; i++ {
+			messenger.ProduceMessage(context.Background(), fastKey, "fast")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		release := make(chan struct{})
+		var fastHandled atomic.Int32
+		stopped := make(chan error)
+		go func() {
+			stopped <- messenger.ConsumeConcurrently(ctx, 2, func(ctx context.Context, msg Message) error {
+				if msg.Key == slowKey {
+					<-release
+					return nil
+				}
+				fastHandled.Add(1)
+				return nil
+			})
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for fastHandled.Load() < 5 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if committed := broker.CommittedOffset("account_management", "transactions", 0); committed != -1 {
+			t.Errorf("expected nothing committed while offset 0 is pending, got %d", committed)
+		}
+
+		close(release)
+		for broker.CommittedOffset("account_management", "transactions", 0) != 6 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if committed := broker.CommittedOffset("account_management", "transactions", 0); committed != 6 {
+			t.Errorf("expected every offset to be committed, got %d", committed)
+		}
+
+		cancel()
+		if err := <-stopped; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should require at least one worker", func(t *testing.T) {
+		messenger, err := NewMemoryBroker(1).NewMessenger("transactions", "account_management")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.Close()
+
+		if err := messenger.ConsumeConcurrently(context.Background(), 0, nil); err == nil {
+			t.Error("expected an error without workers")
+		}
+	})
+}
+
+func TestOffsetTracker(t *testing.T) {
+	message := func(offset int64) kafka.Message {
+		return kafka.Message{Topic: "transactions", Partition: 0, Offset: offset}
+	}
+	type step struct {
+		completed int64
+		commit    int64
+	}
+	// complete completes the given offsets in order, checking the offset each one makes committable.
+	complete := func(t *testing.T, tracker *offsetTracker, steps ...step) {
+		t.Helper()
+		for _, step := range steps {
+			msg, ok := tracker.Completed(message(step.completed))
+			switch {
+			case step.commit < 0 && ok:
+				t.Errorf("expected nothing to commit after offset %d, got %d", step.completed, msg.Offset)
+			case step.commit >= 0 && (!ok || msg.Offset != step.commit):
+				t.Errorf("expected offset %d to be committable after offset %d, got %d (%v)", step.commit, step.completed, msg.Offset, ok)
+			}
+		}
+	}
+
+	t.Run("should commit the offsets below which every message has been handled", func(t *testing.T) {
+		tracker := newOffsetTracker()
+		for offset := range int64(5) {
+			tracker.Fetched(message(offset))
+		}
+
+		complete(t, tracker,
+			step{completed: 1, commit: -1},
+			step{completed: 2, commit: -1},
+			step{completed: 0, commit: 2},
+			step{completed: 4, commit: -1},
+			step{completed: 3, commit: 4},
+		)
+	})
+
+	t.Run("should track a partition redelivered after a rebalance from its committed offset", func(t *testing.T) {
+		tracker := newOffsetTracker()
+		for offset := range int64(4) {
+			tracker.Fetched(message(offset))
+		}
+		complete(t, tracker, step{completed: 0, commit: 0}, step{completed: 2, commit: -1})
+
+		// Offsets 1 to 3 are fetched again from the committed offset.
+		for offset := int64(1); offset < 4; offset++ {
+			tracker.Fetched(message(offset))
+		}
+		complete(t, tracker,
+			step{completed: 3, commit: -1},
+			step{completed: 1, commit: 1},
+			step{completed: 2, commit: 3},
+		)
+
+		partition := tracker.partitions[partitionKey{topic: "transactions", partition: 0}]
+		if len(partition.pending) != 0 || len(partition.handled) != 0 {
+			t.Errorf("expected nothing left pending, got %v and %v", partition.pending, partition.handled)
+		}
+	})
+
+	t.Run("should ignore the messages already committed", func(t *testing.T) {
+		tracker := newOffsetTracker()
+		tracker.Fetched(message(0))
+		tracker.Fetched(message(1))
+		complete(t, tracker, step{completed: 0, commit: 0}, step{completed: 1, commit: 1})
+
+		tracker.Fetched(message(1))
+		tracker.Fetched(message(2))
+		complete(t, tracker, step{completed: 1, commit: -1}, step{completed: 2, commit: 2})
+
+		partition := tracker.partitions[partitionKey{topic: "transactions", partition: 0}]
+		if partition.committed != 2 || len(partition.pending) != 0 || len(partition.handled) != 0 {
+			t.Errorf("expected offset 2 to be committed and nothing left pending, got %d, %v and %v", partition.committed, partition.pending, partition.handled)
+		}
+	})
+}
+
+// keysOnDifferentWorkers returns two keys assigned to different workers.
+func keysOnDifferentWorkers(workers int) (string, string) {
+	first := "account-0"
+	for i := 1; ; i++ {
+		key := fmt.Sprintf("account-%d", i)
+		if workerFor(kafka.Message{Key: []byte(key)}, workers) != workerFor(kafka.Message{Key: []byte(first)}, workers) {
+			return first, key
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package kafka
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// revokeTimeout bounds how long a revocation waits for the messages being handled, and how long
+// RebalanceListener.Revoked may take, before the partitions are handed over to another member.
+const revokeTimeout = 10 * time.Second
+
+const (
+	defaultJoinBackoff = 100 * time.Millisecond
+	maxJoinBackoff     = 5 * time.Second
+)
+
+// TopicPartition identifies a partition of a topic.
+type TopicPartition struct {
+	Topic     string
+	Partition int
+}
+
+func (tp TopicPartition) String() string {
+	return fmt.Sprintf("%s/%d", tp.Topic, tp.Partition)
+}
+
+// RebalanceListener is notified when the consumer group of a messenger assigns partitions to it or
+// takes them away. Either function may be nil.
+//
+// The group revokes every partition of its members before assigning them again, so after a
+// rebalance Revoked is called with all the partitions the messenger had, then Assigned with all
+// the partitions it has now, which may be the same ones.
+type RebalanceListener struct {
+	// Assigned is called with the partitions assigned to the messenger, before any of their
+	// messages is fetched. It is not called when no partition is assigned.
+	Assigned func(ctx context.Context, partitions []TopicPartition)
+	// Revoked is called with the partitions taken away from the messenger, when the group
+	// rebalances or the messenger is closed. The messages of these partitions fetched before have
+	// been handled and committed by then, unless that takes longer than 10 seconds or Shutdown
+	// abandoned them, so it is the place to flush the state kept per partition. ctx expires after
+	// 10 seconds, after which the partitions may be handed over to another member anyway.
+	Revoked func(ctx context.Context, partitions []TopicPartition)
+}
+
+// WithRebalanceListener sets the listener notified of the partitions assigned to the consumer and
+// revoked from it, and enables Assignments. An empty RebalanceListener only enables Assignments.
+// It only applies to consumers with a group ID.
+//
+// A MemoryBroker consumer notices that its group rebalanced when it next fetches a message, so its
+// listener is called from FetchMessage, after the other members may have started reading the
+// revoked partitions.
+//
+// Example usage:
+//
+//	consumer, err := NewConsumer("transactions", "account_management", brokers, WithRebalanceListener(RebalanceListener{
+//	  Revoked: func(ctx context.Context, partitions []TopicPartition) {
+//	    balances.Flush(ctx, partitions)
+//	  },
+//	}))
+func WithRebalanceListener(listener RebalanceListener) Option {
+	return func(o *options) {
+		o.rebalanceListener = &listener
+	}
+}
+
+// assignmentReporter is implemented by the consumers that track their partitions.
+type assignmentReporter interface {
+	assignments() []TopicPartition
+}
+
+// Assignments returns the partitions currently assigned to the consumer, sorted by topic and
+// partition. It returns nil if the consumer was created without WithRebalanceListener or without a
+// group ID, or if the consumer group has not assigned any partition to it yet.
+//
+// Returns:
+//   - []TopicPartition: the partitions assigned to the consumer
+//
+// Example usage:
+//
+//	for _, tp := range consumer.Assignments() {
+//	  log.Printf("consuming %s", tp)
+//	}
+func (m *KafkaMessenger) Assignments() []TopicPartition {
+	reporter, ok := m.consumer.(assignmentReporter)
+	if !ok {
+		return nil
+	}
+	return reporter.assignments()
+}
+
+// sortPartitions sorts partitions by topic and partition.
+func sortPartitions(partitions []TopicPartition) {
+	slices.SortFunc(partitions, func(a, b TopicPartition) int {
+		return cmp.Or(cmp.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+	})
+}
+
+// notifyAssigned calls the listener's Assigned function, if any, unless partitions is empty.
+func (l *RebalanceListener) notifyAssigned(ctx context.Context, partitions []TopicPartition) {
+	if l != nil && l.Assigned != nil && len(partitions) > 0 {
+		l.Assigned(ctx, partitions)
+	}
+}
+
+// notifyRevoked calls the listener's Revoked function, if any, unless partitions is empty.
+func (l *RebalanceListener) notifyRevoked(ctx context.Context, partitions []TopicPartition) {
+	if l != nil && l.Revoked != nil && len(partitions) > 0 {
+		l.Revoked(ctx, partitions)
+	}
+}
+
+// groupMessage is a message fetched by a groupReader, with the generation it was fetched in.
+type groupMessage struct {
+	msg        kafka.Message
+	generation int32
+}
+
+// partitionProgress tracks the offsets of a partition assigned to a groupReader.
+type partitionProgress struct {
+	fetched   int64
+	committed int64
+}
+
+// groupReader implements messageReader on top of a kafka.ConsumerGroup, reading every assigned
+// partition with its own kafka.Reader, so that it can notify a RebalanceListener and report its
+// assignments, which a kafka.Reader does not expose.
+type groupReader struct {
+	group    *kafka.ConsumerGroup
+	groupID  string
+	listener *RebalanceListener
+	logger   func() *slog.Logger
+	metrics  *Metrics
+	// newPartitionReader creates the reader of one assigned partition.
+	newPartitionReader func(topic string, partition int) *kafka.Reader
+	// nextGeneration waits for the next generation of the group; it is replaced in tests.
+	nextGeneration func(ctx context.Context) (*kafka.Generation, error)
+	// commitOffsets commits offsets in a generation; it is replaced in tests.
+	commitOffsets func(gen *kafka.Generation, offsets map[string]map[int]int64) error
+	// closeGroup leaves the group, ending its generation; it is replaced in tests.
+	closeGroup func() error
+
+	messages  chan groupMessage
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	closing   chan struct{}
+	done      chan struct{}
+
+	mu sync.Mutex
+	// generation is the generation the partitions are assigned in, nil between generations.
+	generation *kafka.Generation
+	// fetching is the ID of the generation whose messages are fetched, -1 once it is being revoked.
+	fetching   int32
+	partitions map[TopicPartition]*partitionProgress
+	// changed is closed and replaced whenever an offset is committed.
+	changed chan struct{}
+}
+
+func (m *KafkaMessenger) newGroupReader(o options, conn connection) (*groupReader, error) {
+	logger, errorLogger := m.kafkaLoggers()
+	topics := m.Topics
+	if len(topics) == 0 {
+		topics = []string{m.Topic}
+	}
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:                m.GroupID,
+		Brokers:           m.BrokerAddresses,
+		Dialer:            conn.dialer,
+		Topics:            topics,
+		StartOffset:       int64(o.startOffset),
+		RetentionTime:     defaultRetentionTime,
+		HeartbeatInterval: o.heartbeatInterval,
+		SessionTimeout:    o.sessionTimeout,
+		Logger:            logger,
+		ErrorLogger:       errorLogger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer group: %w", err)
+	}
+
+	r := newGroupReaderOf(group, o.rebalanceListener, m.logger)
+	r.groupID = m.GroupID
+	r.metrics = m.metrics
+	r.newPartitionReader = func(topic string, partition int) *kafka.Reader {
+		return kafka.NewReader(kafka.ReaderConfig{
+			Brokers:       m.BrokerAddresses,
+			Topic:         topic,
+			Partition:     partition,
+			Dialer:        conn.dialer,
+			Logger:        logger,
+			ErrorLogger:   errorLogger,
+			QueueCapacity: o.queueCapacity,
+			MaxAttempts:   defaultReaderMaxAttempts,
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.run(ctx)
+	return r, nil
+}
+
+func newGroupReaderOf(group *kafka.ConsumerGroup, listener *RebalanceListener, logger func() *slog.Logger) *groupReader {
+	return &groupReader{
+		group:          group,
+		listener:       listener,
+		logger:         logger,
+		nextGeneration: group.Next,
+		commitOffsets:  (*kafka.Generation).CommitOffsets,
+		closeGroup:     group.Close,
+		messages:       make(chan groupMessage),
+		cancel:         func() {},
+		closing:        make(chan struct{}),
+		done:           make(chan struct{}),
+		fetching:       -1,
+		partitions:     make(map[TopicPartition]*partitionProgress),
+		changed:        make(chan struct{}),
+	}
+}
+
+// run follows the generations of the group until the reader is closed. While the group cannot be
+// joined, it retries with an exponential backoff, from 100ms up to 5s.
+func (r *groupReader) run(ctx context.Context) {
+	defer close(r.done)
+	backoff := defaultJoinBackoff
+	for {
+		gen, err := r.nextGeneration(ctx)
+		if err != nil {
+			if errors.Is(err, kafka.ErrGroupClosed) || ctx.Err() != nil {
+				return
+			}
+			r.logger().Warn("failed to join consumer group, retrying", "backoff", backoff, "error", err)
+			if !sleepContext(ctx, backoff) {
+				return
+			}
+			backoff = min(backoff*2, maxJoinBackoff)
+			continue
+		}
+		backoff = defaultJoinBackoff
+
+		assigned := r.assign(gen)
+		r.listener.notifyAssigned(ctx, assigned)
+		for topic, partitions := range gen.Assignments {
+			for _, assignment := range partitions {
+				gen.Start(func(genCtx context.Context) {
+					r.readPartition(genCtx, gen.ID, topic, assignment)
+				})
+			}
+		}
+		// The generation only ends once every function it started returned, so the partitions are
+		// not handed over before they are revoked.
+		gen.Start(func(genCtx context.Context) {
+			<-genCtx.Done()
+			revokeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), revokeTimeout)
+			defer cancel()
+			r.listener.notifyRevoked(revokeCtx, r.revoke(revokeCtx))
+		})
+	}
+}
+
+// assign starts fetching the messages of gen's partitions and returns them.
+func (r *groupReader) assign(gen *kafka.Generation) []TopicPartition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation = gen
+	r.fetching = gen.ID
+	r.partitions = make(map[TopicPartition]*partitionProgress)
+	for topic, partitions := range gen.Assignments {
+		for _, assignment := range partitions {
+			r.partitions[TopicPartition{Topic: topic, Partition: assignment.ID}] = &partitionProgress{
+				fetched:   assignment.Offset,
+				committed: assignment.Offset,
+			}
+		}
+	}
+	return r.assignmentsLocked()
+}
+
+// revoke stops fetching the messages of the current generation, waits until the messages fetched
+// are committed, ctx expires or the reader is closed, and returns the partitions of the generation.
+// Once the reader is closed, the messages left uncommitted were abandoned, so it does not wait for them.
+func (r *groupReader) revoke(ctx context.Context) []TopicPartition {
+	r.mu.Lock()
+	r.fetching = -1
+	for !r.committedLocked() {
+		changed := r.changed
+		r.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			r.logger().Warn("revoking partitions before the messages fetched are committed, they will be delivered again", "error", ctx.Err())
+			r.mu.Lock()
+			return r.clearLocked()
+		case <-r.closing:
+			r.logger().Warn("closing before the messages fetched are committed, they will be delivered again")
+			r.mu.Lock()
+			return r.clearLocked()
+		}
+		r.mu.Lock()
+	}
+	defer r.mu.Unlock()
+	return r.clearLocked()
+}
+
+func (r *groupReader) committedLocked() bool {
+	for _, progress := range r.partitions {
+		if progress.committed < progress.fetched {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *groupReader) clearLocked() []TopicPartition {
+	revoked := r.assignmentsLocked()
+	r.generation = nil
+	r.partitions = make(map[TopicPartition]*partitionProgress)
+	return revoked
+}
+
+// readPartition passes the messages of an assigned partition to FetchMessage until ctx is done.
+func (r *groupReader) readPartition(ctx context.Context, generation int32, topic string, assignment kafka.PartitionAssignment) {
+	reader := r.newPartitionReader(topic, assignment.ID)
+	defer reader.Close()
+	r.metrics.trackReader(reader, topic, r.groupID)
+	defer r.metrics.untrackReader(reader)
+
+	if err := reader.SetOffset(assignment.Offset); err != nil {
+		r.logger().Error("failed to read assigned partition", "topic", topic, "partition", assignment.ID, "error", err)
+		<-ctx.Done()
+		return
+	}
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.logger().Warn("failed to fetch message, retrying", "topic", topic, "partition", assignment.ID, "error", err)
+			if !sleepContext(ctx, time.Second) {
+				return
+			}
+			continue
+		}
+		select {
+		case r.messages <- groupMessage{msg: msg, generation: generation}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *groupReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		select {
+		case fetched := <-r.messages:
+			r.mu.Lock()
+			progress, ok := r.partitions[TopicPartition{Topic: fetched.msg.Topic, Partition: fetched.msg.Partition}]
+			if fetched.generation != r.fetching || !ok {
+				// The partition is being revoked; the message will be delivered to its next owner.
+				r.mu.Unlock()
+				continue
+			}
+			progress.fetched = max(progress.fetched, fetched.msg.Offset+1)
+			r.mu.Unlock()
+			return fetched.msg, nil
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-r.closing:
+			return kafka.Message{}, io.EOF
+		}
+	}
+}
+
+// CommitMessages commits the offsets of msgs in the current generation. The messages of partitions
+// that are no longer assigned, and the commits refused because the group is rebalancing, are
+// skipped: the messages will be delivered again to the partitions' next owners. A refused commit
+// does not count as committed, so a revocation keeps waiting for the messages until it times out.
+func (r *groupReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	gen := r.generation
+	offsets := make(map[string]map[int]int64)
+	for _, msg := range msgs {
+		if _, ok := r.partitions[TopicPartition{Topic: msg.Topic, Partition: msg.Partition}]; !ok || gen == nil {
+			r.logger().Debug("skipping commit of revoked partition", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+			continue
+		}
+		if offsets[msg.Topic] == nil {
+			offsets[msg.Topic] = make(map[int]int64)
+		}
+		offsets[msg.Topic][msg.Partition] = max(offsets[msg.Topic][msg.Partition], msg.Offset+1)
+	}
+	r.mu.Unlock()
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	err := r.commitOffsets(gen, offsets)
+	if err != nil && !errors.Is(err, kafka.RebalanceInProgress) && !errors.Is(err, kafka.IllegalGeneration) && !errors.Is(err, kafka.UnknownMemberId) {
+		return err
+	}
+	if err != nil {
+		r.logger().Warn("skipping commit refused during a rebalance, the messages will be delivered again", "error", err)
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation == gen {
+		for topic, partitions := range offsets {
+			for partition, offset := range partitions {
+				if progress, ok := r.partitions[TopicPartition{Topic: topic, Partition: partition}]; ok {
+					progress.committed = max(progress.committed, offset)
+				}
+			}
+		}
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+	return nil
+}
+
+// Close leaves the consumer group, once the partitions are revoked.
+func (r *groupReader) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.closing)
+		r.cancel()
+		err = r.closeGroup()
+		<-r.done
+	})
+	return err
+}
+
+func (r *groupReader) assignments() []TopicPartition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.assignmentsLocked()
+}
+
+func (r *groupReader) assignmentsLocked() []TopicPartition {
+	if len(r.partitions) == 0 {
+		return nil
+	}
+	partitions := make([]TopicPartition, 0, len(r.partitions))
+	for tp := range r.partitions {
+		partitions = append(partitions, tp)
+	}
+	sortPartitions(partitions)
+	return partitions
+}
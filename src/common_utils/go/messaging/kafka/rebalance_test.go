@@ -0,0 +1,348 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// rebalanceEvents records the notifications of a RebalanceListener.
+type rebalanceEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *rebalanceEvents) Listener() RebalanceListener {
+	record := func(kind string) func(context.Context, []TopicPartition) {
+		return func(ctx context.Context, partitions []TopicPartition) {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.events = append(e.events, fmt.Sprintf("%s %v", kind, partitions))
+		}
+	}
+	return RebalanceListener{Assigned: record("assigned"), Revoked: record("revoked")}
+}
+
+func (e *rebalanceEvents) String() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return strings.Join(e.events, ", ")
+}
+
+func TestMemoryRebalanceListener(t *testing.T) {
+	consume := func(t *testing.T, messenger *KafkaMessenger) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- messenger.Consume(ctx, func(ctx context.Context, msg Message) error { return nil })
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+	}
+	assignments := func(messenger *KafkaMessenger) string {
+		return fmt.Sprint(messenger.Assignments())
+	}
+
+	t.Run("should notify the members of a group of their partitions", func(t *testing.T) {
+		broker := NewMemoryBroker(4)
+		var first, second rebalanceEvents
+		a, _ := broker.NewMessenger("transactions", "account_management", WithRebalanceListener(first.Listener()))
+		defer a.Close()
+		b, _ := broker.NewMessenger("transactions", "account_management", WithRebalanceListener(second.Listener()))
+
+		consume(t, a)
+		waitFor(t, func() bool { return assignments(a) == "[transactions/0 transactions/1 transactions/2 transactions/3]" })
+
+		consume(t, b)
+		waitFor(t, func() bool {
+			return assignments(a) == "[transactions/0 transactions/2]" && assignments(b) == "[transactions/1 transactions/3]"
+		})
+		expected := "assigned [transactions/0 transactions/1 transactions/2 transactions/3], " +
+			"revoked [transactions/0 transactions/1 transactions/2 transactions/3], " +
+			"assigned [transactions/0 transactions/2]"
+		if first.String() != expected {
+			t.Errorf("expected %q, got %q", expected, first.String())
+		}
+
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if second.String() != "assigned [transactions/1 transactions/3], revoked [transactions/1 transactions/3]" {
+			t.Errorf("expected the second member to be notified of its partitions, got %q", second.String())
+		}
+		if b.Assignments() != nil {
+			t.Errorf("expected a closed member to have no partition, got %v", b.Assignments())
+		}
+		waitFor(t, func() bool { return len(a.Assignments()) == 4 })
+	})
+
+	t.Run("should notify a multi-topic consumer once per rebalance", func(t *testing.T) {
+		broker := NewMemoryBroker(2)
+		var events rebalanceEvents
+		consumer, err := broker.NewMultiTopicConsumer([]string{"users", "transactions"}, "account_management", WithRebalanceListener(events.Listener()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		consume(t, consumer)
+		waitFor(t, func() bool { return len(consumer.Assignments()) == 4 })
+		consumer.Close()
+
+		partitions := "[transactions/0 transactions/1 users/0 users/1]"
+		if events.String() != "assigned "+partitions+", revoked "+partitions {
+			t.Errorf("expected the partitions of both topics to be assigned and revoked, got %q", events.String())
+		}
+	})
+
+	t.Run("should only report the assignments of a group member with a listener", func(t *testing.T) {
+		broker := NewMemoryBroker(2)
+		withoutListener, _ := broker.NewMessenger("transactions", "account_management")
+		defer withoutListener.Close()
+		withoutGroup, _ := broker.NewMessenger("transactions", "", WithRebalanceListener(RebalanceListener{}))
+		defer withoutGroup.Close()
+
+		consume(t, withoutListener)
+		consume(t, withoutGroup)
+		time.Sleep(10 * time.Millisecond)
+		if withoutListener.Assignments() != nil || withoutGroup.Assignments() != nil {
+			t.Errorf("expected no assignments, got %v and %v", withoutListener.Assignments(), withoutGroup.Assignments())
+		}
+	})
+}
+
+func TestGroupReader(t *testing.T) {
+	generation := func(id int32, partitions ...int) *kafka.Generation {
+		gen := &kafka.Generation{ID: id, Assignments: map[string][]kafka.PartitionAssignment{}}
+		for _, partition := range partitions {
+			gen.Assignments["transactions"] = append(gen.Assignments["transactions"], kafka.PartitionAssignment{ID: partition, Offset: kafka.FirstOffset})
+		}
+		return gen
+	}
+	message := func(partition int, offset int64) kafka.Message {
+		return kafka.Message{Topic: "transactions", Partition: partition, Offset: offset}
+	}
+	deliver := func(r *groupReader, generation int32, msgs ...kafka.Message) {
+		go func() {
+			for _, msg := range msgs {
+				r.messages <- groupMessage{msg: msg, generation: generation}
+			}
+		}()
+	}
+	newReader := func(commitErr error) (*groupReader, *[]map[string]map[int]int64) {
+		var commits []map[string]map[int]int64
+		r := newGroupReaderOf(nil, nil, quietLogger)
+		r.commitOffsets = func(gen *kafka.Generation, offsets map[string]map[int]int64) error {
+			commits = append(commits, offsets)
+			return commitErr
+		}
+		return r, &commits
+	}
+	ctx := context.Background()
+
+	t.Run("should wait for the messages fetched to be committed before revoking", func(t *testing.T) {
+		r, commits := newReader(nil)
+		if assigned := r.assign(generation(1, 0, 1)); fmt.Sprint(assigned) != "[transactions/0 transactions/1]" {
+			t.Fatalf("expected partitions 0 and 1 to be assigned, got %v", assigned)
+		}
+		deliver(r, 1, message(1, 7))
+		msg, err := r.FetchMessage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		revoked := make(chan []TopicPartition, 1)
+		go func() { revoked <- r.revoke(ctx) }()
+		select {
+		case <-revoked:
+			t.Fatal("expected the revocation to wait for the commit")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		if err := r.CommitMessages(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+		if partitions := <-revoked; fmt.Sprint(partitions) != "[transactions/0 transactions/1]" {
+			t.Errorf("expected partitions 0 and 1 to be revoked, got %v", partitions)
+		}
+		if fmt.Sprint(*commits) != "[map[transactions:map[1:8]]]" {
+			t.Errorf("expected offset 8 of partition 1 to be committed, got %v", *commits)
+		}
+		if r.assignments() != nil {
+			t.Errorf("expected no assignments after the revocation, got %v", r.assignments())
+		}
+	})
+
+	t.Run("should give up waiting for the commits after a timeout", func(t *testing.T) {
+		r, _ := newReader(nil)
+		r.assign(generation(1, 0))
+		deliver(r, 1, message(0, 0))
+		if _, err := r.FetchMessage(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if partitions := r.revoke(timeoutCtx); len(partitions) != 1 {
+			t.Errorf("expected partition 0 to be revoked, got %v", partitions)
+		}
+	})
+
+	t.Run("should drop the messages of a previous generation", func(t *testing.T) {
+		r, commits := newReader(nil)
+		r.assign(generation(1, 0))
+		r.revoke(ctx)
+		r.assign(generation(2, 1))
+
+		deliver(r, 1, message(0, 3))
+		deliver(r, 2, message(1, 4))
+		msg, err := r.FetchMessage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Partition != 1 {
+			t.Errorf("expected the message of partition 1, got partition %d", msg.Partition)
+		}
+
+		if err := r.CommitMessages(ctx, message(0, 3)); err != nil {
+			t.Fatal(err)
+		}
+		if len(*commits) != 0 {
+			t.Errorf("expected the commit of a revoked partition to be skipped, got %v", *commits)
+		}
+	})
+
+	t.Run("should skip the commits refused during a rebalance", func(t *testing.T) {
+		r, _ := newReader(fmt.Errorf("commit failed: %w", kafka.RebalanceInProgress))
+		r.assign(generation(1, 0))
+		deliver(r, 1, message(0, 0))
+		msg, _ := r.FetchMessage(ctx)
+
+		if err := r.CommitMessages(ctx, msg); err != nil {
+			t.Errorf("expected the refused commit to be skipped, got %v", err)
+		}
+		timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		r.revoke(timeoutCtx)
+		if timeoutCtx.Err() == nil {
+			t.Error("expected the revocation to wait for the message whose commit was refused")
+		}
+
+		failing, _ := newReader(errors.New("broker unavailable"))
+		failing.assign(generation(1, 0))
+		if err := failing.CommitMessages(ctx, message(0, 0)); err == nil {
+			t.Error("expected other commit errors to be returned")
+		}
+	})
+	t.Run("should back off while the group cannot be joined", func(t *testing.T) {
+		r, _ := newReader(nil)
+		var mu sync.Mutex
+		var attempts []time.Time
+		r.nextGeneration = func(ctx context.Context) (*kafka.Generation, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, time.Now())
+			return nil, errors.New("coordinator not available")
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		go r.run(runCtx)
+		time.Sleep(350 * time.Millisecond)
+		cancel()
+		<-r.done
+
+		mu.Lock()
+		defer mu.Unlock()
+		// Waiting 100ms, 200ms then 400ms leaves room for 3 attempts.
+		if len(attempts) < 2 || len(attempts) > 3 {
+			t.Fatalf("expected 2 or 3 attempts, got %d", len(attempts))
+		}
+		for i := 1; i < len(attempts); i++ {
+			backoff := defaultJoinBackoff << (i - 1)
+			if waited := attempts[i].Sub(attempts[i-1]); waited < backoff {
+				t.Errorf("expected attempt %d to wait %s, waited %s", i+1, backoff, waited)
+			}
+		}
+	})
+
+	t.Run("should collect the statistics of the partition readers while they are read", func(t *testing.T) {
+		r, _ := newReader(nil)
+		r.groupID = "account_management"
+		r.metrics = NewMetrics()
+		r.newPartitionReader = func(topic string, partition int) *kafka.Reader {
+			return kafka.NewReader(kafka.ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: topic, Partition: partition})
+		}
+		tracked := func() int {
+			r.metrics.mu.Lock()
+			defer r.metrics.mu.Unlock()
+			return len(r.metrics.readers)
+		}
+
+		readCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r.readPartition(readCtx, 1, "transactions", kafka.PartitionAssignment{ID: 0, Offset: kafka.FirstOffset})
+		}()
+		waitFor(t, func() bool { return tracked() == 1 })
+		if count := testutil.CollectAndCount(r.metrics, "kafka_reader_fetches_total"); count != 1 {
+			t.Errorf("expected the partition reader to be reported, got %d series", count)
+		}
+
+		cancel()
+		<-done
+		if tracked() != 0 {
+			t.Error("expected the partition reader not to be collected once its partition is revoked")
+		}
+	})
+	t.Run("should not keep Shutdown waiting for an abandoned message", func(t *testing.T) {
+		r, _ := newReader(nil)
+		r.assign(generation(1, 0))
+		deliver(r, 1, message(0, 0))
+		// The group ends the generation once it is left, and revokes its partitions as run does.
+		left := make(chan struct{})
+		r.closeGroup = func() error {
+			close(left)
+			return nil
+		}
+		go func() {
+			defer close(r.done)
+			<-left
+			revokeCtx, cancel := context.WithTimeout(ctx, revokeTimeout)
+			defer cancel()
+			r.revoke(revokeCtx)
+		}()
+
+		messenger := newMessenger("transactions", "account_management", nil, newOptions(nil))
+		messenger.consumer = r
+		handling := make(chan struct{})
+		go messenger.Consume(ctx, func(ctx context.Context, msg Message) error {
+			close(handling)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		<-handling
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		report, _ := messenger.Shutdown(shutdownCtx)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected Shutdown to return by its deadline, took %s", elapsed)
+		}
+		if len(report.Abandoned) != 1 {
+			t.Errorf("expected the message being handled to be abandoned, got %v", report.Abandoned)
+		}
+	})
+}
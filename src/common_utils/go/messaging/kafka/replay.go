@@ -0,0 +1,419 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const encodingBase64 = "base64"
+
+// DumpRange selects the messages of a topic that Dump writes. Zero fields leave the range open,
+// and the range always ends at the last message of each partition when the dump starts.
+type DumpRange struct {
+	// Since and Until select the messages produced from Since, included, to Until, excluded.
+	Since time.Time
+	Until time.Time
+	// FromOffset and ToOffset select the offsets of every partition from FromOffset, included, to
+	// ToOffset, excluded.
+	FromOffset int64
+	ToOffset   int64
+}
+
+// dumpRecord is a message as written by Dump, one JSON object per line. If the key, the value or a
+// header value is not valid UTF-8, all of them are base64-encoded and Encoding is "base64".
+type dumpRecord struct {
+	Topic     string       `json:"topic"`
+	Partition int          `json:"partition"`
+	Offset    int64        `json:"offset"`
+	Time      time.Time    `json:"time"`
+	Key       string       `json:"key,omitempty"`
+	Value     string       `json:"value"`
+	Headers   []dumpHeader `json:"headers,omitempty"`
+	Encoding  string       `json:"encoding,omitempty"`
+}
+
+type dumpHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func newDumpRecord(msg kafka.Message) dumpRecord {
+	encode := func(data []byte) string { return string(data) }
+	encoding := ""
+	if !utf8.Valid(msg.Key) || !utf8.Valid(msg.Value) || !validHeaders(msg.Headers) {
+		encode, encoding = base64.StdEncoding.EncodeToString, encodingBase64
+	}
+
+	record := dumpRecord{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Time:      msg.Time,
+		Key:       encode(msg.Key),
+		Value:     encode(msg.Value),
+		Encoding:  encoding,
+	}
+	for _, header := range msg.Headers {
+		record.Headers = append(record.Headers, dumpHeader{Key: header.Key, Value: encode(header.Value)})
+	}
+	return record
+}
+
+func validHeaders(headers []kafka.Header) bool {
+	for _, header := range headers {
+		if !utf8.Valid(header.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r dumpRecord) message() (Message, error) {
+	decode := func(data string) ([]byte, error) { return []byte(data), nil }
+	switch r.Encoding {
+	case "":
+	case encodingBase64:
+		decode = base64.StdEncoding.DecodeString
+	default:
+		return Message{}, fmt.Errorf("unknown encoding %q", r.Encoding)
+	}
+
+	key, err := decode(r.Key)
+	if err != nil {
+		return Message{}, fmt.Errorf("invalid key: %w", err)
+	}
+	value, err := decode(r.Value)
+	if err != nil {
+		return Message{}, fmt.Errorf("invalid value: %w", err)
+	}
+	msg := Message{Topic: r.Topic, Partition: r.Partition, Offset: r.Offset, Key: string(key), Value: value, Time: r.Time}
+	for _, header := range r.Headers {
+		value, err := decode(header.Value)
+		if err != nil {
+			return Message{}, fmt.Errorf("invalid header %s: %w", header.Key, err)
+		}
+		msg.Headers = append(msg.Headers, Header{Key: header.Key, Value: value})
+	}
+	return msg, nil
+}
+
+// Dumper reads ranges of topics for Dump, without joining a consumer group or committing offsets.
+type Dumper struct {
+	source topicReader
+}
+
+// topicReader gives access to the partitions of the topics, for Dumper.
+type topicReader interface {
+	// partitions returns the partitions of the topic, with their first and last offsets.
+	partitions(ctx context.Context, topic string) ([]PartitionInfo, error)
+	// offsetAt returns the offset of the first message of the partition produced at or after t, or
+	// its last offset if there is none.
+	offsetAt(ctx context.Context, topic string, partition PartitionInfo, t time.Time) (int64, error)
+	// open starts reading the partition at offset.
+	open(topic string, partition int, offset int64) (partitionReader, error)
+}
+
+// partitionReader is the subset of *kafka.Reader used to read a single partition.
+type partitionReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// NewDumper creates a Dumper for the cluster of the given brokers.
+//
+// Parameters:
+//   - brokerAddresses: the addresses of the Kafka brokers to connect to
+//   - opts: optional settings; only WithTLS and WithSASL apply
+//
+// Returns:
+//   - *Dumper: a new Dumper
+//   - error: an error if the broker address is empty or the TLS or SASL settings are invalid
+func NewDumper(brokerAddresses []string, opts ...Option) (*Dumper, error) {
+	source, err := newKafkaTopicReader(brokerAddresses, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &Dumper{source: source}, nil
+}
+
+// Dump writes the messages of a topic in the given range to w as NDJSON: one JSON object per line
+// with the topic, partition, offset, time, key, value and headers of a message. Partitions are
+// written one after the other, each in offset order, so Replay keeps the order of every key.
+//
+// Parameters:
+//   - ctx: the context to stop the dump with
+//   - topic: the topic to dump
+//   - w: where to write the messages
+//   - r: the range of messages to dump; the zero DumpRange dumps every retained message
+//
+// Returns:
+//   - int: the number of messages written
+//   - error: an error if the topic cannot be read or w cannot be written
+//
+// Example usage:
+//
+//	file, err := os.Create("transactions.ndjson")
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer file.Close()
+//	count, err := dumper.Dump(ctx, "transactions", file, DumpRange{Since: incidentStart})
+func (d *Dumper) Dump(ctx context.Context, topic string, w io.Writer, r DumpRange) (int, error) {
+	partitions, err := d.source.partitions(ctx, topic)
+	if err != nil {
+		return 0, err
+	}
+
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	count := 0
+	for _, partition := range partitions {
+		start, end, err := d.bounds(ctx, topic, partition, r)
+		if err != nil {
+			return count, err
+		}
+		if start >= end {
+			continue
+		}
+
+		written, err := d.dumpPartition(ctx, topic, partition.ID, start, end, encoder)
+		count += written
+		if err != nil {
+			return count, err
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return count, fmt.Errorf("failed to write the dump: %w", err)
+	}
+	return count, nil
+}
+
+// bounds returns the offsets of the partition to dump, from start, included, to end, excluded.
+func (d *Dumper) bounds(ctx context.Context, topic string, partition PartitionInfo, r DumpRange) (start, end int64, err error) {
+	start, end = max(partition.FirstOffset, r.FromOffset), partition.LastOffset
+	if r.ToOffset > 0 {
+		end = min(end, r.ToOffset)
+	}
+	if !r.Since.IsZero() {
+		since, err := d.source.offsetAt(ctx, topic, partition, r.Since)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = max(start, since)
+	}
+	if !r.Until.IsZero() {
+		until, err := d.source.offsetAt(ctx, topic, partition, r.Until)
+		if err != nil {
+			return 0, 0, err
+		}
+		end = min(end, until)
+	}
+	return start, end, nil
+}
+
+func (d *Dumper) dumpPartition(ctx context.Context, topic string, partition int, start, end int64, encoder *json.Encoder) (int, error) {
+	reader, err := d.source.open(topic, partition, start)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s partition %d: %w", topic, partition, err)
+	}
+	defer reader.Close()
+
+	count := 0
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			return count, fmt.Errorf("failed to read %s partition %d: %w", topic, partition, err)
+		}
+		if msg.Offset >= end {
+			return count, nil
+		}
+		if err := encoder.Encode(newDumpRecord(msg)); err != nil {
+			return count, fmt.Errorf("failed to write the dump: %w", err)
+		}
+		count++
+		if msg.Offset == end-1 {
+			return count, nil
+		}
+	}
+}
+
+// kafkaTopicReader implements topicReader on top of Kafka brokers.
+type kafkaTopicReader struct {
+	admin   *Admin
+	brokers []string
+	dialer  *kafka.Dialer
+}
+
+func newKafkaTopicReader(brokerAddresses []string, o options) (*kafkaTopicReader, error) {
+	if len(brokerAddresses) == 0 {
+		return nil, fmt.Errorf("broker address is empty")
+	}
+	conn, err := newConnection(o)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaTopicReader{admin: newAdmin(brokerAddresses, conn), brokers: brokerAddresses, dialer: conn.dialer}, nil
+}
+
+func (r *kafkaTopicReader) partitions(ctx context.Context, topic string) ([]PartitionInfo, error) {
+	info, err := r.admin.DescribeTopic(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	return info.Partitions, nil
+}
+
+func (r *kafkaTopicReader) offsetAt(ctx context.Context, topic string, partition PartitionInfo, t time.Time) (int64, error) {
+	offsets, err := r.admin.listOffsets(ctx, topic, []int{partition.ID}, func(partition int) kafka.OffsetRequest {
+		return kafka.TimeOffsetOf(partition, t)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ResetToTime(t).resolve(partition, offsets[partition.ID]), nil
+}
+
+func (r *kafkaTopicReader) open(topic string, partition int, offset int64) (partitionReader, error) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   r.brokers,
+		Topic:     topic,
+		Partition: partition,
+		Dialer:    r.dialer,
+	})
+	if err := reader.SetOffset(offset); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// ReplayOption customizes Replay.
+type ReplayOption func(*replayOptions)
+
+type replayOptions struct {
+	topic          string
+	rate           int
+	dryRun         bool
+	keepTimestamps bool
+}
+
+// ReplayTo replays every message to the given topic instead of the topic it was dumped from.
+func ReplayTo(topic string) ReplayOption {
+	return func(o *replayOptions) {
+		o.topic = topic
+	}
+}
+
+// ReplayRate limits the replay to the given number of messages per second.
+func ReplayRate(perSecond int) ReplayOption {
+	return func(o *replayOptions) {
+		o.rate = perSecond
+	}
+}
+
+// ReplayDryRun reads and checks the whole dump without publishing anything.
+func ReplayDryRun() ReplayOption {
+	return func(o *replayOptions) {
+		o.dryRun = true
+	}
+}
+
+// ReplayTimestamps publishes the messages with the time they were originally produced at, instead
+// of the time they are replayed at. Beware that the broker may then delete them as soon as they
+// are written, if they are older than the retention of the topic.
+func ReplayTimestamps() ReplayOption {
+	return func(o *replayOptions) {
+		o.keepTimestamps = true
+	}
+}
+
+// Replay publishes the messages of a dump written by Dump, in the order of the dump, with their
+// keys and headers.
+//
+// Parameters:
+//   - ctx: the context to stop the replay with
+//   - r: the dump to read
+//   - publisher: the publisher to replay the messages with; it may be nil for a dry run
+//   - opts: optional settings such as another destination topic (ReplayTo), a rate limit (ReplayRate)
+//     or a dry run (ReplayDryRun)
+//
+// Returns:
+//   - int: the number of messages published, or that would be published in a dry run
+//   - error: an error if the dump is invalid or a message cannot be published; the messages before it were published
+//
+// Example usage:
+//
+//	file, err := os.Open("transactions.ndjson")
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer file.Close()
+//	count, err := Replay(ctx, file, producer, ReplayTo("transactions-reprocessing"), ReplayRate(500))
+func Replay(ctx context.Context, r io.Reader, publisher Publisher, opts ...ReplayOption) (int, error) {
+	var o replayOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.dryRun && publisher == nil {
+		return 0, fmt.Errorf("publisher is nil")
+	}
+
+	var interval time.Duration
+	if o.rate > 0 {
+		interval = time.Second / time.Duration(o.rate)
+	}
+	next := time.Now()
+
+	decoder := json.NewDecoder(r)
+	count := 0
+	for line := 1; ; line++ {
+		var record dumpRecord
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			return count, nil
+		} else if err != nil {
+			return count, fmt.Errorf("invalid dump at message %d: %w", line, err)
+		}
+		msg, err := record.message()
+		if err != nil {
+			return count, fmt.Errorf("invalid dump at message %d: %w", line, err)
+		}
+		topic := msg.Topic
+		if o.topic != "" {
+			topic = o.topic
+		}
+		if topic == "" {
+			return count, fmt.Errorf("invalid dump at message %d: topic is empty", line)
+		}
+		if o.dryRun {
+			count++
+			continue
+		}
+
+		if interval > 0 {
+			if wait := time.Until(next); wait > 0 && !sleepContext(ctx, wait) {
+				return count, ctx.Err()
+			}
+			if now := time.Now(); next.Before(now) {
+				next = now
+			}
+			next = next.Add(interval)
+		}
+		produceOpts := []ProduceOption{ToTopic(topic), WithHeaders(msg.Headers...)}
+		if o.keepTimestamps {
+			produceOpts = append(produceOpts, WithTimestamp(msg.Time))
+		}
+		if err := publisher.ProduceMessage(ctx, msg.Key, string(msg.Value), produceOpts...); err != nil {
+			return count, fmt.Errorf("failed to replay %s partition %d offset %d: %w", msg.Topic, msg.Partition, msg.Offset, err)
+		}
+		count++
+	}
+}
@@ -0,0 +1,224 @@
+//go:build unit
+
+package kafka_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+)
+
+func TestDump(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	broker := kafka.NewMemoryBroker(1)
+	messenger := newMemoryMessenger(t, broker, "transactions", "")
+	for i := 0; i < 10; i++ {
+		err := messenger.ProduceMessage(context.Background(), fmt.Sprintf("account-%d", i%2), fmt.Sprint(i),
+			kafka.WithTimestamp(start.Add(time.Duration(i)*time.Minute)),
+			kafka.WithHeader("traceparent", fmt.Sprintf("trace-%d", i)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dumper := broker.NewDumper()
+
+	t.Run("should dump every message with its key and headers", func(t *testing.T) {
+		var dump bytes.Buffer
+		count, err := dumper.Dump(context.Background(), "transactions", &dump, kafka.DumpRange{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 10 {
+			t.Errorf("expected 10 messages, got %d", count)
+		}
+		lines := strings.Split(strings.TrimSpace(dump.String()), "\n")
+		if len(lines) != 10 {
+			t.Fatalf("expected 10 lines, got %d", len(lines))
+		}
+		expected := `{"topic":"transactions","partition":0,"offset":3,"time":"2024-05-01T12:03:00Z","key":"account-1","value":"3","headers":[{"key":"traceparent","value":"trace-3"}]}`
+		if lines[3] != expected {
+			t.Errorf("expected %s, got %s", expected, lines[3])
+		}
+	})
+
+	t.Run("should dump a range of offsets", func(t *testing.T) {
+		messages := dumpMessages(t, dumper, "transactions", kafka.DumpRange{FromOffset: 2, ToOffset: 5})
+		if values := valuesOf(messages); fmt.Sprint(values) != "[2 3 4]" {
+			t.Errorf("expected the messages produced at offsets [2 3 4], got %v", values)
+		}
+	})
+
+	t.Run("should dump a range of time", func(t *testing.T) {
+		messages := dumpMessages(t, dumper, "transactions", kafka.DumpRange{Since: start.Add(7 * time.Minute), Until: start.Add(time.Hour)})
+		if values := valuesOf(messages); fmt.Sprint(values) != "[7 8 9]" {
+			t.Errorf("expected the messages produced at offsets [7 8 9], got %v", values)
+		}
+	})
+
+	t.Run("should dump nothing from an empty range", func(t *testing.T) {
+		messages := dumpMessages(t, dumper, "transactions", kafka.DumpRange{Since: start.Add(time.Hour)})
+		if len(messages) != 0 {
+			t.Errorf("expected no message, got %d", len(messages))
+		}
+	})
+
+	t.Run("should fail on an unknown topic", func(t *testing.T) {
+		if _, err := dumper.Dump(context.Background(), "unknown", &bytes.Buffer{}, kafka.DumpRange{}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestReplay(t *testing.T) {
+	dump := `{"topic":"transactions","partition":0,"offset":0,"time":"2024-05-01T12:00:00Z","key":"account-1","value":"first","headers":[{"key":"traceparent","value":"trace-0"}]}
+{"topic":"transactions","partition":0,"offset":1,"time":"2024-05-01T12:01:00Z","key":"AAE=","value":"/w==","encoding":"base64"}
+{"topic":"transactions","partition":0,"offset":2,"time":"2024-05-01T12:02:00Z","key":"account-1","value":"third"}
+`
+
+	t.Run("should replay a dump into its topic", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		producer := newMemoryMessenger(t, broker, "transactions", "")
+
+		count, err := kafka.Replay(context.Background(), strings.NewReader(dump), producer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Errorf("expected 3 replayed messages, got %d", count)
+		}
+
+		messages := broker.Messages("transactions")
+		if len(messages) != 3 {
+			t.Fatalf("expected 3 messages, got %d", len(messages))
+		}
+		if trace, _ := messages[0].Header("traceparent"); messages[0].Key != "account-1" || string(messages[0].Value) != "first" || trace != "trace-0" {
+			t.Errorf("expected the key, value and headers to be replayed, got %+v", messages[0])
+		}
+		if messages[1].Key != "\x00\x01" || !bytes.Equal(messages[1].Value, []byte{0xff}) {
+			t.Errorf("expected binary key and value to be decoded, got %q %q", messages[1].Key, messages[1].Value)
+		}
+		if messages[0].Time.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Error("expected the message to be replayed with a new timestamp")
+		}
+	})
+
+	t.Run("should replay a dump into another topic with its timestamps", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		producer := newMemoryMessenger(t, broker, "transactions", "")
+
+		if _, err := kafka.Replay(context.Background(), strings.NewReader(dump), producer, kafka.ReplayTo("reprocessing"), kafka.ReplayTimestamps()); err != nil {
+			t.Fatal(err)
+		}
+		if messages := broker.Messages("transactions"); len(messages) != 0 {
+			t.Errorf("expected nothing replayed into the original topic, got %d messages", len(messages))
+		}
+		messages := broker.Messages("reprocessing")
+		if len(messages) != 3 {
+			t.Fatalf("expected 3 messages, got %d", len(messages))
+		}
+		if expected := time.Date(2024, 5, 1, 12, 2, 0, 0, time.UTC); !messages[2].Time.Equal(expected) {
+			t.Errorf("expected timestamp %v, got %v", expected, messages[2].Time)
+		}
+	})
+
+	t.Run("should roundtrip a dump", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(3)
+		producer := newMemoryMessenger(t, broker, "transactions", "")
+		produceMessages(t, producer, 20)
+
+		var first bytes.Buffer
+		if _, err := broker.NewDumper().Dump(context.Background(), "transactions", &first, kafka.DumpRange{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := kafka.Replay(context.Background(), bytes.NewReader(first.Bytes()), producer, kafka.ReplayTo("copy"), kafka.ReplayTimestamps()); err != nil {
+			t.Fatal(err)
+		}
+		var second bytes.Buffer
+		if _, err := broker.NewDumper().Dump(context.Background(), "copy", &second, kafka.DumpRange{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := strings.ReplaceAll(first.String(), `"topic":"transactions"`, `"topic":"copy"`); second.String() != expected {
+			t.Errorf("expected the copy to match the original:\n%s\ngot:\n%s", expected, second.String())
+		}
+	})
+
+	t.Run("should publish nothing in a dry run", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		producer := newMemoryMessenger(t, broker, "transactions", "")
+
+		count, err := kafka.Replay(context.Background(), strings.NewReader(dump), producer, kafka.ReplayDryRun())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Errorf("expected 3 messages, got %d", count)
+		}
+		if messages := broker.Messages("transactions"); len(messages) != 0 {
+			t.Errorf("expected no message, got %d", len(messages))
+		}
+	})
+
+	t.Run("should limit the rate", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		producer := newMemoryMessenger(t, broker, "transactions", "")
+
+		begin := time.Now()
+		if _, err := kafka.Replay(context.Background(), strings.NewReader(dump), producer, kafka.ReplayRate(20)); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(begin); elapsed < 100*time.Millisecond {
+			t.Errorf("expected 3 messages at 20/s to take at least 100ms, took %v", elapsed)
+		}
+	})
+
+	t.Run("should stop at an invalid message", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		producer := newMemoryMessenger(t, broker, "transactions", "")
+
+		for _, invalid := range []string{
+			`{"topic":"transactions","value":"ok"}` + "\n" + `{"topic":`,
+			`{"topic":"transactions","value":"ok"}` + "\n" + `{"value":"no topic"}`,
+			`{"topic":"transactions","value":"ok"}` + "\n" + `{"topic":"transactions","value":"!","encoding":"base64"}`,
+		} {
+			count, err := kafka.Replay(context.Background(), strings.NewReader(invalid), producer, kafka.ReplayDryRun())
+			if err == nil || !strings.Contains(err.Error(), "message 2") {
+				t.Errorf("expected an error at message 2, got %v", err)
+			}
+			if count != 1 {
+				t.Errorf("expected 1 valid message, got %d", count)
+			}
+		}
+	})
+}
+
+func dumpMessages(t *testing.T, dumper *kafka.Dumper, topic string, r kafka.DumpRange) []kafka.Message {
+	t.Helper()
+
+	var dump bytes.Buffer
+	if _, err := dumper.Dump(context.Background(), topic, &dump, r); err != nil {
+		t.Fatal(err)
+	}
+	broker := kafka.NewMemoryBroker(1)
+	producer := newMemoryMessenger(t, broker, "dump", "")
+	if _, err := kafka.Replay(context.Background(), &dump, producer, kafka.ReplayTo("dump")); err != nil {
+		t.Fatal(err)
+	}
+	return broker.Messages("dump")
+}
+
+// valuesOf returns the values of messages produced with their offset as value.
+func valuesOf(messages []kafka.Message) []int64 {
+	values := make([]int64, len(messages))
+	for i, msg := range messages {
+		values[i], _ = strconv.ParseInt(string(msg.Value), 10, 64)
+	}
+	return values
+}
@@ -0,0 +1,411 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Headers of the requests sent by a Requester and of the replies sent by Reply.
+const (
+	// HeaderCorrelationID holds the id matching a reply to its request.
+	HeaderCorrelationID = "x-correlation-id"
+	// HeaderReplyTo holds the topic the reply to a request must be sent to.
+	HeaderReplyTo = "x-reply-to"
+	// HeaderDeadline holds the time, in RFC 3339 format, after which the requester stops waiting for the reply.
+	HeaderDeadline = "x-deadline"
+	// HeaderReplyError holds the error of the handler of a request, on a reply without a value.
+	HeaderReplyError = "x-reply-error"
+)
+
+const (
+	defaultRequestTimeout = 30 * time.Second
+	// defaultRequestBatchTimeout is the batch timeout of the producer of a Requester: a request is
+	// waited for, so it should not wait for a batch to fill.
+	defaultRequestBatchTimeout = 5 * time.Millisecond
+)
+
+var (
+	// ErrRequestTimeout is returned by Request when no reply arrives before the request times out.
+	ErrRequestTimeout = errors.New("request timed out")
+	// ErrRequesterClosed is returned by Request once the requester is closed.
+	ErrRequesterClosed = errors.New("requester is closed")
+)
+
+// ReplyError is returned by Request when the handler of the request failed. It holds the message of
+// the handler's error.
+type ReplyError struct {
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return "request failed: " + e.Message
+}
+
+// WithRequestTimeout sets how long Request waits for a reply when its context has no earlier
+// deadline. Defaults to 30 seconds.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = timeout
+	}
+}
+
+// Requester sends requests to the topics consumed by services answering them with Reply, and waits
+// for their replies on its own reply topic. Every instance of a service needs its own reply topic,
+// e.g. named after its host, since it only reads the replies to its own requests.
+type Requester struct {
+	// ReplyTopic is the topic the replies are sent to.
+	ReplyTopic string
+
+	producer *KafkaMessenger
+	timeout  time.Duration
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	closing chan struct{}
+	pending map[string]chan Message
+}
+
+// NewRequester creates a Requester waiting for replies on replyTopic, which is created unless
+// disabled with WithAutoCreateTopics. Only the replies sent after the requester is created are read.
+// The requests are written with a batch timeout of 5ms instead of 1s, unless WithBatchTimeout is given.
+//
+// Parameters:
+//   - replyTopic: the topic of the replies, used by this instance only
+//   - brokerAddresses: the addresses of the Kafka brokers to connect to
+//   - opts: optional settings for the reply topic and the producer of the requests, such as WithRequestTimeout
+//
+// Returns:
+//   - *Requester: a new Requester
+//   - error: an error if the reply topic cannot be created or read
+//
+// Example usage:
+//
+//	requester, err := NewRequester("api_gateway.replies."+hostname, brokers, WithRequestTimeout(5*time.Second))
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer requester.Close()
+//	reply, err := requester.Request(ctx, "accounts.validate", accountID)
+func NewRequester(replyTopic string, brokerAddresses []string, opts ...Option) (*Requester, error) {
+	if replyTopic == "" {
+		return nil, fmt.Errorf("reply topic is empty")
+	}
+	o := newOptions(opts)
+	source, err := newKafkaTopicReader(brokerAddresses, o)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := NewProducer(brokerAddresses, requestProducerOptions(replyTopic, opts)...)
+	if err != nil {
+		return nil, err
+	}
+	return newRequester(replyTopic, producer, source, o)
+}
+
+// NewRequester creates a Requester waiting for replies on the broker's replyTopic, creating the
+// topic if it does not exist yet. See NewRequester.
+func (b *MemoryBroker) NewRequester(replyTopic string, opts ...Option) (*Requester, error) {
+	if replyTopic == "" {
+		return nil, fmt.Errorf("reply topic is empty")
+	}
+	producer, err := b.NewMessenger(replyTopic, "", requestProducerOptions(replyTopic, opts)...)
+	if err != nil {
+		return nil, err
+	}
+	return newRequester(replyTopic, producer, memoryTopicReader{broker: b}, newOptions(opts))
+}
+
+// requestProducerOptions returns the options of the producer of a Requester: opts, with a small
+// batch timeout unless opts sets one.
+func requestProducerOptions(replyTopic string, opts []Option) []Option {
+	return slices.Concat([]Option{WithBatchTimeout(defaultRequestBatchTimeout)}, opts, []Option{WithTopic(replyTopic)})
+}
+
+// newRequester creates a Requester reading the replies from the end of every partition of
+// replyTopic, closing producer if it fails.
+func newRequester(replyTopic string, producer *KafkaMessenger, source topicReader, o options) (*Requester, error) {
+	r := &Requester{
+		ReplyTopic: replyTopic,
+		producer:   producer,
+		timeout:    o.requestTimeout,
+		closing:    make(chan struct{}),
+		pending:    make(map[string]chan Message),
+	}
+	if r.timeout <= 0 {
+		r.timeout = defaultRequestTimeout
+	}
+
+	readers, err := openReplyPartitions(source, replyTopic)
+	if err != nil {
+		if closeErr := producer.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+		return nil, fmt.Errorf("failed to read reply topic %s: %w", replyTopic, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	for _, reader := range readers {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.listen(ctx, reader)
+		}()
+	}
+	return r, nil
+}
+
+// openReplyPartitions opens every partition of topic at its end.
+func openReplyPartitions(source topicReader, topic string) ([]partitionReader, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+	partitions, err := source.partitions(ctx, topic)
+	for errors.Is(err, kafka.UnknownTopicOrPartition) || errors.Is(err, kafka.LeaderNotAvailable) {
+		// A topic that was just created may not be known to every broker yet.
+		if !sleepContext(ctx, 100*time.Millisecond) {
+			break
+		}
+		partitions, err = source.partitions(ctx, topic)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var readers []partitionReader
+	for _, partition := range partitions {
+		reader, err := source.open(topic, partition.ID, partition.LastOffset)
+		if err != nil {
+			for _, opened := range readers {
+				opened.Close()
+			}
+			return nil, err
+		}
+		readers = append(readers, reader)
+	}
+	return readers, nil
+}
+
+// listen passes the replies read from a partition of the reply topic to their requests until ctx is done.
+func (r *Requester) listen(ctx context.Context, reader partitionReader) {
+	defer reader.Close()
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.producer.logger().Warn("failed to read reply, retrying", "topic", r.ReplyTopic, "error", err)
+			if !sleepContext(ctx, 1*time.Second) {
+				return
+			}
+			continue
+		}
+
+		reply := fromKafkaMessage(msg)
+		id, _ := reply.Header(HeaderCorrelationID)
+		r.mu.Lock()
+		pending, ok := r.pending[id]
+		delete(r.pending, id)
+		r.mu.Unlock()
+		if !ok {
+			r.producer.logger().Debug("dropping reply to unknown request, it may have timed out", append(messageAttrs(msg), "correlation_id", id)...)
+			continue
+		}
+		pending <- reply
+	}
+}
+
+// Request sends payload to topic and waits for the reply, sent by a handler wrapped with Reply. The
+// request is keyed by its correlation id, and carries the deadline after which the requester stops
+// waiting, so that the replier can skip the requests nobody waits for anymore.
+//
+// Parameters:
+//   - ctx: the context of the request; the requester's timeout applies if ctx has no earlier deadline
+//   - topic: the topic of the requests the replier consumes
+//   - payload: the request
+//   - opts: options such as WithHeader
+//
+// Returns:
+//   - Message: the reply
+//   - error: a *ReplyError if the handler of the request failed, an error wrapping ErrRequestTimeout
+//     if no reply arrives in time, or an error if the request cannot be sent
+//
+// Example usage:
+//
+//	reply, err := requester.Request(ctx, "accounts.validate", accountID)
+//	var replyErr *ReplyError
+//	if errors.As(err, &replyErr) {
+//	  return fmt.Errorf("invalid account: %s", replyErr.Message)
+//	}
+func (r *Requester) Request(ctx context.Context, topic, payload string, opts ...ProduceOption) (Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	id := newEventID()
+	reply := make(chan Message, 1)
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return Message{}, ErrRequesterClosed
+	}
+	r.pending[id] = reply
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	deadline, _ := ctx.Deadline()
+	opts = append(opts,
+		ToTopic(topic),
+		WithHeader(HeaderCorrelationID, id),
+		WithHeader(HeaderReplyTo, r.ReplyTopic),
+		WithHeader(HeaderDeadline, deadline.UTC().Format(time.RFC3339Nano)),
+	)
+	if err := r.producer.ProduceMessage(ctx, id, payload, opts...); err != nil {
+		return Message{}, fmt.Errorf("failed to send request to %s: %w", topic, err)
+	}
+
+	select {
+	case msg := <-reply:
+		if message, failed := msg.Header(HeaderReplyError); failed {
+			return msg, &ReplyError{Message: message}
+		}
+		return msg, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Message{}, fmt.Errorf("%w: no reply from %s: %w", ErrRequestTimeout, topic, ctx.Err())
+		}
+		return Message{}, ctx.Err()
+	case <-r.closing:
+		return Message{}, ErrRequesterClosed
+	}
+}
+
+// Close stops reading replies, fails the requests waiting for one with ErrRequesterClosed, and
+// closes the producer of the requests.
+func (r *Requester) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.closing)
+	r.mu.Unlock()
+
+	r.cancel()
+	r.wg.Wait()
+	return r.producer.Close()
+}
+
+// ReplyHandler handles a request and returns the payload of its reply.
+type ReplyHandler func(ctx context.Context, request Message) (string, error)
+
+// ReplyOption configures Reply.
+type ReplyOption func(*replyOptions)
+
+type replyOptions struct {
+	logger *slog.Logger
+}
+
+// ReplyLogger sets the logger of Reply. Without it, only warnings and errors are logged, through slog.Default.
+func ReplyLogger(logger *slog.Logger) ReplyOption {
+	return func(o *replyOptions) {
+		o.logger = logger
+	}
+}
+
+// Reply wraps handler into a Handler answering the requests sent by a Requester: the payload returned
+// by handler is sent through publisher to the reply topic of the request, or, if handler fails, a
+// reply carrying its error, which Request returns as a *ReplyError. The context of handler expires
+// when the requester stops waiting, and the requests it stopped waiting for are skipped without
+// calling handler. Messages that are not requests are logged and skipped.
+//
+// If the reply cannot be sent, the error is returned, so the request is handled again.
+//
+// The replies are written with ProduceMessage, which waits for the batch timeout of publisher
+// before sending a lone message, while the requester waits for them. Create publisher with a small
+// WithBatchTimeout, such as 5ms, rather than the default 1s.
+//
+// Parameters:
+//   - publisher: the publisher sending the replies, with a small batch timeout
+//   - handler: the handler of the requests
+//   - opts: optional settings such as ReplyLogger
+//
+// Returns:
+//   - Handler: the handler to consume the requests with
+//
+// Example usage:
+//
+//	messenger, err := NewKafkaMessenger("accounts.validate", "account_management", brokers, WithBatchTimeout(5*time.Millisecond))
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	err = messenger.Consume(ctx, Reply(messenger, func(ctx context.Context, request Message) (string, error) {
+//	  return validateAccount(ctx, string(request.Value))
+//	}))
+func Reply(publisher Publisher, handler ReplyHandler, opts ...ReplyOption) Handler {
+	var o replyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	logger := o.logger
+	if logger == nil {
+		logger = quietLogger()
+	}
+
+	return func(ctx context.Context, msg Message) error {
+		id, _ := msg.Header(HeaderCorrelationID)
+		replyTo, _ := msg.Header(HeaderReplyTo)
+		if id == "" || replyTo == "" {
+			logger.Warn("skipping message that is not a request", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "key", msg.Key)
+			return nil
+		}
+
+		handleCtx := ctx
+		if header, ok := msg.Header(HeaderDeadline); ok {
+			deadline, err := time.Parse(time.RFC3339Nano, header)
+			if err == nil {
+				if !time.Now().Before(deadline) {
+					logger.Debug("skipping expired request", "correlation_id", id, "deadline", deadline)
+					return nil
+				}
+				var cancel context.CancelFunc
+				handleCtx, cancel = context.WithDeadline(ctx, deadline)
+				defer cancel()
+			}
+		}
+
+		payload, err := handler(handleCtx, msg)
+		if ctx.Err() != nil {
+			// The consumer is stopping; the request is handled again by the next consumer.
+			return ctx.Err()
+		}
+		if handleCtx.Err() != nil {
+			logger.Debug("skipping reply to expired request", "correlation_id", id)
+			return nil
+		}
+
+		replyOpts := []ProduceOption{ToTopic(replyTo), WithHeader(HeaderCorrelationID, id)}
+		if err != nil {
+			payload = ""
+			replyOpts = append(replyOpts, WithHeader(HeaderReplyError, err.Error()))
+		}
+		if err := publisher.ProduceMessage(ctx, id, payload, replyOpts...); err != nil {
+			return fmt.Errorf("failed to send reply to %s: %w", replyTo, err)
+		}
+		return nil
+	}
+}
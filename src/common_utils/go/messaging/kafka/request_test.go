@@ -0,0 +1,177 @@
+//go:build unit
+
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+)
+
+func TestRequestReply(t *testing.T) {
+	// serve answers the requests of topic with handler until the test ends.
+	serve := func(t *testing.T, broker *kafka.MemoryBroker, topic string, handler kafka.ReplyHandler) {
+		t.Helper()
+		server := newMemoryMessenger(t, broker, topic, "account_management")
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- server.Consume(ctx, kafka.Reply(server, handler)) }()
+		t.Cleanup(func() {
+			cancel()
+			if err := <-done; err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	newRequester := func(t *testing.T, broker *kafka.MemoryBroker, opts ...kafka.Option) *kafka.Requester {
+		t.Helper()
+		requester, err := broker.NewRequester("api_gateway.replies.1", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { requester.Close() })
+		return requester
+	}
+	validate := func(ctx context.Context, request kafka.Message) (string, error) {
+		if string(request.Value) == "closed-account" {
+			return "", errors.New("account is closed")
+		}
+		return "valid " + string(request.Value), nil
+	}
+
+	t.Run("should receive the reply to a request", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(2)
+		serve(t, broker, "accounts.validate", validate)
+		requester := newRequester(t, broker)
+
+		reply, err := requester.Request(context.Background(), "accounts.validate", "account-1", kafka.WithHeader("source", "api_gateway"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(reply.Value) != "valid account-1" || reply.Topic != "api_gateway.replies.1" {
+			t.Errorf("expected the reply on the reply topic, got %q on %s", reply.Value, reply.Topic)
+		}
+
+		requests := broker.Messages("accounts.validate")
+		if len(requests) != 1 {
+			t.Fatalf("expected 1 request, got %d", len(requests))
+		}
+		id, _ := requests[0].Header(kafka.HeaderCorrelationID)
+		replyTo, _ := requests[0].Header(kafka.HeaderReplyTo)
+		source, _ := requests[0].Header("source")
+		if replyID, _ := reply.Header(kafka.HeaderCorrelationID); id == "" || replyID != id || requests[0].Key != id {
+			t.Errorf("expected the request and the reply to share correlation id %q, got %q", id, replyID)
+		}
+		if replyTo != "api_gateway.replies.1" || source != "api_gateway" {
+			t.Errorf("expected the reply topic and the given headers, got %q and %q", replyTo, source)
+		}
+	})
+
+	t.Run("should match concurrent replies to their requests", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(3)
+		serve(t, broker, "accounts.validate", validate)
+		requester := newRequester(t, broker)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				account := fmt.Sprintf("account-%d", i)
+				reply, err := requester.Request(context.Background(), "accounts.validate", account)
+				if err == nil && string(reply.Value) != "valid "+account {
+					err = fmt.Errorf("expected the reply to %s, got %q", account, reply.Value)
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	t.Run("should return the error of the handler", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		serve(t, broker, "accounts.validate", validate)
+		requester := newRequester(t, broker)
+
+		_, err := requester.Request(context.Background(), "accounts.validate", "closed-account")
+		var replyErr *kafka.ReplyError
+		if !errors.As(err, &replyErr) || replyErr.Message != "account is closed" {
+			t.Errorf("expected the handler's error, got %v", err)
+		}
+	})
+
+	t.Run("should time out without a reply", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		requester := newRequester(t, broker, kafka.WithRequestTimeout(20*time.Millisecond))
+
+		start := time.Now()
+		_, err := requester.Request(context.Background(), "accounts.validate", "account-1")
+		if !errors.Is(err, kafka.ErrRequestTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected ErrRequestTimeout, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected the request to time out after 20ms, took %s", elapsed)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := requester.Request(ctx, "accounts.validate", "account-1"); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the context's error, got %v", err)
+		}
+	})
+
+	t.Run("should skip the requests nobody waits for anymore", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		requester := newRequester(t, broker, kafka.WithRequestTimeout(20*time.Millisecond))
+		if _, err := requester.Request(context.Background(), "accounts.validate", "account-1"); !errors.Is(err, kafka.ErrRequestTimeout) {
+			t.Fatalf("expected ErrRequestTimeout, got %v", err)
+		}
+
+		var handled atomic.Int32
+		serve(t, broker, "accounts.validate", func(ctx context.Context, request kafka.Message) (string, error) {
+			handled.Add(1)
+			return "valid", nil
+		})
+		waitUntil(t, func() bool { return broker.CommittedOffset("account_management", "accounts.validate", 0) == 1 })
+		if handled.Load() != 0 {
+			t.Errorf("expected the expired request to be skipped, handled %d", handled.Load())
+		}
+		if replies := broker.Messages("api_gateway.replies.1"); len(replies) != 0 {
+			t.Errorf("expected no reply, got %d", len(replies))
+		}
+	})
+
+	t.Run("should fail the requests once closed", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		requester := newRequester(t, broker)
+
+		failed := make(chan error, 1)
+		go func() {
+			_, err := requester.Request(context.Background(), "accounts.validate", "account-1")
+			failed <- err
+		}()
+		waitUntil(t, func() bool { return len(broker.Messages("accounts.validate")) == 1 })
+		if err := requester.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-failed; !errors.Is(err, kafka.ErrRequesterClosed) {
+			t.Errorf("expected ErrRequesterClosed, got %v", err)
+		}
+		if _, err := requester.Request(context.Background(), "accounts.validate", "account-1"); !errors.Is(err, kafka.ErrRequesterClosed) {
+			t.Errorf("expected ErrRequesterClosed, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers recorded on messages routed to retry topics and to the dead-letter queue.
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderError             = "x-error"
+	HeaderAttempt           = "x-attempt"
+	HeaderRetryAt           = "x-retry-at"
+)
+
+const (
+	defaultMaxAttempts     = 4
+	defaultInitialBackoff  = 1 * time.Second
+	defaultMaxBackoff      = 1 * time.Minute
+	defaultBackoffMultiple = 2.0
+)
+
+// RetryPolicy configures how many times a failed message is retried, and how long each retry is delayed.
+// Zero values are replaced by their defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times the handler is called for a message, including the
+	// first one. Defaults to 4.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. Defaults to one second.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries. Defaults to one minute.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by on every retry. Defaults to 2.
+	Multiplier float64
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultBackoffMultiple
+	}
+	return p
+}
+
+// Backoff returns the delay before the given retry, starting at 1 for the first retry.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	p = p.withDefaults()
+	delay := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if delay > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(delay)
+}
+
+// RetryTopic returns the name of the topic holding the given retry of topic's messages,
+// e.g. "transactions.retry.1".
+func RetryTopic(topic string, retry int) string {
+	return fmt.Sprintf("%s.retry.%d", topic, retry)
+}
+
+// DeadLetterTopic returns the name of the dead-letter queue of topic, e.g. "transactions.dlq".
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+// RetryingConsumer consumes a topic and, when the handler fails, routes the message through
+// delayed retry topics ("<topic>.retry.N") before parking it in a dead-letter queue ("<topic>.dlq").
+// A failing message never blocks the messages behind it on the main topic.
+type RetryingConsumer struct {
+	Topic  string
+	Policy RetryPolicy
+	// Logger receives the logs about failed attempts. If nil, only warnings and errors are logged,
+	// through slog.Default.
+	Logger *slog.Logger
+
+	main    Messenger
+	retries []Messenger
+	dlq     Messenger
+}
+
+// NewRetryingConsumer creates a RetryingConsumer for the given topic. It creates a messenger for the
+// main topic, one for each retry topic and one for the dead-letter queue, ensuring all of them exist.
+//
+// Parameters:
+//   - topic: the name of the main Kafka topic
+//   - groupID: the group ID shared by the consumers of the main and retry topics
+//   - brokerAddresses: the addresses of the Kafka brokers to connect to
+//   - policy: the retry policy, zero values are replaced by their defaults
+//   - opts: optional settings applied to the messengers of every stage
+//
+// Returns:
+//   - *RetryingConsumer: a new RetryingConsumer instance
+//   - error: an error if any of the topics cannot be created or the brokers cannot be reached
+//
+// Example usage:
+//
+//	consumer, err := NewRetryingConsumer("transactions", "account_management", brokers, RetryPolicy{MaxAttempts: 5})
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer consumer.Close()
+func NewRetryingConsumer(topic, groupID string, brokerAddresses []string, policy RetryPolicy, opts ...Option) (*RetryingConsumer, error) {
+	policy = policy.withDefaults()
+	r := &RetryingConsumer{Topic: topic, Policy: policy, Logger: newOptions(opts).logger}
+
+	main, err := NewKafkaMessenger(topic, groupID, brokerAddresses, opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.main = main
+	for retry := 1; retry < policy.MaxAttempts; retry++ {
+		messenger, err := NewKafkaMessenger(RetryTopic(topic, retry), groupID, brokerAddresses, opts...)
+		if err != nil {
+			return nil, errors.Join(err, r.Close())
+		}
+		r.retries = append(r.retries, messenger)
+	}
+	dlq, err := NewKafkaMessenger(DeadLetterTopic(topic), groupID+".dlq", brokerAddresses, opts...)
+	if err != nil {
+		return nil, errors.Join(err, r.Close())
+	}
+	r.dlq = dlq
+	return r, nil
+}
+
+// Consume consumes the main topic and every retry topic until ctx is cancelled or one of the
+// consumers fails. Each message is passed to handler; a message whose handler fails is committed
+// and forwarded to the next retry topic, or to the dead-letter queue once Policy.MaxAttempts is reached.
+// A forward that fails is retried, without running handler again, until ctx is cancelled.
+//
+// Parameters:
+//   - ctx: context.Context for managing the consumers' lifecycle
+//   - handler: the function that processes each message
+//
+// Returns:
+//   - error: the first error returned by any of the consumers
+func (r *RetryingConsumer) Consume(ctx context.Context, handler Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	consumers := append([]Messenger{r.main}, r.retries...)
+	errs := make([]error, len(consumers))
+
+	var wg sync.WaitGroup
+	for stage, consumer := range consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := consumer.Consume(ctx, r.stageHandler(stage, handler)); err != nil {
+				errs[stage] = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// stageHandler wraps handler for the consumer of the given stage, 0 being the main topic and
+// N being "<topic>.retry.N".
+func (r *RetryingConsumer) stageHandler(stage int, handler Handler) Handler {
+	return func(ctx context.Context, msg Message) error {
+		if stage > 0 {
+			if err := r.waitForRetry(ctx, msg); err != nil {
+				return err
+			}
+		}
+
+		handlerErr := handler(ctx, msg)
+		if handlerErr == nil || ctx.Err() != nil {
+			return handlerErr
+		}
+
+		attempt := stage + 1
+		next, nextTopic := r.dlq, DeadLetterTopic(r.Topic)
+		if attempt < r.Policy.MaxAttempts {
+			next, nextTopic = r.retries[attempt-1], RetryTopic(r.Topic, attempt)
+		}
+		r.logger().Warn("attempt failed, forwarding message",
+			"topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "key", msg.Key,
+			"attempt", attempt, "next_topic", nextTopic, "error", handlerErr)
+
+		headers := retryHeaders(msg, attempt, handlerErr)
+		if attempt < r.Policy.MaxAttempts {
+			retryAt := time.Now().Add(r.Policy.Backoff(attempt)).UTC().Format(time.RFC3339Nano)
+			headers = append(headers, Header{Key: HeaderRetryAt, Value: []byte(retryAt)})
+		}
+		return r.forward(ctx, next, nextTopic, msg, headers)
+	}
+}
+
+// forward produces msg to the next topic, retrying with an exponential backoff until it is written
+// or ctx is done, so that a failed forward does not run the handler again.
+func (r *RetryingConsumer) forward(ctx context.Context, next Messenger, nextTopic string, msg Message, headers []Header) error {
+	backoff := defaultHandlerBackoff
+	for {
+		err := next.ProduceMessage(ctx, msg.Key, string(msg.Value), WithHeaders(headers...), WithTimestamp(msg.Time))
+		if err == nil {
+			return nil
+		}
+		r.logger().Warn("failed to forward message, retrying",
+			"topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "next_topic", nextTopic, "backoff", backoff, "error", err)
+		if !sleepContext(ctx, backoff) {
+			return fmt.Errorf("failed to forward message to %s: %w", nextTopic, err)
+		}
+		backoff = min(backoff*2, maxHandlerBackoff)
+	}
+}
+
+// RedriveDLQ moves messages from the dead-letter queue back into the main topic, stripping the retry
+// metadata so that they get a fresh set of attempts. It stops once limit messages have been moved,
+// or when ctx is cancelled if limit is not positive.
+//
+// Parameters:
+//   - ctx: the context bounding the redrive
+//   - limit: the maximum number of messages to move, or 0 for no limit
+//
+// Returns:
+//   - int: the number of messages moved back into the main topic
+//   - error: an error if consuming the dead-letter queue or producing to the main topic fails
+//
+// Example usage:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//	defer cancel()
+//	moved, err := consumer.RedriveDLQ(ctx, 100)
+func (r *RetryingConsumer) RedriveDLQ(ctx context.Context, limit int) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	moved := 0
+	err := r.dlq.Consume(ctx, func(ctx context.Context, msg Message) error {
+		if err := r.main.ProduceMessage(ctx, msg.Key, string(msg.Value), WithHeaders(stripRetryHeaders(msg.Headers)...), WithTimestamp(msg.Time)); err != nil {
+			return fmt.Errorf("failed to redrive message to %s: %w", r.Topic, err)
+		}
+		moved++
+		if limit > 0 && moved >= limit {
+			cancel()
+		}
+		return nil
+	})
+	return moved, err
+}
+
+// Close closes the messengers of the main topic, the retry topics and the dead-letter queue.
+//
+// Returns:
+//   - error: an error joining every close error
+func (r *RetryingConsumer) Close() error {
+	var errs []error
+	for _, messenger := range append(append([]Messenger{r.main}, r.retries...), r.dlq) {
+		if messenger == nil {
+			continue
+		}
+		if err := messenger.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RetryingConsumer) logger() *slog.Logger {
+	if r.Logger == nil {
+		return quietLogger()
+	}
+	return r.Logger
+}
+
+// waitForRetry sleeps until the time recorded in the message's retry-at header.
+func (r *RetryingConsumer) waitForRetry(ctx context.Context, msg Message) error {
+	value, ok := msg.Header(HeaderRetryAt)
+	if !ok {
+		return nil
+	}
+	retryAt, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		r.logger().Warn("ignoring invalid retry-at header", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "value", value, "error", err)
+		return nil
+	}
+	if !sleepContext(ctx, time.Until(retryAt)) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// retryHeaders returns the headers of a message forwarded after a failed attempt: the message's own
+// headers, followed by the retry metadata. The original location is kept from earlier attempts.
+func retryHeaders(msg Message, attempt int, handlerErr error) []Header {
+	topic, partition, offset := msg.Topic, strconv.Itoa(msg.Partition), strconv.FormatInt(msg.Offset, 10)
+	if original, ok := msg.Header(HeaderOriginalTopic); ok {
+		topic = original
+		partition, _ = msg.Header(HeaderOriginalPartition)
+		offset, _ = msg.Header(HeaderOriginalOffset)
+	}
+
+	return append(stripRetryHeaders(msg.Headers),
+		Header{Key: HeaderOriginalTopic, Value: []byte(topic)},
+		Header{Key: HeaderOriginalPartition, Value: []byte(partition)},
+		Header{Key: HeaderOriginalOffset, Value: []byte(offset)},
+		Header{Key: HeaderError, Value: []byte(handlerErr.Error())},
+		Header{Key: HeaderAttempt, Value: []byte(strconv.Itoa(attempt))},
+	)
+}
+
+func stripRetryHeaders(headers []Header) []Header {
+	var stripped []Header
+	for _, header := range headers {
+		if !isRetryHeader(header.Key) {
+			stripped = append(stripped, header)
+		}
+	}
+	return stripped
+}
+
+func isRetryHeader(key string) bool {
+	switch key {
+	case HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset, HeaderError, HeaderAttempt, HeaderRetryAt:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+
+	for retry, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if backoff := policy.Backoff(retry); backoff != expected {
+			t.Errorf("expected backoff %s for retry %d, got %s", expected, retry, backoff)
+		}
+	}
+
+	if defaults := (RetryPolicy{}).withDefaults(); defaults.MaxAttempts != defaultMaxAttempts || defaults.Backoff(1) != defaultInitialBackoff {
+		t.Errorf("expected default policy, got %+v", defaults)
+	}
+	if topic := RetryTopic("transactions", 2); topic != "transactions.retry.2" {
+		t.Errorf("expected transactions.retry.2, got %s", topic)
+	}
+	if topic := DeadLetterTopic("transactions"); topic != "transactions.dlq" {
+		t.Errorf("expected transactions.dlq, got %s", topic)
+	}
+}
+
+func TestRetryingConsumer(t *testing.T) {
+	t.Run("should route a poison message through the retry topics to the dead-letter queue", func(t *testing.T) {
+		consumer, broker := newMemoryRetryingConsumer(t, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var mu sync.Mutex
+		var attempts []string
+		go consumer.Consume(ctx, func(ctx context.Context, msg Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, msg.Topic)
+			return errors.New("poison")
+		})
+
+		consumer.main.ProduceMessage(ctx, "account-1", "payload", WithHeader("source", "test"))
+
+		dead := receiveFromBroker(t, broker, "transactions.dlq")
+		mu.Lock()
+		if expected := []string{"transactions", "transactions.retry.1", "transactions.retry.2"}; len(attempts) != 3 || attempts[0] != expected[0] || attempts[1] != expected[1] || attempts[2] != expected[2] {
+			t.Errorf("expected attempts on %v, got %v", expected, attempts)
+		}
+		mu.Unlock()
+
+		if dead.Key != "account-1" || string(dead.Value) != "payload" {
+			t.Errorf("expected the original key and value, got %+v", dead)
+		}
+		for key, expected := range map[string]string{
+			"source":                "test",
+			HeaderOriginalTopic:     "transactions",
+			HeaderOriginalPartition: "0",
+			HeaderOriginalOffset:    "0",
+			HeaderError:             "poison",
+			HeaderAttempt:           "3",
+		} {
+			if value, _ := dead.Header(key); value != expected {
+				t.Errorf("expected header %s to be %q, got %q", key, expected, value)
+			}
+		}
+		if _, ok := dead.Header(HeaderRetryAt); ok {
+			t.Errorf("expected no %s header on a dead letter", HeaderRetryAt)
+		}
+	})
+
+	t.Run("should retry a failed forward without running the handler again", func(t *testing.T) {
+		consumer, broker := newMemoryRetryingConsumer(t, RetryPolicy{MaxAttempts: 1})
+		dlq := &flakyMessenger{Messenger: consumer.dlq, failures: 2}
+		consumer.dlq = dlq
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var handled atomic.Int32
+		go consumer.Consume(ctx, func(ctx context.Context, msg Message) error {
+			handled.Add(1)
+			return errors.New("poison")
+		})
+		consumer.main.ProduceMessage(ctx, "account-1", "payload")
+
+		receiveFromBroker(t, broker, "transactions.dlq")
+		if handled.Load() != 1 {
+			t.Errorf("expected the handler to run once, ran %d times", handled.Load())
+		}
+		if dlq.attempts.Load() != 3 {
+			t.Errorf("expected the forward to be attempted 3 times, got %d", dlq.attempts.Load())
+		}
+	})
+
+	t.Run("should stop retrying once the handler succeeds", func(t *testing.T) {
+		consumer, broker := newMemoryRetryingConsumer(t, RetryPolicy{MaxAttempts: 3, InitialBackoff: 50 * time.Millisecond})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		calls := make(chan time.Time, 10)
+		go consumer.Consume(ctx, func(ctx context.Context, msg Message) error {
+			calls <- time.Now()
+			if msg.Topic == "transactions" {
+				return errors.New("temporary failure")
+			}
+			return nil
+		})
+
+		consumer.main.ProduceMessage(ctx, "account-1", "payload")
+
+		first, second := <-calls, <-calls
+		if delay := second.Sub(first); delay < 50*time.Millisecond {
+			t.Errorf("expected the retry to be delayed by the backoff, got %s", delay)
+		}
+		select {
+		case <-calls:
+			t.Error("expected no further attempts")
+		case <-time.After(100 * time.Millisecond):
+		}
+		if dead := broker.Messages("transactions.dlq"); len(dead) != 0 {
+			t.Errorf("expected nothing in the dead-letter queue, got %+v", dead)
+		}
+	})
+
+	t.Run("should redrive dead letters into the main topic", func(t *testing.T) {
+		consumer, broker := newMemoryRetryingConsumer(t, RetryPolicy{MaxAttempts: 2})
+
+		consumer.dlq.ProduceMessage(context.Background(), "account-1", "payload",
+			WithHeader("source", "test"),
+			WithHeader(HeaderOriginalTopic, "transactions"),
+			WithHeader(HeaderAttempt, "2"),
+			WithHeader(HeaderError, "poison"),
+		)
+
+		moved, err := consumer.RedriveDLQ(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != 1 {
+			t.Errorf("expected 1 message moved, got %d", moved)
+		}
+
+		redriven := receiveFromBroker(t, broker, "transactions")
+		if redriven.Key != "account-1" || string(redriven.Value) != "payload" {
+			t.Errorf("expected the original key and value, got %+v", redriven)
+		}
+		if len(redriven.Headers) != 1 || redriven.Headers[0].Key != "source" {
+			t.Errorf("expected only the source header to be kept, got %v", redriven.Headers)
+		}
+	})
+}
+
+func newMemoryRetryingConsumer(t *testing.T, policy RetryPolicy) (*RetryingConsumer, *MemoryBroker) {
+	t.Helper()
+
+	policy = policy.withDefaults()
+	broker := NewMemoryBroker(1)
+	newMessenger := func(topic, groupID string) Messenger {
+		messenger, err := broker.NewMessenger(topic, groupID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return messenger
+	}
+
+	consumer := &RetryingConsumer{Topic: "transactions", Policy: policy, main: newMessenger("transactions", "test-group")}
+	for retry := 1; retry < policy.MaxAttempts; retry++ {
+		consumer.retries = append(consumer.retries, newMessenger(RetryTopic("transactions", retry), "test-group"))
+	}
+	consumer.dlq = newMessenger("transactions.dlq", "test-group.dlq")
+	t.Cleanup(func() { consumer.Close() })
+
+	return consumer, broker
+}
+
+// flakyMessenger fails to produce the first failures messages.
+type flakyMessenger struct {
+	Messenger
+	failures int32
+	attempts atomic.Int32
+}
+
+func (m *flakyMessenger) ProduceMessage(ctx context.Context, key, message string, opts ...ProduceOption) error {
+	if m.attempts.Add(1) <= m.failures {
+		return errors.New("broker unavailable")
+	}
+	return m.Messenger.ProduceMessage(ctx, key, message, opts...)
+}
+
+func receiveFromBroker(t *testing.T, broker *MemoryBroker, topic string) Message {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if messages := broker.Messages(topic); len(messages) > 0 {
+			return messages[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for a message on %s", topic)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
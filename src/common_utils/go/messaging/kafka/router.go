@@ -0,0 +1,109 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+type routeKey struct {
+	topic     string
+	eventType string
+}
+
+// Router dispatches every message to the handler registered for its topic and the type of its
+// event, so that a consumer of several topics, see NewMultiTopicConsumer, needs a single Consume
+// loop. Its Dispatch method is the Handler to consume with.
+//
+// The most specific handler is chosen: the one registered for both the topic and the event type,
+// then the one for the event type on any topic, then the one for the topic, and finally the
+// fallback. Without a fallback, the messages nobody handles are logged and acknowledged.
+//
+// Handlers must be registered before the router starts dispatching.
+type Router struct {
+	// Logger receives the logs about unhandled messages. If nil, only warnings and errors are logged,
+	// through slog.Default.
+	Logger *slog.Logger
+
+	routes   map[routeKey]Handler
+	fallback Handler
+}
+
+// NewRouter creates a Router without handlers.
+//
+// Example usage:
+//
+//	router := NewRouter().
+//	  HandleType("TransactionCreated", onTransactionCreated).
+//	  HandleType("TransactionDeleted", onTransactionDeleted).
+//	  Handle("users", "UserDeleted", onUserDeleted).
+//	  Fallback(parkUnknownEvent)
+//	err := consumer.Consume(ctx, router.Dispatch)
+func NewRouter() *Router {
+	return &Router{routes: make(map[routeKey]Handler)}
+}
+
+// Handle registers handler for the messages of topic whose envelope has the given type. An empty
+// topic matches every topic, and an empty event type every message of the topic. It panics if a
+// handler is already registered for the same topic and event type.
+func (r *Router) Handle(topic, eventType string, handler Handler) *Router {
+	if handler == nil {
+		panic("kafka: nil handler")
+	}
+	if topic == "" && eventType == "" {
+		panic("kafka: a route needs a topic or an event type, use Fallback for every message")
+	}
+	key := routeKey{topic: topic, eventType: eventType}
+	if _, ok := r.routes[key]; ok {
+		panic(fmt.Sprintf("kafka: a handler is already registered for topic %q and event type %q", topic, eventType))
+	}
+	r.routes[key] = handler
+	return r
+}
+
+// HandleTopic registers handler for every message of topic.
+func (r *Router) HandleTopic(topic string, handler Handler) *Router {
+	return r.Handle(topic, "", handler)
+}
+
+// HandleType registers handler for the messages of every topic whose envelope has the given type.
+func (r *Router) HandleType(eventType string, handler Handler) *Router {
+	return r.Handle("", eventType, handler)
+}
+
+// Fallback registers the handler of the messages no other handler matches, e.g. events of an
+// unknown type, or messages that are not envelopes.
+func (r *Router) Fallback(handler Handler) *Router {
+	r.fallback = handler
+	return r
+}
+
+// Dispatch passes msg to the handler registered for it, and returns its error. The event type is read
+// from the HeaderEventType header, and the envelope is only decoded for messages published without it.
+func (r *Router) Dispatch(ctx context.Context, msg Message) error {
+	eventType, _ := msg.Header(HeaderEventType)
+	if eventType == "" {
+		eventType = peekEnvelope(msg.Value).Type
+	}
+	if eventType != "" {
+		if handler, ok := r.routes[routeKey{topic: msg.Topic, eventType: eventType}]; ok {
+			return handler(ctx, msg)
+		}
+		if handler, ok := r.routes[routeKey{eventType: eventType}]; ok {
+			return handler(ctx, msg)
+		}
+	}
+	if handler, ok := r.routes[routeKey{topic: msg.Topic}]; ok {
+		return handler(ctx, msg)
+	}
+	if r.fallback != nil {
+		return r.fallback(ctx, msg)
+	}
+
+	logger := r.Logger
+	if logger == nil {
+		logger = quietLogger()
+	}
+	logger.Warn("no handler for message, skipping it", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "key", msg.Key, "event_type", eventType)
+	return nil
+}
@@ -0,0 +1,301 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const spillRecordHeaderSize = 4
+
+// spillBuffer is a bounded, file-backed FIFO of messages.
+//
+// Records are appended to a data file as a 4-byte big-endian length followed by the JSON encoded
+// message. The position of the oldest pending record is persisted in a sidecar ".pos" file, so
+// pending records survive a restart. Once every record has been consumed the data file is truncated.
+type spillBuffer struct {
+	mu       sync.Mutex
+	changed  chan struct{}
+	file     *os.File
+	posPath  string
+	readPos  int64
+	writePos int64
+	maxBytes int64
+	records  int
+}
+
+func openSpillBuffer(path string, maxBytes int64) (*spillBuffer, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &spillBuffer{
+		changed:  make(chan struct{}),
+		file:     file,
+		posPath:  path + ".pos",
+		maxBytes: maxBytes,
+	}
+
+	if err := b.recover(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// recover restores the read position and discards a record torn by a crash in the middle of a write.
+func (b *spillBuffer) recover() error {
+	if encoded, err := os.ReadFile(b.posPath); err == nil && len(encoded) == 8 {
+		b.readPos = int64(binary.BigEndian.Uint64(encoded))
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read spill position: %w", err)
+	}
+
+	info, err := b.file.Stat()
+	if err != nil {
+		return err
+	}
+	if b.readPos > info.Size() {
+		b.readPos = info.Size()
+	}
+
+	pos := b.readPos
+	for pos < info.Size() {
+		size, err := b.recordSize(pos)
+		if err != nil || pos+size > info.Size() {
+			break
+		}
+		pos += size
+		b.records++
+	}
+	if pos != info.Size() {
+		if err := b.file.Truncate(pos); err != nil {
+			return fmt.Errorf("failed to truncate torn spill record: %w", err)
+		}
+	}
+	b.writePos = pos
+	return nil
+}
+
+// Empty reports whether every spilled message has been consumed.
+func (b *spillBuffer) Empty() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.readPos == b.writePos
+}
+
+// Len returns the number of pending messages.
+func (b *spillBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.records
+}
+
+// Append durably writes msg at the end of the buffer, waiting for the buffer to be drained if
+// the write would exceed its size bound.
+func (b *spillBuffer) Append(ctx context.Context, msg kafka.Message) error {
+	record, err := encodeSpillRecord(msg)
+	if err != nil {
+		return err
+	}
+
+	for {
+		b.mu.Lock()
+		if b.fits(record) {
+			defer b.mu.Unlock()
+			return b.write(record)
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryAppend works like Append, but returns false instead of waiting if msg does not fit.
+func (b *spillBuffer) TryAppend(msg kafka.Message) (bool, error) {
+	record, err := encodeSpillRecord(msg)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.fits(record) {
+		return false, nil
+	}
+	return true, b.write(record)
+}
+
+func encodeSpillRecord(msg kafka.Message) ([]byte, error) {
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	record := make([]byte, spillRecordHeaderSize+len(encoded))
+	binary.BigEndian.PutUint32(record, uint32(len(encoded)))
+	copy(record[spillRecordHeaderSize:], encoded)
+	return record, nil
+}
+
+// fits reports whether record can be appended without exceeding the size bound. It must be called with mu held.
+func (b *spillBuffer) fits(record []byte) bool {
+	// A record larger than the bound is still accepted by an empty buffer, otherwise it would never fit.
+	return b.writePos+int64(len(record)) <= b.maxBytes || b.readPos == b.writePos
+}
+
+// write appends record and syncs it to disk. It must be called with mu held.
+func (b *spillBuffer) write(record []byte) error {
+	if _, err := b.file.WriteAt(record, b.writePos); err != nil {
+		return fmt.Errorf("failed to write spill record: %w", err)
+	}
+	if err := b.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spill buffer: %w", err)
+	}
+	b.writePos += int64(len(record))
+	b.records++
+	b.notify()
+	return nil
+}
+
+// Peek returns the oldest pending message without consuming it, waiting for one to be appended
+// if the buffer is empty.
+func (b *spillBuffer) Peek(ctx context.Context) (kafka.Message, error) {
+	msgs, err := b.PeekBatch(ctx, 1)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return msgs[0], nil
+}
+
+// PeekBatch returns up to limit of the oldest pending messages without consuming them, waiting for
+// one to be appended if the buffer is empty.
+func (b *spillBuffer) PeekBatch(ctx context.Context, limit int) ([]kafka.Message, error) {
+	for {
+		b.mu.Lock()
+		if b.readPos < b.writePos {
+			defer b.mu.Unlock()
+
+			var msgs []kafka.Message
+			for pos := b.readPos; pos < b.writePos && len(msgs) < max(limit, 1); {
+				msg, size, err := b.readRecord(pos)
+				if err != nil {
+					return nil, err
+				}
+				msgs = append(msgs, msg)
+				pos += size
+			}
+			return msgs, nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Advance consumes the message returned by the last call to Peek.
+func (b *spillBuffer) Advance() error {
+	return b.AdvanceBatch(1)
+}
+
+// AdvanceBatch consumes the n oldest pending messages, returned by the last call to PeekBatch.
+func (b *spillBuffer) AdvanceBatch(n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pos := b.readPos
+	for range n {
+		if pos == b.writePos {
+			return fmt.Errorf("spill buffer is empty")
+		}
+		size, err := b.recordSize(pos)
+		if err != nil {
+			return err
+		}
+		pos += size
+	}
+	b.readPos = pos
+	b.records -= n
+
+	if b.readPos == b.writePos {
+		if err := b.file.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate spill buffer: %w", err)
+		}
+		b.readPos, b.writePos = 0, 0
+	}
+	if err := b.savePosition(); err != nil {
+		return err
+	}
+	b.notify()
+	return nil
+}
+
+// Close closes the underlying file. Pending messages stay on disk.
+func (b *spillBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.file.Close()
+}
+
+// readRecord decodes the record at pos and returns it with its size. It must be called with mu held.
+func (b *spillBuffer) readRecord(pos int64) (kafka.Message, int64, error) {
+	size, err := b.recordSize(pos)
+	if err != nil {
+		return kafka.Message{}, 0, err
+	}
+	encoded := make([]byte, size-spillRecordHeaderSize)
+	if _, err := b.file.ReadAt(encoded, pos+spillRecordHeaderSize); err != nil {
+		return kafka.Message{}, 0, fmt.Errorf("failed to read spill record: %w", err)
+	}
+	var msg kafka.Message
+	if err := json.Unmarshal(encoded, &msg); err != nil {
+		return kafka.Message{}, 0, fmt.Errorf("failed to decode spill record: %w", err)
+	}
+	return msg, size, nil
+}
+
+func (b *spillBuffer) recordSize(pos int64) (int64, error) {
+	var header [spillRecordHeaderSize]byte
+	if _, err := b.file.ReadAt(header[:], pos); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("truncated spill record at %d", pos)
+		}
+		return 0, fmt.Errorf("failed to read spill record header: %w", err)
+	}
+	return spillRecordHeaderSize + int64(binary.BigEndian.Uint32(header[:])), nil
+}
+
+func (b *spillBuffer) savePosition() error {
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], uint64(b.readPos))
+	if err := os.WriteFile(b.posPath, encoded[:], 0o600); err != nil {
+		return fmt.Errorf("failed to save spill position: %w", err)
+	}
+	return nil
+}
+
+// notify wakes up every goroutine waiting for the buffer to change. It must be called with mu held.
+func (b *spillBuffer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
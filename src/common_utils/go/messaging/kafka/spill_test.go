@@ -0,0 +1,209 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpillBuffer(t *testing.T) {
+	t.Run("should return messages in the order they were appended", func(t *testing.T) {
+		buffer, err := openSpillBuffer(filepath.Join(t.TempDir(), "test.spill"), defaultSpillMaxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer buffer.Close()
+
+		for _, msg := range fakeMessages(3) {
+			if err := buffer.Append(context.Background(), msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for expected := int64(0); expected < 3; expected++ {
+			msg, err := buffer.Peek(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Offset != expected || string(msg.Key) != "key" || string(msg.Value) != "value" {
+				t.Errorf("expected offset %d, got %+v", expected, msg)
+			}
+			if err := buffer.Advance(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !buffer.Empty() {
+			t.Error("expected buffer to be empty")
+		}
+	})
+
+	t.Run("should keep pending messages across reopening", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.spill")
+		buffer, err := openSpillBuffer(path, defaultSpillMaxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range fakeMessages(2) {
+			if err := buffer.Append(context.Background(), msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := buffer.Advance(); err != nil {
+			t.Fatal(err)
+		}
+		buffer.Close()
+
+		reopened, err := openSpillBuffer(path, defaultSpillMaxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reopened.Close()
+
+		msg, err := reopened.Peek(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Offset != 1 {
+			t.Errorf("expected offset 1, got %d", msg.Offset)
+		}
+	})
+
+	t.Run("should discard a record torn by a crash", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.spill")
+		buffer, err := openSpillBuffer(path, defaultSpillMaxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := buffer.Append(context.Background(), fakeMessages(1)[0]); err != nil {
+			t.Fatal(err)
+		}
+		buffer.Close()
+
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte{0, 0, 1, 0, '{'})
+		file.Close()
+
+		reopened, err := openSpillBuffer(path, defaultSpillMaxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reopened.Close()
+
+		if _, err := reopened.Peek(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := reopened.Advance(); err != nil {
+			t.Fatal(err)
+		}
+		if !reopened.Empty() {
+			t.Error("expected the torn record to be discarded")
+		}
+	})
+
+	t.Run("should block appends while full", func(t *testing.T) {
+		buffer, err := openSpillBuffer(filepath.Join(t.TempDir(), "test.spill"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer buffer.Close()
+
+		messages := fakeMessages(2)
+		if err := buffer.Append(context.Background(), messages[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := buffer.Append(ctx, messages[1]); err != context.DeadlineExceeded {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+
+		appended := make(chan error)
+		go func() {
+			appended <- buffer.Append(context.Background(), messages[1])
+		}()
+		if err := buffer.Advance(); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-appended; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should block peeks while empty", func(t *testing.T) {
+		buffer, err := openSpillBuffer(filepath.Join(t.TempDir(), "test.spill"), defaultSpillMaxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer buffer.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := buffer.Peek(ctx); err != context.DeadlineExceeded {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("should peek and advance in batches", func(t *testing.T) {
+		buffer, err := openSpillBuffer(filepath.Join(t.TempDir(), "test.spill"), defaultSpillMaxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer buffer.Close()
+
+		for _, msg := range fakeMessages(5) {
+			if ok, err := buffer.TryAppend(msg); !ok || err != nil {
+				t.Fatalf("expected the message to be appended, got %v %v", ok, err)
+			}
+		}
+		if buffer.Len() != 5 {
+			t.Errorf("expected 5 pending messages, got %d", buffer.Len())
+		}
+
+		batch, err := buffer.PeekBatch(context.Background(), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) != 3 || batch[0].Offset != 0 || batch[2].Offset != 2 {
+			t.Fatalf("expected offsets 0 to 2, got %+v", batch)
+		}
+		if err := buffer.AdvanceBatch(len(batch)); err != nil {
+			t.Fatal(err)
+		}
+
+		batch, err = buffer.PeekBatch(context.Background(), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) != 2 || batch[0].Offset != 3 {
+			t.Fatalf("expected offsets 3 and 4, got %+v", batch)
+		}
+		if err := buffer.AdvanceBatch(3); err == nil {
+			t.Error("expected an error advancing past the last message")
+		}
+	})
+
+	t.Run("should refuse appends without waiting while full", func(t *testing.T) {
+		buffer, err := openSpillBuffer(filepath.Join(t.TempDir(), "test.spill"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer buffer.Close()
+
+		messages := fakeMessages(2)
+		if ok, err := buffer.TryAppend(messages[0]); !ok || err != nil {
+			t.Fatalf("expected an empty buffer to accept a message, got %v %v", ok, err)
+		}
+		if ok, err := buffer.TryAppend(messages[1]); ok || err != nil {
+			t.Errorf("expected a full buffer to refuse the message, got %v %v", ok, err)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const (
+	spoolFile                 = "producer.spool"
+	defaultSpoolMaxBytes      = 64 << 20
+	defaultSpoolRetryInterval = 1 * time.Second
+	spoolPollInterval         = 10 * time.Millisecond
+)
+
+// ErrSpoolFull is returned by ProduceMessage and PublishAsync when a message can neither be written
+// nor spooled because the spool set with WithSpool has reached its size bound.
+var ErrSpoolFull = errors.New("spool is full")
+
+// SpoolPolicy configures the disk-backed spool of a producer.
+type SpoolPolicy struct {
+	// Dir is the directory holding the spool. Required. It must not be shared with another producer.
+	Dir string
+	// MaxBytes bounds the size of the spool. Once it is reached, messages that cannot be written
+	// fail with ErrSpoolFull. Defaults to 64 MiB.
+	MaxBytes int64
+	// RetryInterval is how long the forwarder waits before retrying a failed write while the circuit
+	// breaker is closed. Defaults to one second.
+	RetryInterval time.Duration
+}
+
+// WithSpool keeps the messages the brokers cannot take in a spool on disk, instead of failing.
+//
+// A message is appended to the spool when its write fails, while the circuit breaker is open, and
+// while the spool holds messages, so that it does not overtake the spooled messages of its key.
+// ProduceMessage then returns nil, and the delivery of PublishAsync succeeds: the message is on disk.
+// A background forwarder writes the spooled messages, oldest first, as soon as the circuit breaker
+// lets it. A message may be written twice if the brokers fail in the middle of a write.
+//
+// The circuit breaker is the one set with WithCircuitBreaker, or one with the default policy.
+// Messages still in the spool when the producer is closed stay on disk, and are forwarded by the next
+// producer using the same directory.
+func WithSpool(policy SpoolPolicy) Option {
+	return func(o *options) {
+		o.spool = &policy
+	}
+}
+
+// producerSpool forwards the messages spooled by the producer of a messenger.
+type producerSpool struct {
+	m             *KafkaMessenger
+	buffer        *spillBuffer
+	retryInterval time.Duration
+	batchSize     int
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// startSpool opens the spool set with WithSpool and starts forwarding it, closing the messenger if it fails.
+func (m *KafkaMessenger) startSpool(o options) error {
+	if o.spool == nil {
+		return nil
+	}
+
+	policy := *o.spool
+	if policy.MaxBytes <= 0 {
+		policy.MaxBytes = defaultSpoolMaxBytes
+	}
+	if policy.RetryInterval <= 0 {
+		policy.RetryInterval = defaultSpoolRetryInterval
+	}
+	buffer, err := openSpool(policy)
+	if err != nil {
+		if closeErr := m.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+		return fmt.Errorf("failed to open spool: %w", err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	spool := &producerSpool{
+		m:             m,
+		buffer:        buffer,
+		retryInterval: policy.RetryInterval,
+		batchSize:     max(o.batchSize, 1),
+		stop:          stop,
+		done:          make(chan struct{}),
+	}
+	if pending := buffer.Len(); pending > 0 {
+		m.logger().Info("forwarding messages spooled by a previous producer", "spooled", pending)
+	}
+	go spool.forward(ctx)
+	m.spool = spool
+	return nil
+}
+
+func openSpool(policy SpoolPolicy) (*spillBuffer, error) {
+	if policy.Dir == "" {
+		return nil, fmt.Errorf("spool directory is empty")
+	}
+	return openSpillBuffer(filepath.Join(policy.Dir, spoolFile), policy.MaxBytes)
+}
+
+// produce writes msgs, or spools them if they cannot be written right away.
+func (s *producerSpool) produce(ctx context.Context, msgs ...kafka.Message) error {
+	// Messages may only skip the spool while it is empty, otherwise they would overtake the spooled
+	// messages of their key.
+	if s.buffer.Empty() && s.m.breaker.allow() == nil {
+		err := s.m.write(ctx, s.m.producer, msgs...)
+		s.m.breaker.record(ctx, err)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		s.m.logger().Warn("spooling messages that could not be written", "count", len(msgs), "error", err)
+	}
+
+	for _, msg := range msgs {
+		ok, err := s.buffer.TryAppend(msg)
+		if err != nil {
+			return fmt.Errorf("failed to spool message: %w", err)
+		}
+		if !ok {
+			return ErrSpoolFull
+		}
+		s.m.metrics.observeSpool(msg.Topic)
+	}
+	return nil
+}
+
+// forward writes the spooled messages in batches, oldest first, until ctx is done.
+func (s *producerSpool) forward(ctx context.Context) {
+	defer close(s.done)
+
+	for {
+		msgs, err := s.buffer.PeekBatch(ctx, s.batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.m.logger().Error("failed to read spool, stopped forwarding it", "error", err)
+			}
+			return
+		}
+
+		if wait := s.m.breaker.retryIn(); wait > 0 {
+			if !sleepContext(ctx, wait) {
+				return
+			}
+			continue
+		}
+		if s.m.breaker.allow() != nil {
+			if !sleepContext(ctx, s.retryInterval) {
+				return
+			}
+			continue
+		}
+
+		err = s.m.write(ctx, s.m.producer, msgs...)
+		s.m.breaker.record(ctx, err)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.m.logger().Warn("failed to forward spooled messages", "error", err, "spooled", s.buffer.Len())
+			if !sleepContext(ctx, s.retryInterval) {
+				return
+			}
+			continue
+		}
+
+		if err := s.buffer.AdvanceBatch(len(msgs)); err != nil {
+			s.m.logger().Error("failed to advance spool, stopped forwarding it", "error", err)
+			return
+		}
+		if s.buffer.Empty() {
+			s.m.logger().Info("forwarded every spooled message")
+		}
+	}
+}
+
+// close gives the forwarder until ctx is done to empty the spool, unless the circuit breaker is
+// open, then stops it and closes the spool. It returns the number of messages left in the spool.
+func (s *producerSpool) close(ctx context.Context) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+
+	for !s.buffer.Empty() && s.m.breaker.current() != CircuitOpen {
+		if !sleepContext(ctx, spoolPollInterval) {
+			break
+		}
+	}
+	s.stop()
+	<-s.done
+
+	spooled := s.buffer.Len()
+	if spooled > 0 {
+		s.m.logger().Warn("closing with spooled messages, they will be forwarded by the next producer", "spooled", spooled)
+	}
+	if err := s.buffer.Close(); err != nil {
+		return spooled, fmt.Errorf("failed to close spool: %w", err)
+	}
+	return spooled, nil
+}
+
+// Spooled returns the number of messages waiting in the spool set with WithSpool.
+func (m *KafkaMessenger) Spooled() int {
+	if m.spool == nil {
+		return 0
+	}
+	return m.spool.buffer.Len()
+}
+
+// CircuitState returns the state of the circuit breaker set with WithCircuitBreaker or WithSpool,
+// CircuitClosed if there is none.
+func (m *KafkaMessenger) CircuitState() CircuitState {
+	return m.breaker.current()
+}
@@ -0,0 +1,226 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestSpool(t *testing.T) {
+	newSpooledMessenger := func(t *testing.T, writer messageWriter, dir string, opts ...Option) *KafkaMessenger {
+		t.Helper()
+		opts = append([]Option{
+			WithSpool(SpoolPolicy{Dir: dir, RetryInterval: 5 * time.Millisecond}),
+			WithCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 1, OpenFor: 20 * time.Millisecond}),
+		}, opts...)
+		o := newOptions(opts)
+		messenger := newMessenger("transactions", "", nil, o)
+		messenger.producer = writer
+		if err := messenger.startSpool(o); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { messenger.Close() })
+		return messenger
+	}
+
+	t.Run("should write directly while the brokers are available", func(t *testing.T) {
+		writer := &flakyWriter{}
+		messenger := newSpooledMessenger(t, writer, t.TempDir())
+
+		if err := messenger.ProduceMessage(context.Background(), "1", "first"); err != nil {
+			t.Fatal(err)
+		}
+		if written := writer.written(); len(written) != 1 {
+			t.Errorf("expected 1 written message, got %d", len(written))
+		}
+		if messenger.Spooled() != 0 {
+			t.Errorf("expected an empty spool, got %d messages", messenger.Spooled())
+		}
+	})
+
+	t.Run("should spool messages while the brokers are down and forward them in order", func(t *testing.T) {
+		writer := &flakyWriter{}
+		writer.down.Store(true)
+		messenger := newSpooledMessenger(t, writer, t.TempDir())
+
+		for i := range 5 {
+			if err := messenger.ProduceMessage(context.Background(), fmt.Sprint(i%2), fmt.Sprint(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if delivery := messenger.PublishAsync(context.Background(), "1", "5"); delivery.Wait(context.Background()) != nil {
+			t.Fatal(delivery.Err())
+		}
+		if messenger.Spooled() != 6 {
+			t.Errorf("expected 6 spooled messages, got %d", messenger.Spooled())
+		}
+		if messenger.CircuitState() == CircuitClosed {
+			t.Error("expected the circuit to be open")
+		}
+
+		writer.down.Store(false)
+		waitFor(t, func() bool { return messenger.Spooled() == 0 })
+
+		// While the spool is not empty, later messages must queue behind it.
+		if err := messenger.ProduceMessage(context.Background(), "0", "6"); err != nil {
+			t.Fatal(err)
+		}
+		var values []string
+		for _, msg := range writer.written() {
+			values = append(values, string(msg.Value))
+		}
+		if fmt.Sprint(values) != "[0 1 2 3 4 5 6]" {
+			t.Errorf("expected the messages in order, got %v", values)
+		}
+		if messenger.CircuitState() != CircuitClosed {
+			t.Errorf("expected the circuit to close, got %s", messenger.CircuitState())
+		}
+	})
+
+	t.Run("should not wait for the brokers while the circuit is open", func(t *testing.T) {
+		writer := &flakyWriter{}
+		writer.down.Store(true)
+		messenger := newSpooledMessenger(t, writer, t.TempDir(), WithCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 1, OpenFor: time.Hour}))
+
+		for range 3 {
+			if err := messenger.ProduceMessage(context.Background(), "1", "value"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if attempts := writer.attempts.Load(); attempts != 1 {
+			t.Errorf("expected a single write attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("should fail once the spool is full", func(t *testing.T) {
+		writer := &flakyWriter{}
+		writer.down.Store(true)
+		messenger := newSpooledMessenger(t, writer, t.TempDir(), WithSpool(SpoolPolicy{Dir: t.TempDir(), MaxBytes: 1}))
+
+		if err := messenger.ProduceMessage(context.Background(), "1", "first"); err != nil {
+			t.Fatal(err)
+		}
+		if err := messenger.ProduceMessage(context.Background(), "1", "second"); !errors.Is(err, ErrSpoolFull) {
+			t.Errorf("expected ErrSpoolFull, got %v", err)
+		}
+	})
+
+	t.Run("should forward the messages spooled before a restart", func(t *testing.T) {
+		dir := t.TempDir()
+		down := &flakyWriter{}
+		down.down.Store(true)
+		first := newSpooledMessenger(t, down, dir)
+		for i := range 3 {
+			if err := first.ProduceMessage(context.Background(), "1", fmt.Sprint(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		report, err := first.Shutdown(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Spooled != 3 {
+			t.Errorf("expected 3 spooled messages in the report, got %d", report.Spooled)
+		}
+
+		up := &flakyWriter{}
+		second := newSpooledMessenger(t, up, dir)
+		waitFor(t, func() bool { return second.Spooled() == 0 })
+		if written := up.written(); len(written) != 3 || string(written[2].Value) != "2" {
+			t.Errorf("expected the 3 spooled messages to be forwarded, got %v", written)
+		}
+	})
+
+	t.Run("should forward the spool before shutting down", func(t *testing.T) {
+		writer := &flakyWriter{}
+		writer.down.Store(true)
+		messenger := newSpooledMessenger(t, writer, t.TempDir(), WithCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 100}))
+		if err := messenger.ProduceMessage(context.Background(), "1", "first"); err != nil {
+			t.Fatal(err)
+		}
+		writer.down.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		report, err := messenger.Shutdown(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Spooled != 0 || len(writer.written()) != 1 {
+			t.Errorf("expected the spooled message to be forwarded, %d left", report.Spooled)
+		}
+	})
+}
+
+func TestCircuitBreakerWithoutSpool(t *testing.T) {
+	writer := &flakyWriter{}
+	writer.down.Store(true)
+	messenger := newMessenger("transactions", "", nil, newOptions([]Option{WithCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 2, OpenFor: time.Hour})}))
+	messenger.producer = writer
+
+	for range 2 {
+		if err := messenger.ProduceMessage(context.Background(), "1", "value"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected the write error, got %v", err)
+		}
+	}
+	if err := messenger.ProduceMessage(context.Background(), "1", "value"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if delivery := messenger.PublishAsync(context.Background(), "1", "value"); !errors.Is(delivery.Wait(context.Background()), ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", delivery.Err())
+	}
+	if attempts := writer.attempts.Load(); attempts != 2 {
+		t.Errorf("expected 2 write attempts, got %d", attempts)
+	}
+}
+
+// flakyWriter is a messageWriter that fails while down is set.
+type flakyWriter struct {
+	down     atomic.Bool
+	attempts atomic.Int64
+
+	mu       sync.Mutex
+	messages []kafka.Message
+}
+
+func (w *flakyWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.attempts.Add(1)
+	if w.down.Load() {
+		return errors.New("broker unavailable")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *flakyWriter) Close() error {
+	return nil
+}
+
+func (w *flakyWriter) written() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka.Message(nil), w.messages...)
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,476 @@
+package kafka
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	tableQueueCapacity = 1000
+	tableBatchSize     = 500
+	stateFileTimeout   = time.Second
+)
+
+var (
+	stateMetaBucket    = []byte("meta")
+	stateValuesBucket  = []byte("values")
+	stateOffsetsBucket = []byte("offsets")
+	stateTopicKey      = []byte("topic")
+)
+
+// WithStateFile persists the table created by NewTable in a BoltDB file at path, so that it is
+// restored from the file on restart, and only the messages produced since are read from the topic.
+// The file belongs to a single topic, and cannot be opened by two tables at once.
+func WithStateFile(path string) Option {
+	return func(o *options) {
+		o.stateFile = path
+	}
+}
+
+// Change is a change of the value of a key of a Table.
+type Change struct {
+	Key string
+	// Value is the new value, nil if the key was deleted.
+	Value []byte
+	// Previous is the value before the change, nil if the key was not set.
+	Previous  []byte
+	Partition int
+	Offset    int64
+}
+
+// Deleted reports whether the change removed the key.
+func (c Change) Deleted() bool {
+	return c.Value == nil
+}
+
+// Table is a local view of the latest value of every key of a topic, usually a compacted one, such as
+// the current settings of every account. A message with an empty value, a tombstone, deletes its key.
+//
+// The table reads every partition of the topic from the beginning, without a consumer group. With
+// WithStateFile, it is also stored on disk together with the position reached in every partition, so
+// a restart only reads the messages produced since. It is safe for concurrent use.
+type Table struct {
+	Topic string
+
+	source topicReader
+	db     *bolt.DB
+	logger *slog.Logger
+
+	mu        sync.RWMutex
+	values    map[string][]byte
+	positions map[int]int64
+	callbacks []func(Change)
+
+	running      atomic.Bool
+	restored     chan struct{}
+	restoredOnce sync.Once
+}
+
+// NewTable creates a Table of the topic of the given brokers. Call Run to fill it.
+//
+// Parameters:
+//   - topic: the topic to materialize
+//   - brokerAddresses: the addresses of the Kafka brokers to connect to
+//   - opts: optional settings; only WithStateFile, WithLogger, WithTLS and WithSASL apply
+//
+// Returns:
+//   - *Table: a new Table, restored from its state file if it has one
+//   - error: an error if the topic or broker address is empty, or the state file cannot be opened
+//
+// Example usage:
+//
+//	settings, err := NewTable("account_settings", brokers, WithStateFile("/var/lib/accounts/settings.db"))
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	defer settings.Close()
+//	go settings.Run(ctx)
+//	if err := settings.WaitRestored(ctx); err != nil {
+//	  log.Fatal(err)
+//	}
+//	value, ok := settings.Get(accountID)
+func NewTable(topic string, brokerAddresses []string, opts ...Option) (*Table, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("topic is empty")
+	}
+	o := newOptions(opts)
+	source, err := newKafkaTopicReader(brokerAddresses, o)
+	if err != nil {
+		return nil, err
+	}
+	return newTable(topic, source, o)
+}
+
+func newTable(topic string, source topicReader, o options) (*Table, error) {
+	logger := o.logger
+	if logger == nil {
+		logger = quietLogger()
+	}
+	t := &Table{
+		Topic:     topic,
+		source:    source,
+		logger:    logger.With("topic", topic),
+		values:    make(map[string][]byte),
+		positions: make(map[int]int64),
+		restored:  make(chan struct{}),
+	}
+	if o.stateFile == "" {
+		return t, nil
+	}
+
+	db, err := bolt.Open(o.stateFile, 0o600, &bolt.Options{Timeout: stateFileTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+	t.db = db
+	if err := t.load(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load state file: %w", err)
+	}
+	return t, nil
+}
+
+// load reads the values and positions stored in the state file.
+func (t *Table) load() error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(stateMetaBucket)
+		if err != nil {
+			return err
+		}
+		if topic := meta.Get(stateTopicKey); topic == nil {
+			if err := meta.Put(stateTopicKey, []byte(t.Topic)); err != nil {
+				return err
+			}
+		} else if string(topic) != t.Topic {
+			return fmt.Errorf("the state file belongs to topic %s", topic)
+		}
+
+		values, err := tx.CreateBucketIfNotExists(stateValuesBucket)
+		if err != nil {
+			return err
+		}
+		offsets, err := tx.CreateBucketIfNotExists(stateOffsetsBucket)
+		if err != nil {
+			return err
+		}
+		if err := values.ForEach(func(key, value []byte) error {
+			t.values[string(key)] = bytes.Clone(value)
+			return nil
+		}); err != nil {
+			return err
+		}
+		return offsets.ForEach(func(key, value []byte) error {
+			if len(key) != 4 || len(value) != 8 {
+				return fmt.Errorf("invalid offset record")
+			}
+			t.positions[int(binary.BigEndian.Uint32(key))] = int64(binary.BigEndian.Uint64(value))
+			return nil
+		})
+	})
+}
+
+// Run reads the topic into the table until ctx is cancelled. It first restores the table up to the
+// messages produced when it starts, see WaitRestored, then keeps following the topic.
+//
+// Parameters:
+//   - ctx: the context to stop the table with
+//
+// Returns:
+//   - error: an error if the table is already running, or if the topic cannot be read or the state file written
+func (t *Table) Run(ctx context.Context) error {
+	if !t.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("table is already running")
+	}
+	defer t.running.Store(false)
+
+	partitions, err := t.source.partitions(ctx, t.Topic)
+	if err != nil {
+		return err
+	}
+
+	// ends holds, for every partition that is not restored yet, the offset to reach.
+	ends := make(map[int]int64)
+	starts := make(map[int]int64)
+	t.mu.RLock()
+	for _, partition := range partitions {
+		start := min(max(t.positions[partition.ID], partition.FirstOffset), partition.LastOffset)
+		starts[partition.ID] = start
+		if start < partition.LastOffset {
+			ends[partition.ID] = partition.LastOffset
+		}
+	}
+	t.mu.RUnlock()
+	if len(ends) == 0 {
+		t.markRestored()
+	} else {
+		t.logger.Info("restoring table", "partitions", len(ends))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msgs := make(chan kafka.Message, tableQueueCapacity)
+	readErrs := make(chan error, len(partitions))
+	var wg sync.WaitGroup
+	for partition, start := range starts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := t.follow(ctx, partition, start, msgs); err != nil {
+				readErrs <- err
+				cancel()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(msgs)
+	}()
+
+	applyErr := t.applyAll(msgs, ends)
+	cancel()
+	for range msgs {
+	}
+	close(readErrs)
+
+	if applyErr != nil {
+		return applyErr
+	}
+	return <-readErrs
+}
+
+// follow reads the partition from start and queues its messages until ctx is done.
+func (t *Table) follow(ctx context.Context, partition int, start int64, msgs chan<- kafka.Message) error {
+	reader, err := t.source.open(t.Topic, partition, start)
+	if err != nil {
+		return fmt.Errorf("failed to read %s partition %d: %w", t.Topic, partition, err)
+	}
+	defer reader.Close()
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read %s partition %d: %w", t.Topic, partition, err)
+		}
+		select {
+		case msgs <- msg:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// applyAll applies the queued messages in batches until msgs is closed.
+func (t *Table) applyAll(msgs <-chan kafka.Message, ends map[int]int64) error {
+	for msg := range msgs {
+		batch := []kafka.Message{msg}
+	queued:
+		// The messages already queued are stored in a single transaction.
+		for len(batch) < tableBatchSize {
+			select {
+			case msg, ok := <-msgs:
+				if !ok {
+					break queued
+				}
+				batch = append(batch, msg)
+			default:
+				break queued
+			}
+		}
+
+		if err := t.apply(batch); err != nil {
+			return err
+		}
+		if len(ends) > 0 {
+			for _, msg := range batch {
+				if end, ok := ends[msg.Partition]; ok && msg.Offset+1 >= end {
+					delete(ends, msg.Partition)
+				}
+			}
+			if len(ends) == 0 {
+				t.logger.Info("restored table", "keys", t.Len())
+				t.markRestored()
+			}
+		}
+	}
+	return nil
+}
+
+// apply updates the table with batch, stores it and notifies the changes.
+func (t *Table) apply(batch []kafka.Message) error {
+	var changes []Change
+	positions := make(map[int]int64)
+
+	t.mu.Lock()
+	for _, msg := range batch {
+		if msg.Offset < t.positions[msg.Partition] {
+			continue
+		}
+		t.positions[msg.Partition] = msg.Offset + 1
+		positions[msg.Partition] = msg.Offset + 1
+		if len(msg.Key) == 0 {
+			continue
+		}
+
+		key := string(msg.Key)
+		previous, existed := t.values[key]
+		var value []byte
+		if len(msg.Value) > 0 {
+			value = msg.Value
+			t.values[key] = value
+		} else if existed {
+			delete(t.values, key)
+		} else {
+			continue
+		}
+		changes = append(changes, Change{Key: key, Value: value, Previous: previous, Partition: msg.Partition, Offset: msg.Offset})
+	}
+	callbacks := t.callbacks
+	t.mu.Unlock()
+
+	if err := t.store(changes, positions); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	for _, change := range changes {
+		for _, callback := range callbacks {
+			callback(change)
+		}
+	}
+	return nil
+}
+
+// store writes the changes and the new positions to the state file, if the table has one.
+func (t *Table) store(changes []Change, positions map[int]int64) error {
+	if t.db == nil || len(positions) == 0 {
+		return nil
+	}
+	return t.db.Update(func(tx *bolt.Tx) error {
+		values, offsets := tx.Bucket(stateValuesBucket), tx.Bucket(stateOffsetsBucket)
+		for _, change := range changes {
+			var err error
+			if change.Deleted() {
+				err = values.Delete([]byte(change.Key))
+			} else {
+				err = values.Put([]byte(change.Key), change.Value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for partition, position := range positions {
+			var key [4]byte
+			var value [8]byte
+			binary.BigEndian.PutUint32(key[:], uint32(partition))
+			binary.BigEndian.PutUint64(value[:], uint64(position))
+			if err := offsets.Put(key[:], value[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (t *Table) markRestored() {
+	t.restoredOnce.Do(func() { close(t.restored) })
+}
+
+// WaitRestored blocks until Run has read the messages that were in the topic when it started, so that
+// the table is up to date.
+//
+// Parameters:
+//   - ctx: the context to stop waiting with
+//
+// Returns:
+//   - error: the context's error if it is done first
+func (t *Table) WaitRestored(ctx context.Context) error {
+	select {
+	case <-t.restored:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get returns the value of key, which must not be modified.
+func (t *Table) Get(key string) ([]byte, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	value, ok := t.values[key]
+	return value, ok
+}
+
+// Range calls fn for every key of the table, in key order, until fn returns false. It iterates over a
+// snapshot, so fn may use the table, and values must not be modified.
+func (t *Table) Range(fn func(key string, value []byte) bool) {
+	t.mu.RLock()
+	keys := slices.Sorted(maps.Keys(t.values))
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = t.values[key]
+	}
+	t.mu.RUnlock()
+
+	for i, key := range keys {
+		if !fn(key, values[i]) {
+			return
+		}
+	}
+}
+
+// Len returns the number of keys of the table.
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.values)
+}
+
+// Positions returns the next offset the table will read from every partition it has read.
+func (t *Table) Positions() []PartitionOffset {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	positions := make([]PartitionOffset, 0, len(t.positions))
+	for partition, offset := range t.positions {
+		positions = append(positions, PartitionOffset{Topic: t.Topic, Partition: partition, Offset: offset})
+	}
+	slices.SortFunc(positions, func(a, b PartitionOffset) int { return cmp.Compare(a.Partition, b.Partition) })
+	return positions
+}
+
+// OnChange calls callback with every change of the table, once it has been stored, including the
+// changes read while restoring. Callbacks run on the goroutine of Run, so they must not block.
+func (t *Table) OnChange(callback func(Change)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.callbacks = append(t.callbacks, callback)
+}
+
+// Close closes the state file. It must be called once Run has returned.
+func (t *Table) Close() error {
+	if t.running.Load() {
+		return fmt.Errorf("table is running")
+	}
+	if t.db == nil {
+		return nil
+	}
+	if err := t.db.Close(); err != nil && !errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return fmt.Errorf("failed to close state file: %w", err)
+	}
+	return nil
+}
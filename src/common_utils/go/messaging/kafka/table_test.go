@@ -0,0 +1,225 @@
+//go:build unit
+
+package kafka_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+)
+
+func TestTable(t *testing.T) {
+	t.Run("should restore the topic then follow it", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(3)
+		producer := newMemoryMessenger(t, broker, "settings", "")
+		produce(t, producer, "account-1", "EUR", "account-2", "USD", "account-1", "BRL")
+		table := newTable(t, broker, "settings")
+
+		stop := runTable(t, table)
+		defer stop()
+		if value, _ := table.Get("account-1"); string(value) != "BRL" {
+			t.Errorf("expected the latest value BRL, got %q", value)
+		}
+		if table.Len() != 2 {
+			t.Errorf("expected 2 keys, got %d", table.Len())
+		}
+
+		produce(t, producer, "account-3", "JPY")
+		waitForValue(t, table, "account-3", "JPY")
+	})
+
+	t.Run("should delete a key on a tombstone", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		producer := newMemoryMessenger(t, broker, "settings", "")
+		produce(t, producer, "account-1", "EUR", "account-2", "USD", "account-1", "")
+		table := newTable(t, broker, "settings")
+
+		stop := runTable(t, table)
+		defer stop()
+		if _, ok := table.Get("account-1"); ok {
+			t.Error("expected account-1 to be deleted")
+		}
+		if table.Len() != 1 {
+			t.Errorf("expected 1 key, got %d", table.Len())
+		}
+	})
+
+	t.Run("should range over the keys in order", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(3)
+		producer := newMemoryMessenger(t, broker, "settings", "")
+		produce(t, producer, "c", "3", "a", "1", "d", "4", "b", "2")
+		table := newTable(t, broker, "settings")
+
+		stop := runTable(t, table)
+		defer stop()
+		var keys []string
+		table.Range(func(key string, value []byte) bool {
+			keys = append(keys, key+"="+string(value))
+			return key != "c"
+		})
+		if fmt.Sprint(keys) != "[a=1 b=2 c=3]" {
+			t.Errorf("expected [a=1 b=2 c=3], got %v", keys)
+		}
+	})
+
+	t.Run("should notify the changes", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		producer := newMemoryMessenger(t, broker, "settings", "")
+		table := newTable(t, broker, "settings")
+		var mu sync.Mutex
+		var changes []string
+		table.OnChange(func(change kafka.Change) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, fmt.Sprintf("%s:%s->%s:%t", change.Key, change.Previous, change.Value, change.Deleted()))
+		})
+
+		stop := runTable(t, table)
+		defer stop()
+		produce(t, producer, "account-1", "EUR", "account-1", "USD", "account-1", "", "account-2", "")
+		waitUntil(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(changes) == 3
+		})
+		// Deleting a key that is not set is not a change.
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		if expected := "[account-1:->EUR:false account-1:EUR->USD:false account-1:USD->:true]"; fmt.Sprint(changes) != expected {
+			t.Errorf("expected %s, got %v", expected, changes)
+		}
+	})
+
+	t.Run("should resume from its state file", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(2)
+		producer := newMemoryMessenger(t, broker, "settings", "")
+		produce(t, producer, "account-1", "EUR", "account-2", "USD", "account-3", "BRL", "account-3", "")
+		stateFile := filepath.Join(t.TempDir(), "settings.db")
+
+		table := newTable(t, broker, "settings", kafka.WithStateFile(stateFile))
+		stop := runTable(t, table)
+		produce(t, producer, "account-1", "GBP")
+		waitForValue(t, table, "account-1", "GBP")
+		stop()
+		positions := table.Positions()
+		if err := table.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		table = newTable(t, broker, "settings", kafka.WithStateFile(stateFile))
+		if value, _ := table.Get("account-1"); string(value) != "GBP" {
+			t.Errorf("expected GBP to be loaded from the state file, got %q", value)
+		}
+		if table.Len() != 2 {
+			t.Errorf("expected 2 keys loaded from the state file, got %d", table.Len())
+		}
+		if fmt.Sprint(table.Positions()) != fmt.Sprint(positions) {
+			t.Errorf("expected positions %v, got %v", positions, table.Positions())
+		}
+
+		var replayed []string
+		var mu sync.Mutex
+		table.OnChange(func(change kafka.Change) {
+			mu.Lock()
+			defer mu.Unlock()
+			replayed = append(replayed, change.Key)
+		})
+		produce(t, producer, "account-2", "CHF")
+		stop = runTable(t, table)
+		defer stop()
+		if value, _ := table.Get("account-2"); string(value) != "CHF" {
+			t.Errorf("expected CHF, got %q", value)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if fmt.Sprint(replayed) != "[account-2]" {
+			t.Errorf("expected only the new message to be read, got changes of %v", replayed)
+		}
+	})
+
+	t.Run("should refuse the state file of another topic", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker(1)
+		stateFile := filepath.Join(t.TempDir(), "settings.db")
+		table := newTable(t, broker, "settings", kafka.WithStateFile(stateFile))
+		if err := table.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := broker.NewTable("currencies", kafka.WithStateFile(stateFile))
+		if err == nil || !strings.Contains(err.Error(), "topic settings") {
+			t.Errorf("expected an error about topic settings, got %v", err)
+		}
+	})
+}
+
+func newTable(t *testing.T, broker *kafka.MemoryBroker, topic string, opts ...kafka.Option) *kafka.Table {
+	t.Helper()
+
+	table, err := broker.NewTable(topic, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { table.Close() })
+	return table
+}
+
+// runTable runs table until it is restored, and returns a function stopping it.
+func runTable(t *testing.T, table *kafka.Table) func() {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- table.Run(ctx) }()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	if err := table.WaitRestored(waitCtx); err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	return func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// produce produces the given key and value pairs.
+func produce(t *testing.T, producer *kafka.KafkaMessenger, pairs ...string) {
+	t.Helper()
+
+	for i := 0; i < len(pairs); i += 2 {
+		if err := producer.ProduceMessage(context.Background(), pairs[i], pairs[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func waitForValue(t *testing.T, table *kafka.Table, key, expected string) {
+	t.Helper()
+
+	waitUntil(t, func() bool {
+		value, _ := table.Get(key)
+		return string(value) == expected
+	})
+}
+
+func waitUntil(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+
+	kafka "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/EdmilsonRodrigues/lilo-finance-manager/src/common_utils/go/messaging/kafka"
+
+// WithTracerProvider sets the provider of the tracer used for the producer and consumer spans.
+// Defaults to the global provider, see otel.SetTracerProvider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = provider
+	}
+}
+
+// WithPropagator sets how the trace context is written to and read from message headers.
+// Defaults to W3C Trace Context (traceparent and tracestate headers).
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		o.propagator = propagator
+	}
+}
+
+// headerCarrier adapts the headers of a Kafka message to a propagation.TextMapCarrier.
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (c headerCarrier) Get(key string) string {
+	for _, header := range *c.headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces every header with the given key, so that a forwarded message does not keep the
+// trace context of its previous hop.
+func (c headerCarrier) Set(key, value string) {
+	headers := (*c.headers)[:0]
+	for _, header := range *c.headers {
+		if header.Key != key {
+			headers = append(headers, header)
+		}
+	}
+	*c.headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, header := range *c.headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
+
+func (m *KafkaMessenger) tracer() trace.Tracer {
+	provider := m.tracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(instrumentationName)
+}
+
+func (m *KafkaMessenger) textMapPropagator() propagation.TextMapPropagator {
+	if m.propagator == nil {
+		return propagation.TraceContext{}
+	}
+	return m.propagator
+}
+
+type spanParentsKey struct{}
+
+// withSpanParents returns ctx carrying the contexts the producer spans of a batch of messages are
+// started in, one per message, for batches gathering the messages of several callers.
+func withSpanParents(ctx context.Context, parents []context.Context) context.Context {
+	return context.WithValue(ctx, spanParentsKey{}, parents)
+}
+
+// spanParent returns the context the producer span of the i-th of n messages written with ctx is
+// started in: the one given to withSpanParents, or ctx itself.
+func spanParent(ctx context.Context, i, n int) context.Context {
+	if parents, ok := ctx.Value(spanParentsKey{}).([]context.Context); ok && len(parents) == n {
+		return parents[i]
+	}
+	return ctx
+}
+
+// startProducerSpan starts the span of a message being published and writes its context to the message headers.
+// The span is only carried by the headers: a write shared by several messages runs in the caller's context.
+func (m *KafkaMessenger) startProducerSpan(ctx context.Context, msg *kafka.Message) trace.Span {
+	ctx, span := m.tracer().Start(ctx, "publish "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingOperationName("publish"),
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingMessageBodySize(len(msg.Value)),
+		),
+	)
+	if len(msg.Key) > 0 {
+		span.SetAttributes(semconv.MessagingKafkaMessageKey(string(msg.Key)))
+	}
+
+	m.textMapPropagator().Inject(ctx, headerCarrier{headers: &msg.Headers})
+	return span
+}
+
+// startConsumerSpan starts the span of a consumed message, linked to the span that published it.
+// The operation is "receive" for messages handed over to a channel, and "process" for messages
+// passed to a Handler.
+func (m *KafkaMessenger) startConsumerSpan(ctx context.Context, msg kafka.Message, operation attribute.KeyValue) (context.Context, trace.Span) {
+	headers := msg.Headers
+	producerCtx := m.textMapPropagator().Extract(context.Background(), headerCarrier{headers: &headers})
+
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			operation,
+			semconv.MessagingOperationName(operation.Value.AsString()),
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+			semconv.MessagingMessageBodySize(len(msg.Value)),
+		),
+	}
+	if producer := trace.SpanContextFromContext(producerCtx); producer.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: producer}))
+	}
+
+	ctx, span := m.tracer().Start(ctx, operation.Value.AsString()+" "+msg.Topic, opts...)
+	if m.GroupID != "" {
+		span.SetAttributes(semconv.MessagingKafkaConsumerGroup(m.GroupID))
+	}
+	if len(msg.Key) > 0 {
+		span.SetAttributes(semconv.MessagingKafkaMessageKey(string(msg.Key)))
+	}
+	return ctx, span
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
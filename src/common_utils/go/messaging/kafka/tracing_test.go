@@ -0,0 +1,227 @@
+//go:build unit
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHeaderCarrier(t *testing.T) {
+	headers := []kafka.Header{{Key: "traceparent", Value: []byte("old")}, {Key: "source", Value: []byte("test")}}
+	carrier := headerCarrier{headers: &headers}
+
+	carrier.Set("traceparent", "new")
+
+	if value := carrier.Get("traceparent"); value != "new" {
+		t.Errorf("expected the header to be replaced, got %q", value)
+	}
+	if keys := carrier.Keys(); !reflect.DeepEqual(keys, []string{"source", "traceparent"}) {
+		t.Errorf("expected a single traceparent header, got %v", keys)
+	}
+	if value := carrier.Get("tracestate"); value != "" {
+		t.Errorf("expected no tracestate, got %q", value)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("should link the process span to the producer span", func(t *testing.T) {
+		recorder, messenger := newTracedMessenger(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		parentCtx, parent := messenger.tracer().Start(ctx, "create transaction")
+		if err := messenger.ProduceMessage(parentCtx, "account-1", "payload"); err != nil {
+			t.Fatal(err)
+		}
+		parent.End()
+
+		var handlerSpan trace.SpanContext
+		messenger.Consume(ctx, func(ctx context.Context, msg Message) error {
+			if value, ok := msg.Header("traceparent"); !ok || value == "" {
+				t.Error("expected the message to carry a traceparent header")
+			}
+			handlerSpan = trace.SpanContextFromContext(ctx)
+			cancel()
+			return nil
+		})
+
+		publish := findSpan(t, recorder, "publish transactions")
+		process := findSpan(t, recorder, "process transactions")
+
+		if publish.SpanKind() != trace.SpanKindProducer || publish.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("expected a producer span under the caller's span, got %v under %v", publish.SpanKind(), publish.Parent())
+		}
+		if process.SpanKind() != trace.SpanKindConsumer {
+			t.Errorf("expected a consumer span, got %v", process.SpanKind())
+		}
+		if links := process.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != publish.SpanContext().SpanID() {
+			t.Errorf("expected a link to the producer span, got %v", links)
+		}
+		if handlerSpan.SpanID() != process.SpanContext().SpanID() {
+			t.Error("expected the handler to run in the process span")
+		}
+		assertAttributes(t, publish, map[attribute.Key]string{
+			"messaging.system":            "kafka",
+			"messaging.operation.type":    "publish",
+			"messaging.destination.name":  "transactions",
+			"messaging.kafka.message.key": "account-1",
+		})
+		assertAttributes(t, process, map[attribute.Key]string{
+			"messaging.system":                   "kafka",
+			"messaging.operation.type":           "process",
+			"messaging.destination.name":         "transactions",
+			"messaging.destination.partition.id": "0",
+			"messaging.kafka.consumer.group":     "account_management",
+			"messaging.kafka.message.key":        "account-1",
+		})
+	})
+
+	t.Run("should write a batch in the caller's context", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		defer provider.Shutdown(context.Background())
+
+		writer := &contextWriter{}
+		messenger := newMessenger("transactions", "", nil, newOptions([]Option{WithTracerProvider(provider)}))
+		messenger.producer = writer
+
+		parentCtx, parent := messenger.tracer().Start(context.Background(), "import transactions")
+		records := []Record{{Key: "account-1", Value: "a"}, {Key: "account-2", Value: "b"}}
+		if err := messenger.ProduceMessages(parentCtx, records...); err != nil {
+			t.Fatal(err)
+		}
+		parent.End()
+
+		if written := trace.SpanContextFromContext(writer.ctx); !written.Equal(parent.SpanContext()) {
+			t.Errorf("expected the batch to be written in the caller's span, got %v", written.SpanID())
+		}
+		var publishes int
+		for _, span := range recorder.Ended() {
+			if span.Name() != "publish transactions" {
+				continue
+			}
+			publishes++
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("expected every producer span under the caller's span, got %v", span.Parent())
+			}
+		}
+		if publishes != len(records) {
+			t.Errorf("expected %d producer spans, got %d", len(records), publishes)
+		}
+	})
+
+	t.Run("should record handler failures on the process span", func(t *testing.T) {
+		recorder, messenger := newTracedMessenger(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		messenger.ProduceMessage(ctx, "account-1", "payload")
+		messenger.Consume(ctx, func(ctx context.Context, msg Message) error {
+			cancel()
+			return errors.New("temporary failure")
+		})
+
+		process := findSpan(t, recorder, "process transactions")
+		if process.Status().Code != codes.Error {
+			t.Errorf("expected an error status, got %v", process.Status())
+		}
+		if events := process.Events(); len(events) != 1 || events[0].Name != "exception" {
+			t.Errorf("expected the failed attempt to be recorded, got %v", events)
+		}
+	})
+
+	t.Run("should start a receive span for channel consumers", func(t *testing.T) {
+		recorder, messenger := newTracedMessenger(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		messages, _, err := messenger.StartMessageConsumer(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer messenger.StopConsumer()
+
+		messenger.ProduceMessage(ctx, "account-1", "payload")
+		select {
+		case <-messages:
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+
+		publish := findSpan(t, recorder, "publish transactions")
+		receive := findSpan(t, recorder, "receive transactions")
+		if links := receive.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != publish.SpanContext().SpanID() {
+			t.Errorf("expected a link to the producer span, got %v", links)
+		}
+	})
+}
+
+// contextWriter is a messageWriter that keeps the context of the last write.
+type contextWriter struct {
+	ctx context.Context
+}
+
+func (w *contextWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.ctx = ctx
+	return nil
+}
+
+func (w *contextWriter) Close() error {
+	return nil
+}
+
+func newTracedMessenger(t *testing.T) (*tracetest.SpanRecorder, *KafkaMessenger) {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	messenger, err := NewMemoryBroker(1).NewMessenger("transactions", "account_management", WithTracerProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { messenger.Close() })
+	return recorder, messenger
+}
+
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected a span named %q", name)
+	return nil
+}
+
+func assertAttributes(t *testing.T, span sdktrace.ReadOnlySpan, expected map[attribute.Key]string) {
+	t.Helper()
+
+	attributes := make(map[attribute.Key]string)
+	for _, attr := range span.Attributes() {
+		attributes[attr.Key] = attr.Value.Emit()
+	}
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("expected %s to be %q on %s, got %q", key, value, span.Name(), attributes[key])
+		}
+	}
+}
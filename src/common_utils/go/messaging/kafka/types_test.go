@@ -0,0 +1,11 @@
+//go:build unit || integration
+
+package kafka_test
+
+// TransactionCreated is the payload of the envelopes published by the tests.
+type TransactionCreated struct {
+	ID        int     `json:"id"`
+	AccountID int     `json:"account_id"`
+	Amount    float64 `json:"amount"`
+	Currency  string  `json:"currency"`
+}
@@ -0,0 +1,176 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Compatibility is the rule a new schema version must follow with regard to the previous one.
+type Compatibility string
+
+const (
+	// Backward requires consumers using the new version to read payloads written with the previous one.
+	Backward Compatibility = "BACKWARD"
+	// Forward requires consumers using the previous version to read payloads written with the new one.
+	Forward Compatibility = "FORWARD"
+	// Full requires both Backward and Forward compatibility.
+	Full Compatibility = "FULL"
+	// None disables the compatibility check.
+	None Compatibility = "NONE"
+)
+
+// IncompatibleError lists the reasons why a schema breaks a compatibility rule.
+type IncompatibleError struct {
+	Compatibility Compatibility
+	Problems      []string
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("schema is not %s compatible: %s", strings.ToLower(string(e.Compatibility)), strings.Join(e.Problems, "; "))
+}
+
+// CheckCompatibility checks that the JSON Schema next follows the compatibility rule with regard to previous.
+//
+// Parameters:
+//   - previous: the JSON Schema of the previous version
+//   - next: the JSON Schema of the new version
+//   - compatibility: the rule to check
+//
+// Returns:
+//   - error: an *IncompatibleError if next breaks the rule, or an error if a schema is not valid JSON
+func CheckCompatibility(previous, next []byte, compatibility Compatibility) error {
+	var previousSchema, nextSchema map[string]any
+	if err := json.Unmarshal(previous, &previousSchema); err != nil {
+		return fmt.Errorf("invalid previous schema: %w", err)
+	}
+	if err := json.Unmarshal(next, &nextSchema); err != nil {
+		return fmt.Errorf("invalid new schema: %w", err)
+	}
+	return checkCompatibility(previousSchema, nextSchema, compatibility)
+}
+
+func checkCompatibility(previous, next map[string]any, compatibility Compatibility) error {
+	var problems []string
+	switch compatibility {
+	case None:
+		return nil
+	case Backward:
+		problems = canRead(next, previous, "payload")
+	case Forward:
+		problems = canRead(previous, next, "payload")
+	case Full:
+		problems = append(canRead(next, previous, "payload"), canRead(previous, next, "payload")...)
+	default:
+		return fmt.Errorf("unknown compatibility %q", compatibility)
+	}
+
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return &IncompatibleError{Compatibility: compatibility, Problems: problems}
+	}
+	return nil
+}
+
+// canRead returns why payloads valid against writer may be rejected by reader, if they may.
+func canRead(reader, writer map[string]any, path string) []string {
+	var problems []string
+
+	readerTypes, writerTypes := types(reader), types(writer)
+	if len(readerTypes) > 0 {
+		if len(writerTypes) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: type restricted to %v", path, readerTypes))
+		}
+		for _, writerType := range writerTypes {
+			if !acceptsType(readerTypes, writerType) {
+				problems = append(problems, fmt.Sprintf("%s: type %s is not accepted by %v", path, writerType, readerTypes))
+			}
+		}
+	}
+
+	if readerEnum, ok := reader["enum"].([]any); ok {
+		writerEnum, ok := writer["enum"].([]any)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: values restricted to %v", path, readerEnum))
+		}
+		for _, value := range writerEnum {
+			if !slices.ContainsFunc(readerEnum, func(v any) bool { return reflect.DeepEqual(v, value) }) {
+				problems = append(problems, fmt.Sprintf("%s: value %v is not accepted", path, value))
+			}
+		}
+	}
+
+	readerProperties, writerProperties := properties(reader), properties(writer)
+	writerRequired := required(writer)
+	for _, field := range required(reader) {
+		if !slices.Contains(writerRequired, field) {
+			problems = append(problems, fmt.Sprintf("%s.%s: required but may be missing", path, field))
+		}
+	}
+	if additional, ok := reader["additionalProperties"].(bool); ok && !additional {
+		for field := range writerProperties {
+			if _, ok := readerProperties[field]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s: not allowed", path, field))
+			}
+		}
+	}
+	for field, readerProperty := range readerProperties {
+		if writerProperty, ok := writerProperties[field]; ok {
+			problems = append(problems, canRead(readerProperty, writerProperty, path+"."+field)...)
+		}
+	}
+
+	readerItems, readerHasItems := reader["items"].(map[string]any)
+	writerItems, writerHasItems := writer["items"].(map[string]any)
+	if readerHasItems && writerHasItems {
+		problems = append(problems, canRead(readerItems, writerItems, path+"[]")...)
+	}
+
+	return problems
+}
+
+func types(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, value := range t {
+			if s, ok := value.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func acceptsType(accepted []string, t string) bool {
+	return slices.Contains(accepted, t) || (t == "integer" && slices.Contains(accepted, "number"))
+}
+
+func properties(schema map[string]any) map[string]map[string]any {
+	result := make(map[string]map[string]any)
+	if props, ok := schema["properties"].(map[string]any); ok {
+		for field, value := range props {
+			if property, ok := value.(map[string]any); ok {
+				result[field] = property
+			}
+		}
+	}
+	return result
+}
+
+func required(schema map[string]any) []string {
+	var fields []string
+	if values, ok := schema["required"].([]any); ok {
+		for _, value := range values {
+			if field, ok := value.(string); ok {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,97 @@
+//go:build unit
+
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	const base = `{
+		"type": "object",
+		"properties": {"id": {"type": "integer"}, "amount": {"type": "number"}},
+		"required": ["id", "amount"]
+	}`
+
+	for _, tc := range []struct {
+		name          string
+		next          string
+		compatibility Compatibility
+		compatible    bool
+	}{
+		{
+			name:          "optional field added",
+			next:          `{"type": "object", "properties": {"id": {"type": "integer"}, "amount": {"type": "number"}, "note": {"type": "string"}}, "required": ["id", "amount"]}`,
+			compatibility: Full,
+			compatible:    true,
+		},
+		{
+			name:          "required field added",
+			next:          `{"type": "object", "properties": {"id": {"type": "integer"}, "amount": {"type": "number"}, "note": {"type": "string"}}, "required": ["id", "amount", "note"]}`,
+			compatibility: Backward,
+			compatible:    false,
+		},
+		{
+			name:          "required field added, forward",
+			next:          `{"type": "object", "properties": {"id": {"type": "integer"}, "amount": {"type": "number"}, "note": {"type": "string"}}, "required": ["id", "amount", "note"]}`,
+			compatibility: Forward,
+			compatible:    true,
+		},
+		{
+			name:          "required field removed",
+			next:          `{"type": "object", "properties": {"id": {"type": "integer"}}, "required": ["id"]}`,
+			compatibility: Forward,
+			compatible:    false,
+		},
+		{
+			name:          "required field removed, backward",
+			next:          `{"type": "object", "properties": {"id": {"type": "integer"}}, "required": ["id"]}`,
+			compatibility: Backward,
+			compatible:    true,
+		},
+		{
+			name:          "type widened",
+			next:          `{"type": "object", "properties": {"id": {"type": "number"}, "amount": {"type": "number"}}, "required": ["id", "amount"]}`,
+			compatibility: Backward,
+			compatible:    true,
+		},
+		{
+			name:          "type changed",
+			next:          `{"type": "object", "properties": {"id": {"type": "string"}, "amount": {"type": "number"}}, "required": ["id", "amount"]}`,
+			compatibility: Full,
+			compatible:    false,
+		},
+		{
+			name:          "type changed without check",
+			next:          `{"type": "object", "properties": {"id": {"type": "string"}, "amount": {"type": "number"}}, "required": ["id", "amount"]}`,
+			compatibility: None,
+			compatible:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckCompatibility([]byte(base), []byte(tc.next), tc.compatibility)
+			var incompatible *IncompatibleError
+			switch {
+			case tc.compatible && err != nil:
+				t.Errorf("expected the schemas to be compatible, got %v", err)
+			case !tc.compatible && !errors.As(err, &incompatible):
+				t.Errorf("expected an *IncompatibleError, got %v", err)
+			}
+		})
+	}
+
+	t.Run("should reject extra fields closed by the reader", func(t *testing.T) {
+		closed := `{"type": "object", "properties": {"id": {"type": "integer"}}, "additionalProperties": false}`
+		open := `{"type": "object", "properties": {"id": {"type": "integer"}, "note": {"type": "string"}}}`
+		if err := CheckCompatibility([]byte(closed), []byte(open), Forward); err == nil {
+			t.Error("expected the new field to break forward compatibility")
+		}
+	})
+
+	t.Run("should reject unknown compatibility", func(t *testing.T) {
+		if err := CheckCompatibility([]byte(base), []byte(base), "SIDEWAYS"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
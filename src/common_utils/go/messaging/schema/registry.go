@@ -0,0 +1,268 @@
+// Package schema implements the file-based registry of the JSON Schemas of the event payloads
+// published on the bus. See src/common_utils/schemas/README.md for the layout of the registry.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+const compatibilityFile = "compatibility.json"
+
+// ErrUnknownSchema is returned when the registry has no schema for an event type and version.
+var ErrUnknownSchema = errors.New("unknown schema")
+
+var versionFile = regexp.MustCompile(`^v([1-9][0-9]*)\.schema\.json$`)
+
+// eventTypeName is the form of the event types, which name the directories of the registry.
+var eventTypeName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// Registry holds the payload schemas of every event type, by version.
+// It is safe for concurrent use.
+type Registry struct {
+	dir string
+
+	mu       sync.RWMutex
+	subjects map[string]*subject
+}
+
+type subject struct {
+	compatibility Compatibility
+	versions      []*version
+}
+
+type version struct {
+	document map[string]any
+	compiled *jsonschema.Schema
+}
+
+// Open loads the registry stored in dir, compiling every schema and checking that each version is
+// compatible with the previous one.
+//
+// Parameters:
+//   - dir: the registry directory, holding one directory per event type
+//
+// Returns:
+//   - *Registry: the loaded registry
+//   - error: an error if a schema is invalid, versions are missing, or two versions are incompatible
+//
+// Example usage:
+//
+//	registry, err := schema.Open("../../schemas")
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	err = kafka.Publish(ctx, messenger, key, envelope, kafka.WithSchemaValidation(registry))
+func Open(dir string) (*Registry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry: %w", err)
+	}
+
+	registry := &Registry{dir: dir, subjects: make(map[string]*subject)}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		subject, err := loadSubject(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schemas for %s: %w", entry.Name(), err)
+		}
+		registry.subjects[entry.Name()] = subject
+	}
+	return registry, nil
+}
+
+func loadSubject(dir string) (*subject, error) {
+	compatibility, err := readCompatibility(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[int]string)
+	for _, entry := range entries {
+		if match := versionFile.FindStringSubmatch(entry.Name()); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			files[number] = filepath.Join(dir, entry.Name())
+		}
+	}
+
+	numbers := make([]int, 0, len(files))
+	for number := range files {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	s := &subject{compatibility: compatibility}
+	for i, number := range numbers {
+		if number != i+1 {
+			return nil, fmt.Errorf("version %d is missing", i+1)
+		}
+		data, err := os.ReadFile(files[number])
+		if err != nil {
+			return nil, err
+		}
+		v, err := compile(files[number], data)
+		if err != nil {
+			return nil, fmt.Errorf("version %d: %w", number, err)
+		}
+		if i > 0 {
+			if err := checkCompatibility(s.versions[i-1].document, v.document, compatibility); err != nil {
+				return nil, fmt.Errorf("version %d: %w", number, err)
+			}
+		}
+		s.versions = append(s.versions, v)
+	}
+	return s, nil
+}
+
+func readCompatibility(dir string) (Compatibility, error) {
+	data, err := os.ReadFile(filepath.Join(dir, compatibilityFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Full, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var config struct {
+		Compatibility Compatibility `json:"compatibility"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", compatibilityFile, err)
+	}
+	switch config.Compatibility {
+	case Backward, Forward, Full, None:
+		return config.Compatibility, nil
+	default:
+		return "", fmt.Errorf("invalid %s: unknown compatibility %q", compatibilityFile, config.Compatibility)
+	}
+}
+
+func compile(location string, data []byte) (*version, error) {
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if _, ok := document.(map[string]any); !ok {
+		return nil, fmt.Errorf("schema must be a JSON object")
+	}
+
+	url := "file://" + filepath.ToSlash(location)
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, document); err != nil {
+		return nil, err
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return nil, err
+	}
+
+	// The compatibility check works on the standard JSON decoding of the schema.
+	var plain map[string]any
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return nil, err
+	}
+	return &version{document: plain, compiled: compiled}, nil
+}
+
+// Validate checks a JSON payload against the schema of the given event type and version.
+//
+// Parameters:
+//   - eventType: the type of the event, e.g. "TransactionCreated"
+//   - schemaVersion: the schema version of the event, starting at 1
+//   - payload: the JSON-encoded payload
+//
+// Returns:
+//   - error: ErrUnknownSchema if the registry has no such schema, or an error describing why the payload is invalid
+func (r *Registry) Validate(eventType string, schemaVersion int, payload []byte) error {
+	r.mu.RLock()
+	s, ok := r.subjects[eventType]
+	r.mu.RUnlock()
+	if !ok || schemaVersion < 1 || schemaVersion > len(s.versions) {
+		return fmt.Errorf("%w: %s version %d", ErrUnknownSchema, eventType, schemaVersion)
+	}
+
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("invalid JSON payload: %w", err)
+	}
+	if err := s.versions[schemaVersion-1].compiled.Validate(instance); err != nil {
+		return fmt.Errorf("payload does not match %s version %d: %w", eventType, schemaVersion, err)
+	}
+	return nil
+}
+
+// Latest returns the latest schema version of the event type, or 0 if the registry has none.
+func (r *Registry) Latest(eventType string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if s, ok := r.subjects[eventType]; ok {
+		return len(s.versions)
+	}
+	return 0
+}
+
+// Add stores a new schema version for the event type, after checking it against the compatibility
+// rule of the event type. The first version of a new event type is always accepted.
+//
+// Parameters:
+//   - eventType: the type of the event, e.g. "TransactionCreated"
+//   - schema: the JSON Schema of the payload
+//
+// Returns:
+//   - int: the number of the new version
+//   - error: an *IncompatibleError if the schema breaks the compatibility rule, or an error if the event
+//     type is not a name made of letters, digits and underscores, or the schema is invalid or cannot be written
+func (r *Registry) Add(eventType string, schema []byte) (int, error) {
+	if !eventTypeName.MatchString(eventType) {
+		return 0, fmt.Errorf("invalid event type %q", eventType)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := filepath.Join(r.dir, eventType)
+	s, ok := r.subjects[eventType]
+	if !ok {
+		s = &subject{compatibility: Full}
+	}
+	number := len(s.versions) + 1
+	location := filepath.Join(dir, fmt.Sprintf("v%d.schema.json", number))
+
+	v, err := compile(location, schema)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema: %w", err)
+	}
+	if number > 1 {
+		if err := checkCompatibility(s.versions[number-2].document, v.document, s.compatibility); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(location, schema, 0o644); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", location, err)
+	}
+
+	s.versions = append(s.versions, v)
+	r.subjects[eventType] = s
+	return number, nil
+}
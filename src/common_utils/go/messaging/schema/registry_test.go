@@ -0,0 +1,135 @@
+//go:build unit
+
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const transactionV1 = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {"id": {"type": "integer"}, "amount": {"type": "number"}},
+	"required": ["id", "amount"]
+}`
+
+func TestRegistry(t *testing.T) {
+	t.Run("should load the schemas of the repository", func(t *testing.T) {
+		registry, err := Open(filepath.Join("..", "..", "..", "schemas"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if latest := registry.Latest("TransactionCreated"); latest < 1 {
+			t.Fatalf("expected TransactionCreated to have a schema, got version %d", latest)
+		}
+
+		valid := `{"id": 1, "account_id": 2, "amount": 10.5, "currency": "BRL"}`
+		if err := registry.Validate("TransactionCreated", 1, []byte(valid)); err != nil {
+			t.Errorf("expected the payload to be valid, got %v", err)
+		}
+		invalid := `{"id": "1", "account_id": 2, "amount": 10.5}`
+		if err := registry.Validate("TransactionCreated", 1, []byte(invalid)); err == nil {
+			t.Error("expected the payload to be invalid")
+		}
+	})
+
+	t.Run("should add compatible versions and refuse incompatible ones", func(t *testing.T) {
+		dir := t.TempDir()
+		registry, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if version, err := registry.Add("TransactionCreated", []byte(transactionV1)); err != nil || version != 1 {
+			t.Fatalf("expected version 1, got %d (%v)", version, err)
+		}
+		v2 := `{"type": "object", "properties": {"id": {"type": "integer"}, "amount": {"type": "number"}, "note": {"type": "string"}}, "required": ["id", "amount"]}`
+		if version, err := registry.Add("TransactionCreated", []byte(v2)); err != nil || version != 2 {
+			t.Fatalf("expected version 2, got %d (%v)", version, err)
+		}
+
+		v3 := `{"type": "object", "properties": {"id": {"type": "string"}}, "required": ["id"]}`
+		var incompatible *IncompatibleError
+		if _, err := registry.Add("TransactionCreated", []byte(v3)); !errors.As(err, &incompatible) {
+			t.Fatalf("expected an *IncompatibleError, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "TransactionCreated", "v3.schema.json")); !errors.Is(err, os.ErrNotExist) {
+			t.Error("expected the incompatible schema not to be written")
+		}
+
+		reopened, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if latest := reopened.Latest("TransactionCreated"); latest != 2 {
+			t.Errorf("expected 2 versions after reopening, got %d", latest)
+		}
+	})
+
+	t.Run("should refuse event types that are not names", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "registry"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		registry, err := Open(filepath.Join(dir, "registry"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, eventType := range []string{"", ".", "..", "../TransactionCreated", "Transaction.Created", "1TransactionCreated"} {
+			if _, err := registry.Add(eventType, []byte(transactionV1)); err == nil {
+				t.Errorf("expected %q to be refused", eventType)
+			}
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) > 1 {
+			t.Errorf("expected nothing written outside the registry, got %v", entries)
+		}
+	})
+
+	t.Run("should refuse incompatible versions on open", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSchema(t, dir, "TransactionCreated", "v1.schema.json", transactionV1)
+		writeSchema(t, dir, "TransactionCreated", "v2.schema.json", `{"type": "object", "properties": {"id": {"type": "string"}}}`)
+
+		if _, err := Open(dir); err == nil {
+			t.Error("expected an error")
+		}
+
+		writeSchema(t, dir, "TransactionCreated", "compatibility.json", `{"compatibility": "NONE"}`)
+		if _, err := Open(dir); err != nil {
+			t.Errorf("expected the check to be disabled, got %v", err)
+		}
+	})
+
+	t.Run("should refuse missing versions", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSchema(t, dir, "TransactionCreated", "v2.schema.json", transactionV1)
+
+		if _, err := Open(dir); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("should report unknown schemas", func(t *testing.T) {
+		registry, err := Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := registry.Validate("TransactionCreated", 1, []byte(`{}`)); !errors.Is(err, ErrUnknownSchema) {
+			t.Errorf("expected ErrUnknownSchema, got %v", err)
+		}
+	})
+}
+
+func writeSchema(t *testing.T, dir, eventType, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, eventType), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, eventType, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}